@@ -0,0 +1,230 @@
+package orm
+
+import (
+	"context"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// context key of the current actor
+type actorKey struct{}
+
+/*
+WithActor returns a copy of ctx holding actor, e.g the id of the
+authenticated user. Models stamped with the actor tag fields:
+
+	type Invoice struct {
+		ID        uint
+		Total     int
+		CreatedBy uint `orm:"created_by"`
+		UpdatedBy uint `orm:"updated_by"`
+		CreatedAt time.Time
+		UpdatedAt time.Time
+	}
+
+	ctx := orm.WithActor(r.Context(), user.ID)
+	err := dborm.WithContext(ctx).Insert(&invoice)
+
+Insert sets both fields to the actor, Update and PartialUpdate set the
+updated_by field. Values of stamped fields and of gorm managed timestamps
+given by the caller are ignored, so that they can't be spoofed by input
+payloads; timestamps are set with the NowFunc of the database.
+Without an actor, stamped fields are set to their zero value.
+*/
+func WithActor(ctx context.Context, actor any) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor of ctx set with WithActor.
+func ActorFrom(ctx context.Context) (any, bool) {
+	actor := ctx.Value(actorKey{})
+	return actor, actor != nil
+}
+
+// WithContext returns an ORM executing queries with ctx.
+func (o *orm) WithContext(ctx context.Context) ORM {
+	return &orm{DB: o.DB.WithContext(ctx)}
+}
+
+// fields of a model managed by stamping
+type stampFields struct {
+	createdBy, updatedBy *schema.Field
+	createdAt, updatedAt []*schema.Field
+}
+
+// returns the stamped fields of s and whether s has any
+func stampsOf(s *schema.Schema) (stampFields, bool) {
+	st := stampFields{createdBy: taggedField(s, "created_by"), updatedBy: taggedField(s, "updated_by")}
+	if st.createdBy == nil && st.updatedBy == nil {
+		return st, false
+	}
+
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		if field.AutoCreateTime > 0 {
+			st.createdAt = append(st.createdAt, field)
+		}
+
+		if field.AutoUpdateTime > 0 {
+			st.updatedAt = append(st.updatedAt, field)
+		}
+	}
+	return st, true
+}
+
+// returns the value of field for the actor of ctx, zero if there is none
+func actorValue(ctx context.Context, field *schema.Field) any {
+	if actor, ok := ActorFrom(ctx); ok {
+		return actor
+	}
+	return reflect.Zero(field.FieldType).Interface()
+}
+
+// returns the value of a timestamp field at now, which may be a unix time
+func timeValue(field *schema.Field, now time.Time) any {
+	unit := field.AutoCreateTime
+	if unit == 0 {
+		unit = field.AutoUpdateTime
+	}
+
+	switch field.FieldType.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		switch unit {
+		case schema.UnixNanosecond:
+			return now.UnixNano()
+		case schema.UnixMillisecond:
+			return now.UnixMilli()
+		}
+		return now.Unix()
+	}
+	return now
+}
+
+// stamps the records of v as created by the actor of db
+func stampCreate(db *gorm.DB, v any) error {
+	s, err := parseSchema(db, v)
+	if err != nil {
+		return err
+	}
+
+	st, ok := stampsOf(s)
+	if !ok {
+		return nil
+	}
+
+	rv := indirectValue(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return st.stamp(db, rv, true)
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := st.stamp(db, reflect.Indirect(rv.Index(i)), true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stamps v as updated by the actor of db, or as created if its primary
+// key is zero since Update inserts it. It returns the columns that must
+// not be updated.
+func stampUpdate(db *gorm.DB, v any) ([]string, error) {
+	s, err := parseSchema(db, v)
+	if err != nil {
+		return nil, err
+	}
+
+	st, ok := stampsOf(s)
+	if !ok {
+		return nil, nil
+	}
+
+	rv := indirectValue(v)
+	created := len(primaryKeyWhere(db, s, rv)) < len(s.PrimaryFields)
+	if err := st.stamp(db, rv, created); err != nil || created {
+		return nil, err
+	}
+
+	var omit []string
+	if st.createdBy != nil {
+		omit = append(omit, st.createdBy.DBName)
+	}
+
+	for _, field := range st.createdAt {
+		omit = append(omit, field.DBName)
+	}
+	return omit, nil
+}
+
+// sets the updated fields of record, and its created fields if created
+func (st stampFields) stamp(db *gorm.DB, record reflect.Value, created bool) error {
+	ctx := db.Statement.Context
+	now := db.NowFunc()
+
+	values := make(map[*schema.Field]any)
+	for _, field := range st.updatedAt {
+		values[field] = timeValue(field, now)
+	}
+
+	if st.updatedBy != nil {
+		values[st.updatedBy] = actorValue(ctx, st.updatedBy)
+	}
+
+	if created {
+		for _, field := range st.createdAt {
+			values[field] = timeValue(field, now)
+		}
+
+		if st.createdBy != nil {
+			values[st.createdBy] = actorValue(ctx, st.createdBy)
+		}
+	}
+
+	for field, value := range values {
+		if err := field.Set(ctx, record, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// returns updates for PartialUpdate of model without the stamped fields
+// given by the caller and with the updated_by field set to the actor,
+// or updates unchanged if model is not stamped.
+func stampUpdates(db *gorm.DB, model any, updates any) (any, error) {
+	s, err := parseSchema(db, model)
+	if err != nil {
+		return nil, err
+	}
+
+	st, ok := stampsOf(s)
+	if !ok {
+		return updates, nil
+	}
+
+	values, err := updatesMap(db, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	stamped := append(append([]*schema.Field{st.createdBy, st.updatedBy}, st.createdAt...), st.updatedAt...)
+	for _, field := range stamped {
+		if field != nil {
+			delete(values, field.DBName)
+			delete(values, field.Name)
+		}
+	}
+
+	// gorm sets the updated times of map updates with NowFunc
+	if st.updatedBy != nil {
+		values[st.updatedBy.DBName] = actorValue(db.Statement.Context, st.updatedBy)
+	}
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package orm_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+type Invoice struct {
+	ID        uint
+	Total     int
+	CreatedBy uint  `orm:"created_by"`
+	UpdatedBy uint  `orm:"updated_by"`
+	Version   int64 `orm:"version"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func TestActorStamps(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Invoice{})
+	now := time.Date(2023, 5, 1, 9, 30, 0, 0, time.FixedZone("EAT", 3*60*60))
+	db.NowFunc = func() time.Time { return now }
+
+	if actor, ok := orm.ActorFrom(context.Background()); ok {
+		t.Errorf("expected no actor, got %v", actor)
+	}
+
+	ctx := orm.WithActor(context.Background(), uint(7))
+	dborm := orm.New(db).WithContext(ctx)
+
+	invoice := &Invoice{Total: 10, CreatedBy: 1, CreatedAt: now.AddDate(-1, 0, 0)}
+	if err := dborm.Insert(invoice); err != nil {
+		t.Fatalf("Insert failed with error: %v", err)
+	}
+
+	if invoice.CreatedBy != 7 || invoice.UpdatedBy != 7 || !invoice.CreatedAt.Equal(now) {
+		t.Errorf("expected invoice stamped by 7 at %v, got %+v", now, invoice)
+	}
+
+	// versioned updates omit the created stamps too
+	invoice.CreatedBy = 1
+	invoice.Total = 20
+	if err := orm.New(db).WithContext(orm.WithActor(ctx, uint(8))).Update(invoice); err != nil {
+		t.Fatalf("Update failed with error: %v", err)
+	}
+
+	stored := &Invoice{}
+	orm.New(db).First(stored, invoice.ID)
+	if stored.Total != 20 || stored.Version != 1 || stored.CreatedBy != 7 || stored.UpdatedBy != 8 {
+		t.Errorf("unexpected stored invoice: %+v", stored)
+	}
+
+	if !stored.UpdatedAt.Equal(now) {
+		t.Errorf("expected updated at %v, got %v", now, stored.UpdatedAt)
+	}
+}
@@ -0,0 +1,211 @@
+package orm
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Numeric types that can be aggregated with Sum, Min and Max.
+type Number interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 |
+		~float32 | ~float64
+}
+
+// Interval used to bucket dates in aggregations.
+type Interval string
+
+const (
+	Day   Interval = "day"
+	Week  Interval = "week" // weeks start on monday
+	Month Interval = "month"
+)
+
+// Count returns the number of records of T matching the conditions.
+func Count[T any](db *gorm.DB, conditions ...Condition) (int64, error) {
+	var count int64
+	err := applyConditions(db.Model(new(T)), conditions...).Count(&count).Error
+	return count, err
+}
+
+// Sum returns the sum of column for records of T matching the conditions.
+// column may be an expression e.g "price * quantity". Returns 0 if no records match.
+func Sum[T any, N Number](db *gorm.DB, column string, conditions ...Condition) (N, error) {
+	return aggregateScalar[T, N](db, "COALESCE(SUM("+column+"), 0)", conditions...)
+}
+
+// Avg returns the average of column for records of T matching the conditions.
+// Returns 0 if no records match.
+func Avg[T any](db *gorm.DB, column string, conditions ...Condition) (float64, error) {
+	return aggregateScalar[T, float64](db, "COALESCE(AVG("+column+"), 0)", conditions...)
+}
+
+// Min returns the smallest value of column for records of T matching the conditions.
+// ok is false if no records match or all their values are NULL.
+func Min[T any, N Number](db *gorm.DB, column string, conditions ...Condition) (min N, ok bool, err error) {
+	return aggregateNullable[T, N](db, "MIN("+column+")", conditions...)
+}
+
+// Max returns the largest value of column for records of T matching the conditions.
+// ok is false if no records match or all their values are NULL.
+func Max[T any, N Number](db *gorm.DB, column string, conditions ...Condition) (max N, ok bool, err error) {
+	return aggregateNullable[T, N](db, "MAX("+column+")", conditions...)
+}
+
+func aggregateScalar[T any, N any](db *gorm.DB, expr string, conditions ...Condition) (N, error) {
+	var result N
+
+	tx := applyConditions(db.Model(new(T)), conditions...)
+	// ordering an aggregate without grouping is invalid on postgres
+	delete(tx.Statement.Clauses, "ORDER BY")
+
+	err := tx.Select(expr).Limit(1).Scan(&result).Error
+	return result, err
+}
+
+// like aggregateScalar but ok is false if expr is NULL
+func aggregateNullable[T any, N any](db *gorm.DB, expr string, conditions ...Condition) (N, bool, error) {
+	result, err := aggregateScalar[T, *N](db, expr, conditions...)
+	if err != nil || result == nil {
+		var zero N
+		return zero, false, err
+	}
+	return *result, true, nil
+}
+
+// Groups dates in Column into intervals.
+// The start of each interval is selected as Alias.
+type DateBucket struct {
+	Column   string   // date column to bucket e.g "created_at"
+	Interval Interval // Day, Week or Month
+	Alias    string   // name of the result field, default: "bucket"
+}
+
+// Describes the aggregate columns and grouping of an Aggregate query.
+type Aggregation struct {
+	// Aggregate expressions aliased to the fields of the result struct
+	// e.g "count(*) AS total", "sum(amount) AS amount"
+	Select []string
+
+	// Columns to group by. Grouped columns are also selected.
+	GroupBy []string
+
+	// Optional bucketing by date. Results are ordered by bucket unless
+	// an Order condition is passed.
+	Bucket *DateBucket
+}
+
+/*
+Aggregate runs a grouped aggregate query on the table of T and scans
+each group into R. Filter rows with Where and groups with Having conditions.
+
+	type Sales struct {
+		Category string
+		Bucket   time.Time
+		Total    float64
+	}
+
+	sales, err := orm.Aggregate[Sale, Sales](db, orm.Aggregation{
+		Select:  []string{"sum(amount) AS total"},
+		GroupBy: []string{"category"},
+		Bucket:  &orm.DateBucket{Column: "sold_at", Interval: orm.Month},
+	}, orm.Having{Query: "sum(amount) > ?", Args: []any{100}})
+
+Results are assigned by column name, so dates in buckets are parsed into
+time.Time fields on sqlite too.
+*/
+func Aggregate[T, R any](db *gorm.DB, agg Aggregation, conditions ...Condition) ([]R, error) {
+	columns := make([]string, 0, len(agg.GroupBy)+len(agg.Select)+1)
+	groups := make([]string, 0, len(agg.GroupBy)+1)
+	columns = append(columns, agg.GroupBy...)
+	groups = append(groups, agg.GroupBy...)
+
+	tx := db.Model(new(T))
+	if agg.Bucket != nil {
+		expr, err := DateTrunc(db, agg.Bucket.Interval, agg.Bucket.Column)
+		if err != nil {
+			return nil, err
+		}
+
+		alias := agg.Bucket.Alias
+		if alias == "" {
+			alias = "bucket"
+		}
+
+		columns = append(columns, expr+" AS "+alias)
+		groups = append(groups, expr)
+	}
+	columns = append(columns, agg.Select...)
+
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("aggregate: no columns selected")
+	}
+
+	tx = applyConditions(tx.Select(strings.Join(columns, ", ")), conditions...)
+	if len(groups) > 0 {
+		tx = tx.Group(strings.Join(groups, ", "))
+	}
+
+	if _, ordered := tx.Statement.Clauses["ORDER BY"]; !ordered && agg.Bucket != nil {
+		tx = tx.Order(groups[len(groups)-1])
+	}
+
+	var rows []map[string]any
+	if err := tx.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	results := make([]R, len(rows))
+	if len(rows) == 0 {
+		return results, nil
+	}
+
+	s, err := parseSchema(db, new(R))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		rv := indirectValue(&results[i])
+		for column, value := range row {
+			field := s.LookUpField(column)
+			if field == nil || value == nil {
+				continue
+			}
+
+			if err := field.Set(db.Statement.Context, rv, value); err != nil {
+				return nil, fmt.Errorf("aggregate: column %s: %w", column, err)
+			}
+		}
+	}
+	return results, nil
+}
+
+// DateTrunc returns an SQL expression that truncates column to the start
+// of interval for the dialect of db.
+// Use it to filter or order by the same buckets as Aggregate.
+func DateTrunc(db *gorm.DB, interval Interval, column string) (string, error) {
+	switch interval {
+	case Day, Week, Month:
+	default:
+		return "", fmt.Errorf("unsupported interval %q", interval)
+	}
+
+	switch db.Dialector.Name() {
+	case "postgres":
+		return fmt.Sprintf("date_trunc('%s', %s)", interval, column), nil
+	case "sqlite":
+		switch interval {
+		case Day:
+			return fmt.Sprintf("date(%s)", column), nil
+		case Week:
+			return fmt.Sprintf("date(%s, '-' || ((CAST(strftime('%%w', %s) AS INTEGER) + 6) %% 7) || ' days')",
+				column, column), nil
+		default:
+			return fmt.Sprintf("date(%s, 'start of month')", column), nil
+		}
+	}
+	return "", fmt.Errorf("date bucket: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+}
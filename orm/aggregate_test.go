@@ -0,0 +1,143 @@
+package orm_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type Sale struct {
+	ID       uint      `json:"id" gorm:"primaryKey"`
+	Category string    `json:"category"`
+	Amount   float64   `json:"amount"`
+	Quantity int       `json:"quantity"`
+	SoldAt   time.Time `json:"sold_at"`
+}
+
+type SalesSummary struct {
+	Category string
+	Bucket   time.Time
+	Total    float64
+	Sales    int
+}
+
+func TestAggregates(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Sale{})
+
+	day := func(d int) time.Time {
+		return time.Date(2022, time.October, d, 10, 0, 0, 0, time.UTC)
+	}
+
+	sales := []Sale{
+		{Category: "books", Amount: 10, Quantity: 1, SoldAt: day(3)},  // monday
+		{Category: "books", Amount: 20, Quantity: 2, SoldAt: day(9)},  // sunday
+		{Category: "books", Amount: 30, Quantity: 3, SoldAt: day(10)}, // monday
+		{Category: "games", Amount: 100, Quantity: 1, SoldAt: day(10)},
+	}
+	if err := db.Create(&sales).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := orm.Count[Sale](db, orm.Where{Query: "category = ?", Args: []any{"books"}})
+	if err != nil || count != 3 {
+		t.Errorf("expected count of 3, got %d, err: %v", count, err)
+	}
+
+	total, err := orm.Sum[Sale, float64](db, "amount", orm.Order{Name: "id"})
+	if err != nil || total != 160 {
+		t.Errorf("expected sum of 160, got %v, err: %v", total, err)
+	}
+
+	quantity, err := orm.Sum[Sale, int](db, "quantity", orm.Where{Query: "category = ?", Args: []any{"none"}})
+	if err != nil || quantity != 0 {
+		t.Errorf("expected sum of 0 for no records, got %v, err: %v", quantity, err)
+	}
+
+	avg, err := orm.Avg[Sale](db, "amount")
+	if err != nil || avg != 40 {
+		t.Errorf("expected average of 40, got %v, err: %v", avg, err)
+	}
+
+	largest, ok, err := orm.Max[Sale, int](db, "quantity")
+	if err != nil || !ok || largest != 3 {
+		t.Errorf("expected max of 3, got %v, err: %v", largest, err)
+	}
+
+	// negative values are not hidden by a default of 0
+	smallest, ok, err := orm.Max[Sale, int](db, "-quantity")
+	if err != nil || !ok || smallest != -1 {
+		t.Errorf("expected max of -1, got %v, err: %v", smallest, err)
+	}
+
+	_, ok, err = orm.Min[Sale, float64](db, "amount", orm.Where{Query: "category = ?", Args: []any{"none"}})
+	if err != nil || ok {
+		t.Errorf("expected no min without records, got ok: %v, err: %v", ok, err)
+	}
+
+	byCategory, err := orm.Aggregate[Sale, SalesSummary](db, orm.Aggregation{
+		Select:  []string{"sum(amount) AS total", "count(*) AS sales"},
+		GroupBy: []string{"category"},
+	}, orm.Having{Query: "count(*) > ?", Args: []any{1}})
+
+	if err != nil {
+		t.Fatalf("Aggregate failed with error: %v", err)
+	}
+
+	if len(byCategory) != 1 || byCategory[0].Category != "books" || byCategory[0].Total != 60 || byCategory[0].Sales != 3 {
+		t.Errorf("unexpected aggregate results: %+v", byCategory)
+	}
+
+	weekly, err := orm.Aggregate[Sale, SalesSummary](db, orm.Aggregation{
+		Select: []string{"sum(amount) AS total"},
+		Bucket: &orm.DateBucket{Column: "sold_at", Interval: orm.Week},
+	})
+
+	if err != nil {
+		t.Fatalf("Aggregate failed with error: %v", err)
+	}
+
+	if len(weekly) != 2 {
+		t.Fatalf("expected 2 weeks, got %+v", weekly)
+	}
+
+	if !weekly[0].Bucket.Equal(time.Date(2022, time.October, 3, 0, 0, 0, 0, weekly[0].Bucket.Location())) || weekly[0].Total != 30 {
+		t.Errorf("unexpected first week: %+v", weekly[0])
+	}
+
+	if weekly[1].Bucket.Day() != 10 || weekly[1].Total != 130 {
+		t.Errorf("unexpected second week: %+v", weekly[1])
+	}
+
+	monthly, err := orm.Aggregate[Sale, SalesSummary](db, orm.Aggregation{
+		Select: []string{"count(*) AS sales"},
+		Bucket: &orm.DateBucket{Column: "sold_at", Interval: orm.Month},
+	})
+
+	if err != nil || len(monthly) != 1 || monthly[0].Sales != 4 || monthly[0].Bucket.Day() != 1 {
+		t.Errorf("unexpected monthly results: %+v, err: %v", monthly, err)
+	}
+}
+
+func TestDateTrunc(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expr, err := orm.DateTrunc(db, orm.Week, "created_at")
+	if err != nil || expr != "date_trunc('week', created_at)" {
+		t.Errorf("unexpected postgres expression %q, err: %v", expr, err)
+	}
+
+	if _, err := orm.DateTrunc(db, "year", "created_at"); err == nil {
+		t.Errorf("expected error for unsupported interval")
+	}
+}
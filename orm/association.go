@@ -0,0 +1,173 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/abiiranathan/gowrap/validation"
+	"gorm.io/gorm"
+)
+
+// The name passed in is not a relationship of the model
+var ErrNotAssociation = errors.New("not an association")
+
+/*
+Association manages the records related to Model by one of its has-one,
+has-many, belongs-to or many-to-many relationships.
+
+	tags := orm.Association{DB: db, Model: &post, Name: "Tags"}
+	err := tags.Append(&Tag{Name: "go"}, &Tag{Name: "sql"})
+	n, err := tags.Count()
+	err = tags.Replace([]Tag{{Name: "go"}})
+	err = tags.Remove(&goTag)
+	err = tags.Clear()
+
+Model must have its primary key set. Records passed to Append and Replace
+are validated and saved if they are new. Each operation runs in a
+transaction, so that a failure leaves the relationship unchanged.
+
+Remove and Clear only unlink records: join table rows are deleted for
+many-to-many relationships and foreign keys are set to NULL otherwise.
+*/
+type Association struct {
+	DB    *gorm.DB
+	Model any    // pointer to the owner of the relationship
+	Name  string // name of the field of the relationship e.g Comments
+
+	// Validates appended records. Default: validation.NewValidator("validate")
+	Validator validation.Validator
+}
+
+// Append adds values, pointers to records or slices of records, to the
+// relationship. For has-one and belongs-to relationships, the related
+// record is replaced.
+func (a Association) Append(values ...any) error {
+	if err := a.check(values); err != nil {
+		return err
+	}
+
+	if err := a.validate(values); err != nil {
+		return err
+	}
+
+	return Transaction(a.DB, func(tx *gorm.DB) error {
+		return a.association(tx).Append(values...)
+	})
+}
+
+// Replace sets the related records to values.
+func (a Association) Replace(values ...any) error {
+	if err := a.check(values); err != nil {
+		return err
+	}
+
+	if err := a.validate(values); err != nil {
+		return err
+	}
+
+	return Transaction(a.DB, func(tx *gorm.DB) error {
+		return a.association(tx).Replace(values...)
+	})
+}
+
+// Remove unlinks values from the model. The records are not deleted.
+func (a Association) Remove(values ...any) error {
+	if err := a.check(values); err != nil {
+		return err
+	}
+
+	return Transaction(a.DB, func(tx *gorm.DB) error {
+		return a.association(tx).Delete(values...)
+	})
+}
+
+// Clear unlinks all related records from the model.
+func (a Association) Clear() error {
+	if err := a.check(nil); err != nil {
+		return err
+	}
+
+	return Transaction(a.DB, func(tx *gorm.DB) error {
+		return a.association(tx).Clear()
+	})
+}
+
+// Count returns the number of related records.
+func (a Association) Count() (int64, error) {
+	if err := a.check(nil); err != nil {
+		return 0, err
+	}
+
+	association := a.association(a.DB)
+	count := association.Count()
+	return count, association.Error
+}
+
+// Find populates dest, a pointer to a record or a slice of records,
+// with the related records matching conditions.
+func (a Association) Find(dest any, conditions ...Condition) error {
+	if !IsPointer(dest) {
+		return ErrNotPointer
+	}
+
+	if err := a.check(nil); err != nil {
+		return err
+	}
+
+	db := applyConditions(a.DB, conditions...)
+	return a.association(db).Find(dest)
+}
+
+func (a Association) association(tx *gorm.DB) *gorm.Association {
+	return tx.Model(a.Model).Association(a.Name)
+}
+
+// checks that the relationship exists, that the model has a primary
+// key and that values are records of the related model.
+func (a Association) check(values []any) error {
+	if !IsPointer(a.Model) {
+		return ErrNotPointer
+	}
+
+	s, err := parseSchema(a.DB, a.Model)
+	if err != nil {
+		return err
+	}
+
+	rel, ok := s.Relationships.Relations[a.Name]
+	if !ok {
+		return fmt.Errorf("%w: %s of %s", ErrNotAssociation, a.Name, s.Name)
+	}
+
+	if len(primaryKeyWhere(a.DB, s, indirectValue(a.Model))) < len(s.PrimaryFields) {
+		return fmt.Errorf("association %s: %w", a.Name, gorm.ErrPrimaryKeyRequired)
+	}
+
+	related := rel.FieldSchema.ModelType
+	for _, value := range values {
+		t := reflect.TypeOf(value)
+		for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			t = t.Elem()
+		}
+
+		if t != related {
+			return fmt.Errorf("association %s: expected %s, got %T", a.Name, related, value)
+		}
+	}
+	return nil
+}
+
+func (a Association) validate(values []any) error {
+	v := a.Validator
+	if v == nil {
+		v = validation.NewValidator("validate")
+	}
+
+	for _, value := range values {
+		if err := v.Validate(value); err != nil {
+			return fmt.Errorf("association %s: %w", a.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package orm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+type Author struct {
+	ID   uint
+	Name string `validate:"required"`
+	Bio  *Bio
+}
+
+type Bio struct {
+	ID       uint
+	AuthorID *uint
+	Text     string
+}
+
+type Tag struct {
+	ID   uint
+	Name string `validate:"required"`
+}
+
+type Story struct {
+	ID       uint
+	Title    string
+	AuthorID *uint
+	Author   *Author
+	Tags     []Tag `gorm:"many2many:story_tags"`
+}
+
+func TestAssociationManyToMany(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Author{}, &Bio{}, &Tag{}, &Story{})
+	story := &Story{Title: "Generics"}
+	orm.New(db).Insert(story)
+
+	tags := orm.Association{DB: db, Model: story, Name: "Tags"}
+	golang, sql := &Tag{Name: "go"}, &Tag{Name: "sql"}
+	if err := tags.Append(golang, sql); err != nil {
+		t.Fatalf("Append failed with error: %v", err)
+	}
+
+	if n, err := tags.Count(); n != 2 || err != nil {
+		t.Errorf("expected 2 tags, got %d, err: %v", n, err)
+	}
+
+	var verrs validator.ValidationErrors
+	if err := tags.Append([]Tag{{Name: "valid"}, {Name: ""}}); !errors.As(err, &verrs) {
+		t.Errorf("expected validation errors, got %v", err)
+	}
+
+	if err := tags.Append(&Story{}); err == nil {
+		t.Error("expected an error appending a record of another model")
+	}
+
+	if n, _ := tags.Count(); n != 2 {
+		t.Errorf("invalid records must not be appended, got %d tags", n)
+	}
+
+	var found []Tag
+	if err := tags.Find(&found, orm.Order{Name: "name DESC"}); err != nil || len(found) != 2 || found[0].Name != "sql" {
+		t.Errorf("unexpected tags: %+v, err: %v", found, err)
+	}
+
+	if err := tags.Replace(golang); err != nil {
+		t.Fatalf("Replace failed with error: %v", err)
+	}
+
+	if n, _ := tags.Count(); n != 1 {
+		t.Errorf("expected 1 tag after replace, got %d", n)
+	}
+
+	if err := tags.Remove(golang); err != nil {
+		t.Fatalf("Remove failed with error: %v", err)
+	}
+
+	tags.Append(golang, sql)
+	if err := tags.Clear(); err != nil {
+		t.Fatalf("Clear failed with error: %v", err)
+	}
+
+	if n, _ := tags.Count(); n != 0 {
+		t.Errorf("expected no tags after clear, got %d", n)
+	}
+
+	// tags are unlinked, not deleted
+	ormtest.AssertCount[Tag](t, db, 2)
+}
+
+func TestAssociationKinds(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Author{}, &Bio{}, &Tag{}, &Story{}, &Post{}, &Comment{})
+	dborm := orm.New(db)
+
+	// belongs to
+	story := &Story{Title: "Generics"}
+	dborm.Insert(story)
+
+	author := orm.Association{DB: db, Model: story, Name: "Author"}
+	if err := author.Replace(&Author{Name: "Rob"}); err != nil {
+		t.Fatalf("Replace failed with error: %v", err)
+	}
+
+	stored := &Story{}
+	dborm.First(stored, story.ID, orm.Preload{Query: "Author"})
+	if stored.Author == nil || stored.Author.Name != "Rob" {
+		t.Errorf("expected author Rob, got %+v", stored.Author)
+	}
+
+	// has one
+	bio := orm.Association{DB: db, Model: stored.Author, Name: "Bio"}
+	if err := bio.Append(&Bio{Text: "Gopher"}); err != nil {
+		t.Fatalf("Append failed with error: %v", err)
+	}
+
+	if n, err := bio.Count(); n != 1 || err != nil {
+		t.Errorf("expected 1 bio, got %d, err: %v", n, err)
+	}
+
+	// has many
+	post := &Post{Title: "Hello"}
+	dborm.Insert(post)
+
+	comments := orm.Association{DB: db, Model: post, Name: "Comments"}
+	if err := comments.Append(&Comment{}, &Comment{}); err != nil {
+		t.Fatalf("Append failed with error: %v", err)
+	}
+
+	if n, _ := comments.Count(); n != 2 {
+		t.Errorf("expected 2 comments, got %d", n)
+	}
+
+	if err := (orm.Association{DB: db, Model: post, Name: "Title"}).Clear(); !errors.Is(err, orm.ErrNotAssociation) {
+		t.Errorf("expected ErrNotAssociation, got %v", err)
+	}
+
+	if err := (orm.Association{DB: db, Model: &Post{}, Name: "Comments"}).Clear(); !errors.Is(err, gorm.ErrPrimaryKeyRequired) {
+		t.Errorf("expected ErrPrimaryKeyRequired, got %v", err)
+	}
+}
@@ -0,0 +1,639 @@
+package orm
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// Restore into a table that already has records
+	ErrDatabaseNotEmpty = errors.New("database is not empty")
+
+	// The backup file to write already exists
+	ErrBackupExists = errors.New("backup file already exists")
+)
+
+// BackupSQLite writes a consistent snapshot of a sqlite database to path
+// with VACUUM INTO. It is safe to run while the database is in use,
+// including in WAL mode. path must not exist.
+//
+// The snapshot is a regular database file that can be opened with ConnectToSqlite3.
+func BackupSQLite(ctx context.Context, db *gorm.DB, path string) error {
+	if db.Dialector.Name() != "sqlite" {
+		return fmt.Errorf("backup: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("backup: %w: %s", ErrBackupExists, path)
+	}
+
+	return db.WithContext(ctx).Exec("VACUUM INTO ?", path).Error
+}
+
+// Format of a logical dump
+type DumpFormat int
+
+const (
+	// Line delimited JSON. A header object per table is followed
+	// by an array of values per row.
+	DumpJSON DumpFormat = iota
+
+	// INSERT statements
+	DumpSQL
+)
+
+// DumpOptions configure Dump.
+type DumpOptions struct {
+	// Format of the dump, defaults to DumpJSON
+	Format DumpFormat
+
+	// Tables to dump in order. Defaults to all tables.
+	// Restore inserts the tables in the same order, so parent tables
+	// must come before the tables referencing them on postgres.
+	Tables []string
+}
+
+// layout of times in dumps, understood by sqlite and postgres
+const dumpTimeLayout = "2006-01-02 15:04:05.999999999-07:00"
+
+// header of a table in a json dump
+type dumpTable struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+	Types   []string `json:"types"`
+}
+
+// Dump writes a gzip compressed logical dump of the tables of db to w.
+// Dumps are driver neutral and can be restored into sqlite or postgres
+// with Restore.
+//
+// All tables are read in one read-only transaction so that the dump is
+// a consistent snapshot, with REPEATABLE READ isolation on postgres.
+func Dump(ctx context.Context, db *gorm.DB, w io.Writer, opts DumpOptions) error {
+	txOpts := &sql.TxOptions{ReadOnly: true}
+	if db.Dialector.Name() == "postgres" {
+		txOpts.Isolation = sql.LevelRepeatableRead
+	}
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		tables := opts.Tables
+		if len(tables) == 0 {
+			var err error
+			if tables, err = userTables(tx); err != nil {
+				return err
+			}
+		}
+
+		for _, table := range tables {
+			if err := dumpTableRows(tx, bw, table, opts.Format); err != nil {
+				return fmt.Errorf("dump %s: %w", table, err)
+			}
+		}
+		return nil
+	}, txOpts)
+
+	if err != nil {
+		return err
+	}
+
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// returns the tables of db excluding internal sqlite tables
+func userTables(db *gorm.DB) ([]string, error) {
+	all, err := db.Migrator().GetTables()
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]string, 0, len(all))
+	for _, table := range all {
+		if !strings.HasPrefix(table, "sqlite_") {
+			tables = append(tables, table)
+		}
+	}
+	return tables, nil
+}
+
+func dumpTableRows(db *gorm.DB, w *bufio.Writer, table string, format DumpFormat) error {
+	rows, err := db.Table(table).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return err
+	}
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return err
+	}
+
+	types := make([]string, len(columnTypes))
+	for i, ct := range columnTypes {
+		types[i] = strings.ToLower(ct.DatabaseTypeName())
+	}
+
+	if format == DumpJSON {
+		header, err := json.Marshal(dumpTable{Table: table, Columns: columns, Types: types})
+		if err != nil {
+			return err
+		}
+		w.Write(header)
+		w.WriteByte('\n')
+	} else {
+		fmt.Fprintf(w, "-- table: %s\n", table)
+	}
+
+	values := make([]any, len(columns))
+	ptrs := make([]any, len(columns))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return err
+		}
+
+		if format == DumpJSON {
+			err = writeJSONRow(w, values)
+		} else {
+			err = writeInsert(w, table, columns, values)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func writeJSONRow(w *bufio.Writer, values []any) error {
+	row := make([]any, len(values))
+	for i, v := range values {
+		switch x := v.(type) {
+		case []byte:
+			row[i] = base64.StdEncoding.EncodeToString(x)
+		case time.Time:
+			row[i] = x.Format(dumpTimeLayout)
+		default:
+			row[i] = x
+		}
+	}
+
+	b, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	w.Write(b)
+	return w.WriteByte('\n')
+}
+
+func writeInsert(w *bufio.Writer, table string, columns []string, values []any) error {
+	w.WriteString("INSERT INTO ")
+	w.WriteString(quoteIdent(table))
+	w.WriteString(" (")
+	for i, column := range columns {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(quoteIdent(column))
+	}
+
+	w.WriteString(") VALUES (")
+	for i, v := range values {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		w.WriteString(sqlLiteral(v))
+	}
+	_, err := w.WriteString(");\n")
+	return err
+}
+
+func quoteIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// formats v as a literal understood by sqlite and postgres.
+// Blobs are written as hex literals, which postgres reads as bytea.
+func sqlLiteral(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return "NULL"
+	case bool:
+		if x {
+			return "TRUE"
+		}
+		return "FALSE"
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'g', -1, 64)
+	case time.Time:
+		return quoteLiteral(x.Format(dumpTimeLayout))
+	case []byte:
+		return "X'" + hex.EncodeToString(x) + "'"
+	case string:
+		return quoteLiteral(x)
+	}
+	return quoteLiteral(fmt.Sprint(v))
+}
+
+// Restore loads a dump written by Dump into db. The tables must have been
+// migrated and be empty, otherwise ErrDatabaseNotEmpty is returned.
+// All records are inserted in a single transaction.
+func Restore(ctx context.Context, db *gorm.DB, r io.Reader) error {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+	defer zr.Close()
+
+	br := bufio.NewReader(zr)
+	first, err := peekNonSpace(br)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if tx.Dialector.Name() == "sqlite" {
+			// foreign keys are checked on commit, so tables may be in any order
+			if err := tx.Exec("PRAGMA defer_foreign_keys = ON").Error; err != nil {
+				return err
+			}
+		}
+
+		var tables []string
+		if first == '{' {
+			tables, err = restoreJSON(tx, br)
+		} else {
+			tables, err = restoreSQL(tx, br)
+		}
+
+		if err != nil {
+			return fmt.Errorf("restore: %w", err)
+		}
+		return resetSequences(tx, tables)
+	})
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+
+		if !strings.ContainsRune(" \t\r\n", rune(b[0])) {
+			return b[0], nil
+		}
+		br.ReadByte()
+	}
+}
+
+// fails with ErrDatabaseNotEmpty if table has records
+func checkEmpty(tx *gorm.DB, table string) error {
+	var count int64
+	if err := tx.Table(table).Count(&count).Error; err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return fmt.Errorf("%w: %s has %d records", ErrDatabaseNotEmpty, table, count)
+	}
+	return nil
+}
+
+// batch size of inserts when restoring json dumps
+const restoreBatchSize = 100
+
+func restoreJSON(tx *gorm.DB, br *bufio.Reader) ([]string, error) {
+	var (
+		tables []string
+		header dumpTable
+		kinds  []string
+		batch  []map[string]any
+	)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := tx.Table(header.Table).Create(&batch).Error
+		batch = batch[:0]
+		return err
+	}
+
+	dec := json.NewDecoder(br)
+	dec.UseNumber()
+
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		if bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+
+			header = dumpTable{}
+			if err := json.Unmarshal(raw, &header); err != nil {
+				return nil, err
+			}
+
+			if err := checkEmpty(tx, header.Table); err != nil {
+				return nil, err
+			}
+
+			var err error
+			if kinds, err = targetKinds(tx, header); err != nil {
+				return nil, err
+			}
+			tables = append(tables, header.Table)
+			continue
+		}
+
+		if header.Table == "" {
+			return nil, errors.New("row before table header")
+		}
+
+		var values []any
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		if err := dec.Decode(&values); err != nil {
+			return nil, err
+		}
+
+		if len(values) != len(header.Columns) {
+			return nil, fmt.Errorf("%s: expected %d values, got %d", header.Table, len(header.Columns), len(values))
+		}
+
+		row := make(map[string]any, len(values))
+		for i, column := range header.Columns {
+			value, err := restoreValue(values[i], header.Types[i], kinds[i])
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", header.Table, column, err)
+			}
+			row[column] = value
+		}
+
+		batch = append(batch, row)
+		if len(batch) >= restoreBatchSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tables, flush()
+}
+
+// returns the kind (bool, blob, number or "") of the columns of the dump
+// in the target database so that values are converted between drivers.
+func targetKinds(tx *gorm.DB, header dumpTable) ([]string, error) {
+	columnTypes, err := tx.Migrator().ColumnTypes(header.Table)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]string, len(columnTypes))
+	for _, ct := range columnTypes {
+		byName[ct.Name()] = strings.ToLower(ct.DatabaseTypeName())
+	}
+
+	kinds := make([]string, len(header.Columns))
+	for i, column := range header.Columns {
+		typ, ok := byName[column]
+		if !ok {
+			return nil, fmt.Errorf("%s has no column %s", header.Table, column)
+		}
+		kinds[i] = columnKind(typ)
+	}
+	return kinds, nil
+}
+
+func columnKind(typ string) string {
+	switch {
+	case strings.Contains(typ, "bool"):
+		return "bool"
+	case strings.Contains(typ, "blob") || strings.Contains(typ, "bytea"):
+		return "blob"
+	case strings.Contains(typ, "int") || strings.Contains(typ, "real") ||
+		strings.Contains(typ, "numeric") || strings.Contains(typ, "decimal") ||
+		strings.Contains(typ, "double") || strings.Contains(typ, "float"):
+		return "number"
+	}
+	return ""
+}
+
+// converts a decoded json value of a column with the source type to
+// a value for a target column of kind.
+func restoreValue(v any, source, kind string) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	if s, ok := v.(string); ok && columnKind(source) == "blob" {
+		return base64.StdEncoding.DecodeString(s)
+	}
+
+	n, isNumber := v.(json.Number)
+	switch {
+	case kind == "bool" && isNumber:
+		return n.String() != "0", nil
+	case isNumber:
+		if i, err := n.Int64(); err == nil {
+			return i, nil
+		}
+		return n.Float64()
+	case kind == "number":
+		if b, ok := v.(bool); ok {
+			if b {
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return v, nil
+}
+
+func restoreSQL(tx *gorm.DB, br *bufio.Reader) ([]string, error) {
+	var tables []string
+	seen := make(map[string]bool)
+
+	for {
+		stmt, err := readStatement(br)
+		if err == io.EOF {
+			return tables, nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		table, ok := insertTable(stmt)
+		if !ok {
+			return nil, fmt.Errorf("unexpected statement %.40q", stmt)
+		}
+
+		if !seen[table] {
+			seen[table] = true
+			if err := checkEmpty(tx, table); err != nil {
+				return nil, err
+			}
+			tables = append(tables, table)
+		}
+
+		if tx.Dialector.Name() == "postgres" {
+			stmt = postgresBlobs(stmt)
+		}
+
+		if err := tx.Exec(stmt).Error; err != nil {
+			return nil, err
+		}
+	}
+}
+
+// reads the next statement terminated by a semicolon outside of quotes.
+// Comment lines between statements are skipped.
+func readStatement(br *bufio.Reader) (string, error) {
+	var sb strings.Builder
+	var quote rune
+
+	for {
+		r, _, err := br.ReadRune()
+		if err == io.EOF && strings.TrimSpace(sb.String()) != "" {
+			return "", io.ErrUnexpectedEOF
+		} else if err != nil {
+			return "", err
+		}
+
+		if quote == 0 && r == '-' && strings.TrimSpace(sb.String()) == "" {
+			if next, _ := br.Peek(1); len(next) == 1 && next[0] == '-' {
+				if _, err := br.ReadString('\n'); err != nil && err != io.EOF {
+					return "", err
+				}
+				sb.Reset()
+				continue
+			}
+		}
+
+		switch {
+		case quote != 0 && r == quote:
+			quote = 0
+		case quote == 0 && (r == '\'' || r == '"'):
+			quote = r
+		case quote == 0 && r == ';':
+			return strings.TrimSpace(sb.String()), nil
+		}
+		sb.WriteRune(r)
+	}
+}
+
+// returns the unquoted table of an INSERT statement
+func insertTable(stmt string) (string, bool) {
+	if !strings.HasPrefix(stmt, `INSERT INTO "`) {
+		return "", false
+	}
+
+	rest := strings.TrimPrefix(stmt, "INSERT INTO ")
+	end := 1
+	for end < len(rest) {
+		if rest[end] == '"' {
+			if end+1 < len(rest) && rest[end+1] == '"' {
+				end += 2
+				continue
+			}
+			return strings.ReplaceAll(rest[1:end], `""`, `"`), true
+		}
+		end++
+	}
+	return "", false
+}
+
+// rewrites X'..' blob literals outside of strings to bytea literals
+func postgresBlobs(stmt string) string {
+	var sb strings.Builder
+	inString := false
+
+	for i := 0; i < len(stmt); i++ {
+		c := stmt[i]
+		if c == '\'' {
+			inString = !inString
+		}
+
+		if !inString && c == 'X' && i+1 < len(stmt) && stmt[i+1] == '\'' && (i == 0 || stmt[i-1] == ' ' || stmt[i-1] == '(') {
+			end := strings.IndexByte(stmt[i+2:], '\'')
+			if end >= 0 {
+				sb.WriteString(`'\x` + stmt[i+2:i+2+end] + `'::bytea`)
+				i += end + 2
+				continue
+			}
+		}
+		sb.WriteByte(c)
+	}
+	return sb.String()
+}
+
+// sets the postgres sequences of restored tables past the restored ids
+func resetSequences(tx *gorm.DB, tables []string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	for _, table := range tables {
+		columnTypes, err := tx.Migrator().ColumnTypes(table)
+		if err != nil {
+			return err
+		}
+
+		for _, ct := range columnTypes {
+			var sequence sql.NullString
+			err := tx.Raw("SELECT pg_get_serial_sequence(?, ?)", table, ct.Name()).Scan(&sequence).Error
+			if err != nil {
+				return err
+			}
+
+			if !sequence.Valid {
+				continue
+			}
+
+			err = tx.Exec(fmt.Sprintf("SELECT setval(?, COALESCE(MAX(%s), 0) + 1, false) FROM %s",
+				quoteIdent(ct.Name()), quoteIdent(table)), sequence.String).Error
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
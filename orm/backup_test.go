@@ -0,0 +1,110 @@
+package orm_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+func TestBackupSQLite(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	db := orm.ConnectToSqlite3(filepath.Join(dir, "app.db"), true)
+	t.Cleanup(func() {
+		sqlDB, _ := db.DB()
+		sqlDB.Close()
+	})
+
+	db.AutoMigrate(&Post{})
+	db.Create(&[]Post{{Title: "first"}, {Title: "second"}})
+
+	ctx := context.Background()
+	path := filepath.Join(dir, "backup.db")
+	if err := orm.BackupSQLite(ctx, db, path); err != nil {
+		t.Fatalf("backup failed with error: %v", err)
+	}
+
+	// writes after the backup are not in the snapshot
+	db.Create(&Post{Title: "third"})
+
+	snapshot := orm.ConnectToSqlite3(path, false)
+	t.Cleanup(func() {
+		sqlDB, _ := snapshot.DB()
+		sqlDB.Close()
+	})
+	ormtest.AssertCount[Post](t, snapshot, 2)
+
+	if err := orm.BackupSQLite(ctx, db, path); !errors.Is(err, orm.ErrBackupExists) {
+		t.Errorf("expected ErrBackupExists, got %v", err)
+	}
+}
+
+func TestDumpRestore(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{}, &Customer{})
+
+	notes := "it's\nmultiline; with semicolons"
+	created := time.Date(2022, time.October, 1, 8, 30, 0, 0, time.UTC)
+	db.Create(&[]Post{{Title: "first", CreateAt: created}, {Title: "second", CreateAt: created}})
+	db.Create(&[]Comment{{PostID: 2, CreateAt: created}})
+	db.Create(&[]Customer{
+		{Name: "Alice", Email: sql.NullString{String: "alice@example.com", Valid: true}, Notes: &notes, CreatedAt: created},
+		{Name: "Bob", CreatedAt: created},
+	})
+
+	ctx := context.Background()
+	for _, format := range []orm.DumpFormat{orm.DumpJSON, orm.DumpSQL} {
+		buf := &bytes.Buffer{}
+		err := orm.Dump(ctx, db, buf, orm.DumpOptions{
+			Format: format,
+			Tables: []string{"comments", "customers", "posts"},
+		})
+
+		if err != nil {
+			t.Fatalf("dump %d failed with error: %v", format, err)
+		}
+
+		target := ormtest.NewDB(t, &Post{}, &Comment{}, &Customer{})
+		if err := orm.Restore(ctx, target, bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("restore %d failed with error: %v", format, err)
+		}
+
+		var posts, restoredPosts []Post
+		db.Order("id").Find(&posts)
+		target.Order("id").Find(&restoredPosts)
+		if !reflect.DeepEqual(posts, restoredPosts) {
+			t.Errorf("format %d: restored posts differ: %+v", format, restoredPosts)
+		}
+
+		var customers, restoredCustomers []Customer
+		db.Order("id").Find(&customers)
+		target.Order("id").Find(&restoredCustomers)
+		if !reflect.DeepEqual(customers, restoredCustomers) {
+			t.Errorf("format %d: restored customers differ: %+v", format, restoredCustomers)
+		}
+
+		ormtest.AssertExists[Comment](t, target, orm.Where{Query: "post_id = ?", Args: []any{2}})
+
+		// ids continue after the restored records
+		post := &Post{Title: "third"}
+		target.Create(post)
+		if post.ID != 3 {
+			t.Errorf("expected next id to be 3, got %d", post.ID)
+		}
+
+		err = orm.Restore(ctx, target, bytes.NewReader(buf.Bytes()))
+		if !errors.Is(err, orm.ErrDatabaseNotEmpty) {
+			t.Errorf("expected ErrDatabaseNotEmpty, got %v", err)
+		}
+	}
+}
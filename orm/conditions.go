@@ -54,6 +54,19 @@ func (g Group) Apply(db *gorm.DB) *gorm.DB {
 	return db.Group(g.Name)
 }
 
+// Filter groups of a grouped query. Use together with Group.
+type Having struct {
+	// having condition e.g "count(*) > ?"
+	Query string
+
+	// arguments to the query e.g []any{10}
+	Args []any
+}
+
+func (h Having) Apply(db *gorm.DB) *gorm.DB {
+	return db.Having(h.Query, h.Args...)
+}
+
 // Add grouping. Group should apear after Join but before Where conditions
 type Order struct {
 	Name string // grouping condition e.g "category DESC"
@@ -0,0 +1,369 @@
+package orm
+
+import (
+	"fmt"
+	"hash/fnv"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Struct tag key of the validation rules turned into constraints.
+var ValidateTagName = "validate"
+
+// Maximum number of primary keys listed by a Violation.
+var ViolationSampleSize = 10
+
+// Kind of database constraint.
+type ConstraintKind string
+
+const (
+	ConstraintNotNull ConstraintKind = "not null"
+	ConstraintCheck   ConstraintKind = "check"
+	ConstraintUnique  ConstraintKind = "unique"
+)
+
+// Constraint is a rule enforced by the database on a column.
+type Constraint struct {
+	Name   string // e.g ck_users_name_max
+	Table  string
+	Column string
+	Kind   ConstraintKind
+
+	// condition satisfied by valid rows, empty for unique constraints
+	// e.g char_length("name") <= 255
+	Check string
+
+	// rule it is derived from e.g max=255 or unique
+	Rule string
+}
+
+// Violation lists the rows of a table breaking a constraint.
+type Violation struct {
+	Constraint Constraint
+	Rows       int64 // number of rows breaking the constraint
+	Keys       []any // primary keys of the first rows, see ViolationSampleSize
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %d rows break %s (%s) on %s, e.g %v",
+		v.Constraint.Table, v.Rows, v.Constraint.Name, v.Constraint.Rule, v.Constraint.Column, v.Keys)
+}
+
+/*
+Constraints returns the constraints derived from the validation rules of
+model, without changing the database.
+
+	type User struct {
+		ID    uint
+		Name  string  `validate:"required,max=255"`
+		Role  string  `validate:"oneof=admin staff"`
+		Age   int     `validate:"omitempty,gte=18,lte=130"`
+		Email *string `orm:"unique"`
+	}
+
+Supported rules are required (NOT NULL, and not empty or zero for strings
+and numbers), min, max, len, gt, gte, lt, lte and oneof. Lengths of
+strings and values of numbers are checked. Rules after omitempty allow
+empty values, rules after dive and alternatives with | are skipped.
+
+Since the unique rule of the validator applies to slices, unique columns
+are tagged with `orm:"unique"`.
+*/
+func Constraints(db *gorm.DB, model any) ([]Constraint, error) {
+	s, err := parseSchema(db, model)
+	if err != nil {
+		return nil, err
+	}
+	return constraintsOf(db, s, "")
+}
+
+/*
+MigrateConstraints adds the constraints of each model to the database.
+
+On postgres, columns are set NOT NULL and CHECK constraints are added. On
+sqlite, whose tables can't be altered, BEFORE INSERT and BEFORE UPDATE
+triggers abort writes breaking them. Unique indexes are created on both.
+
+Run it after AutoMigrate. It may be run again after rules change, but
+constraints of removed rules are kept. Postgres refuses constraints that
+existing rows break, list them first with ConstraintViolations.
+*/
+func MigrateConstraints(db *gorm.DB, models ...any) error {
+	for _, model := range models {
+		s, err := parseSchema(db, model)
+		if err != nil {
+			return err
+		}
+
+		var statements []string
+		switch db.Dialector.Name() {
+		case "postgres":
+			statements, err = postgresConstraintDDL(db, s)
+		case "sqlite":
+			statements, err = sqliteConstraintDDL(db, s)
+		default:
+			return fmt.Errorf("constraints: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+		}
+
+		if err != nil {
+			return err
+		}
+
+		err = Transaction(db, func(tx *gorm.DB) error {
+			for _, sql := range statements {
+				if err := tx.Exec(sql).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("constraints of %s: %w", s.Table, err)
+		}
+	}
+	return nil
+}
+
+/*
+ConstraintViolations reports the rows of each model breaking the
+constraints MigrateConstraints would add. Rows are not changed.
+
+	violations, err := orm.ConstraintViolations(db, &User{})
+	for _, v := range violations {
+		fmt.Println(v) // users: 2 rows break ck_users_name_max (max=255) on name, e.g [4 9]
+	}
+*/
+func ConstraintViolations(db *gorm.DB, models ...any) ([]Violation, error) {
+	var violations []Violation
+	for _, model := range models {
+		s, err := parseSchema(db, model)
+		if err != nil {
+			return nil, err
+		}
+
+		constraints, err := constraintsOf(db, s, "")
+		if err != nil {
+			return nil, err
+		}
+
+		table := db.Statement.Quote(s.Table)
+		for _, c := range constraints {
+			where := "NOT (" + c.Check + ")"
+			if c.Kind == ConstraintUnique {
+				column := db.Statement.Quote(c.Column)
+				where = fmt.Sprintf("%s IN (SELECT %s FROM %s GROUP BY %s HAVING count(*) > 1)",
+					column, column, table, column)
+			}
+
+			v := Violation{Constraint: c}
+			if err := db.Table(s.Table).Where(where).Count(&v.Rows).Error; err != nil {
+				return nil, err
+			}
+
+			if v.Rows == 0 {
+				continue
+			}
+
+			if pk := s.PrioritizedPrimaryField; pk != nil {
+				err := db.Table(s.Table).Where(where).Order(pk.DBName).
+					Limit(ViolationSampleSize).Pluck(pk.DBName, &v.Keys).Error
+				if err != nil {
+					return nil, err
+				}
+			}
+			violations = append(violations, v)
+		}
+	}
+	return violations, nil
+}
+
+// matches the values of oneof rules, which may be quoted
+var oneofValues = regexp.MustCompile(`'[^']*'|\S+`)
+
+// postgres truncates longer identifiers
+const maxIdentifierLength = 63
+
+// returns <kind>_<table>_<column>_<rule>. Names longer than postgres
+// allows are cut and end with a hash of the full name to stay unique.
+func constraintName(kind, table, column, rule string) string {
+	name := fmt.Sprintf("%s_%s_%s_%s", kind, table, column, rule)
+	if len(name) <= maxIdentifierLength {
+		return name
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	suffix := fmt.Sprintf("_%08x", h.Sum32())
+	return name[:maxIdentifierLength-len(suffix)] + suffix
+}
+
+// returns the constraints of s, with columns qualified by prefix e.g NEW.
+func constraintsOf(db *gorm.DB, s *schema.Schema, prefix string) ([]Constraint, error) {
+	length := "char_length"
+	if db.Dialector.Name() == "sqlite" {
+		length = "length"
+	}
+
+	var constraints []Constraint
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		column := prefix + db.Statement.Quote(field.DBName)
+		add := func(kind ConstraintKind, rule, check string) {
+			name := strings.SplitN(rule, "=", 2)[0]
+			short := map[ConstraintKind]string{ConstraintNotNull: "nn", ConstraintCheck: "ck", ConstraintUnique: "uq"}[kind]
+			constraints = append(constraints, Constraint{
+				Name:   constraintName(short, s.Table, field.DBName, name),
+				Table:  s.Table,
+				Column: field.DBName,
+				Kind:   kind,
+				Check:  check,
+				Rule:   rule,
+			})
+		}
+
+		if hasTagOption(field, "unique") {
+			add(ConstraintUnique, "unique", "")
+		}
+
+		kind := field.FieldType.Kind()
+		if kind == reflect.Pointer {
+			kind = field.FieldType.Elem().Kind()
+		}
+
+		// the value checked by size rules and the zero value
+		var size, zero string
+		switch kind {
+		case reflect.String:
+			size, zero = length+"("+column+")", "''"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			size, zero = column, "0"
+		}
+
+		omitempty := false
+		for _, rule := range strings.Split(field.Tag.Get(ValidateTagName), ",") {
+			rule = strings.TrimSpace(rule)
+			if rule == "dive" {
+				break
+			}
+
+			if strings.Contains(rule, "|") {
+				continue
+			}
+
+			name, param, _ := strings.Cut(rule, "=")
+			var check string
+			switch name {
+			case "omitempty":
+				omitempty = true
+				continue
+			case "required":
+				add(ConstraintNotNull, rule, column+" IS NOT NULL")
+				if zero != "" {
+					add(ConstraintCheck, rule, column+" <> "+zero)
+				}
+				continue
+			case "min", "max", "len", "gt", "gte", "lt", "lte":
+				if size == "" {
+					continue
+				}
+
+				n, err := strconv.ParseFloat(param, 64)
+				if err != nil {
+					return nil, fmt.Errorf("constraints: invalid rule %q of %s.%s", rule, s.Name, field.Name)
+				}
+
+				op := map[string]string{"min": ">=", "max": "<=", "len": "=", "gt": ">", "gte": ">=", "lt": "<", "lte": "<="}[name]
+				check = size + " " + op + " " + strconv.FormatFloat(n, 'f', -1, 64)
+			case "oneof":
+				if zero == "" {
+					continue
+				}
+
+				var values []string
+				for _, value := range oneofValues.FindAllString(param, -1) {
+					value = strings.Trim(value, "'")
+					if kind == reflect.String {
+						value = "'" + strings.ReplaceAll(value, "'", "''") + "'"
+					} else if _, err := strconv.ParseFloat(value, 64); err != nil {
+						return nil, fmt.Errorf("constraints: invalid rule %q of %s.%s", rule, s.Name, field.Name)
+					}
+					values = append(values, value)
+				}
+				check = column + " IN (" + strings.Join(values, ", ") + ")"
+			default:
+				continue
+			}
+
+			if omitempty {
+				check = column + " = " + zero + " OR " + check
+			}
+			add(ConstraintCheck, rule, check)
+		}
+	}
+	return constraints, nil
+}
+
+func postgresConstraintDDL(db *gorm.DB, s *schema.Schema) ([]string, error) {
+	constraints, err := constraintsOf(db, s, "")
+	if err != nil {
+		return nil, err
+	}
+
+	table := db.Statement.Quote(s.Table)
+	var statements []string
+	for _, c := range constraints {
+		name := db.Statement.Quote(c.Name)
+		switch c.Kind {
+		case ConstraintNotNull:
+			statements = append(statements, fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET NOT NULL",
+				table, db.Statement.Quote(c.Column)))
+		case ConstraintCheck:
+			statements = append(statements,
+				fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT IF EXISTS %s", table, name),
+				fmt.Sprintf("ALTER TABLE %s ADD CONSTRAINT %s CHECK (%s)", table, name, c.Check))
+		case ConstraintUnique:
+			statements = append(statements, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+				name, table, db.Statement.Quote(c.Column)))
+		}
+	}
+	return statements, nil
+}
+
+func sqliteConstraintDDL(db *gorm.DB, s *schema.Schema) ([]string, error) {
+	// triggers check the new values of rows
+	constraints, err := constraintsOf(db, s, "NEW.")
+	if err != nil {
+		return nil, err
+	}
+
+	table := db.Statement.Quote(s.Table)
+	var statements []string
+	for _, c := range constraints {
+		if c.Kind == ConstraintUnique {
+			statements = append(statements, fmt.Sprintf("CREATE UNIQUE INDEX IF NOT EXISTS %s ON %s (%s)",
+				db.Statement.Quote(c.Name), table, db.Statement.Quote(c.Column)))
+			continue
+		}
+
+		message := strings.ReplaceAll("CHECK constraint failed: "+c.Name, "'", "''")
+		for _, event := range []string{"INSERT", "UPDATE OF " + db.Statement.Quote(c.Column)} {
+			trigger := db.Statement.Quote(c.Name + "_" + strings.ToLower(strings.Fields(event)[0]))
+			statements = append(statements,
+				fmt.Sprintf("DROP TRIGGER IF EXISTS %s", trigger),
+				fmt.Sprintf("CREATE TRIGGER %s BEFORE %s ON %s FOR EACH ROW WHEN NOT (%s) "+
+					"BEGIN SELECT RAISE(ABORT, '%s'); END", trigger, event, table, c.Check, message))
+		}
+	}
+	return statements, nil
+}
@@ -0,0 +1,158 @@
+package orm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type Member struct {
+	ID    uint
+	Name  string  `validate:"required,max=5"`
+	Role  string  `validate:"oneof=admin 'staff member'"`
+	Age   int     `validate:"omitempty,gte=18,lte=130"`
+	Email *string `orm:"unique"`
+	Tags  string  `validate:"omitempty,alpha|numeric"`
+}
+
+func TestConstraintViolations(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Member{})
+	email := "a@b.c"
+	members := []Member{
+		{Name: "ann", Role: "admin", Age: 30, Email: &email},
+		{Name: "bartholomew", Role: "admin", Email: &email},
+		{Name: "", Role: "guest", Age: 12},
+	}
+	orm.New(db).InsertMany(&members, 10)
+
+	violations, err := orm.ConstraintViolations(db, &Member{})
+	if err != nil {
+		t.Fatalf("ConstraintViolations failed with error: %v", err)
+	}
+
+	got := make(map[string]int64)
+	for _, v := range violations {
+		got[v.Constraint.Name] = v.Rows
+	}
+
+	want := map[string]int64{
+		"ck_members_name_required": 1,
+		"ck_members_name_max":      1,
+		"ck_members_role_oneof":    1,
+		"ck_members_age_gte":       1,
+		"uq_members_email_unique":  2,
+	}
+
+	if len(got) != len(want) {
+		t.Errorf("expected violations %v, got %v", want, violations)
+	}
+
+	for name, rows := range want {
+		if got[name] != rows {
+			t.Errorf("expected %d rows breaking %s, got %d", rows, name, got[name])
+		}
+	}
+
+	if s := violations[0].String(); !strings.Contains(s, "members: 1 rows break") {
+		t.Errorf("unexpected violation %q", s)
+	}
+
+	// the migration succeeds on sqlite but triggers check new rows
+	db.Where("1 = 1").Delete(&Member{})
+	if err := orm.MigrateConstraints(db, &Member{}); err != nil {
+		t.Fatalf("MigrateConstraints failed with error: %v", err)
+	}
+
+	if err := orm.MigrateConstraints(db, &Member{}); err != nil {
+		t.Fatalf("MigrateConstraints is not idempotent, got error: %v", err)
+	}
+
+	dborm := orm.New(db)
+	valid := &Member{Name: "ann", Role: "staff member", Email: &email}
+	if err := dborm.Insert(valid); err != nil {
+		t.Fatalf("valid member not inserted: %v", err)
+	}
+
+	for _, m := range []*Member{
+		{Name: "bartholomew", Role: "admin"},
+		{Name: "bob", Role: "admin", Age: 12},
+		{Name: "bob", Role: "guest"},
+		{Name: "bob", Role: "admin", Email: &email},
+	} {
+		if err := dborm.Insert(m); err == nil {
+			t.Errorf("expected invalid member %+v to be rejected", m)
+		}
+	}
+
+	err = dborm.PartialUpdate(valid, map[string]any{"name": ""}, orm.Where{})
+	if err == nil || !strings.Contains(err.Error(), "ck_members_name_required") {
+		t.Errorf("expected update to break ck_members_name_required, got %v", err)
+	}
+}
+
+func TestConstraintsPostgres(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constraints, err := orm.Constraints(db, &Member{})
+	if err != nil {
+		t.Fatalf("Constraints failed with error: %v", err)
+	}
+
+	want := []string{
+		`"name" IS NOT NULL`,
+		`"name" <> ''`,
+		`char_length("name") <= 5`,
+		`"role" IN ('admin', 'staff member')`,
+		`"age" = 0 OR "age" >= 18`,
+		`"age" = 0 OR "age" <= 130`,
+		``,
+	}
+
+	if len(constraints) != len(want) {
+		t.Fatalf("expected %d constraints, got %+v", len(want), constraints)
+	}
+
+	for i, c := range constraints {
+		if c.Check != want[i] {
+			t.Errorf("expected check %q, got %q", want[i], c.Check)
+		}
+	}
+
+	if c := constraints[6]; c.Kind != orm.ConstraintUnique || c.Column != "email" {
+		t.Errorf("expected unique email constraint, got %+v", c)
+	}
+
+	// names fit the 63 bytes of postgres identifiers and stay unique
+	constraints, err = orm.Constraints(db, &MembershipApplicationReview{})
+	if err != nil {
+		t.Fatalf("Constraints failed with error: %v", err)
+	}
+
+	names := make(map[string]bool)
+	for _, c := range constraints {
+		if len(c.Name) > 63 || names[c.Name] {
+			t.Errorf("constraint name %q is too long or not unique", c.Name)
+		}
+		names[c.Name] = true
+	}
+
+	if len(names) != 3 {
+		t.Errorf("expected 3 constraints, got %+v", constraints)
+	}
+}
+
+type MembershipApplicationReview struct {
+	ID                              uint
+	ReviewerCommentsForTheApplicant string `validate:"required,max=500"`
+}
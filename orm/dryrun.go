@@ -0,0 +1,121 @@
+package orm
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Statement is a SQL statement generated in dry run mode.
+type Statement struct {
+	SQL  string // SQL with placeholders of the dialect
+	Vars []any  // arguments bound to the placeholders
+
+	explained string
+}
+
+// String returns the SQL with the arguments interpolated.
+// Use it for debugging only; it is not safe to execute.
+func (s Statement) String() string {
+	return s.explained
+}
+
+// records the statements of a ToSQL session. The dialector records the
+// SQL and arguments of a statement when gorm explains it for the logger,
+// and the logger appends it once the statement has run.
+type sqlRecorder struct {
+	mu         sync.Mutex
+	pending    map[string]Statement // by explained SQL
+	statements []Statement
+}
+
+/*
+ToSQL returns the statements that fn would execute with tx, without
+executing anything. tx is a dry run session of db. Reads and writes made
+through the ORM, Paginate and the other helpers of this package are
+recorded in order.
+
+	statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+		var posts []Post
+		return orm.New(tx).FindAll(&posts, orm.Where{Query: "title LIKE ?", Args: []any{"%go%"}})
+	})
+	fmt.Println(statements[0].SQL, statements[0].Vars)
+	fmt.Println(statements[0]) // SELECT * FROM "posts" WHERE title LIKE '%go%'
+
+Since nothing is executed, queries return no records and fn should not
+depend on their results. The statements are recorded by the session only:
+no callbacks are registered on db.
+*/
+func ToSQL(db *gorm.DB, fn func(tx *gorm.DB) error) ([]Statement, error) {
+	rec := &sqlRecorder{pending: make(map[string]Statement)}
+
+	// without a default transaction, the database is not touched at all
+	tx := db.Session(&gorm.Session{
+		DryRun:                 true,
+		SkipDefaultTransaction: true,
+		Logger:                 &recordingLogger{Interface: db.Logger, rec: rec},
+	})
+
+	// the session has its own copy of the config
+	tx.Config.Dialector = &recordingDialector{Dialector: db.Dialector, rec: rec}
+	if err := fn(tx); err != nil {
+		return nil, err
+	}
+	return rec.statements, nil
+}
+
+// recordingDialector keeps the statements explained by the wrapped dialector.
+type recordingDialector struct {
+	gorm.Dialector
+	rec *sqlRecorder
+}
+
+func (d *recordingDialector) Explain(sql string, vars ...any) string {
+	explained := d.Dialector.Explain(sql, vars...)
+
+	d.rec.mu.Lock()
+	d.rec.pending[explained] = Statement{SQL: sql, Vars: append([]any(nil), vars...), explained: explained}
+	d.rec.mu.Unlock()
+	return explained
+}
+
+func (d *recordingDialector) SavePoint(tx *gorm.DB, name string) error {
+	if sp, ok := d.Dialector.(gorm.SavePointerDialectorInterface); ok {
+		return sp.SavePoint(tx, name)
+	}
+	return gorm.ErrUnsupportedDriver
+}
+
+func (d *recordingDialector) RollbackTo(tx *gorm.DB, name string) error {
+	if sp, ok := d.Dialector.(gorm.SavePointerDialectorInterface); ok {
+		return sp.RollbackTo(tx, name)
+	}
+	return gorm.ErrUnsupportedDriver
+}
+
+// recordingLogger appends the statements traced by gorm to the recorder
+// and passes them on to the logger of the database.
+type recordingLogger struct {
+	logger.Interface
+	rec *sqlRecorder
+}
+
+func (l *recordingLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return &recordingLogger{Interface: l.Interface.LogMode(level), rec: l.rec}
+}
+
+func (l *recordingLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	explained, rows := fc()
+
+	l.rec.mu.Lock()
+	if stmt, ok := l.rec.pending[explained]; ok {
+		delete(l.rec.pending, explained)
+		l.rec.statements = append(l.rec.statements, stmt)
+	}
+	l.rec.mu.Unlock()
+
+	l.Interface.Trace(ctx, begin, func() (string, int64) { return explained, rows }, err)
+}
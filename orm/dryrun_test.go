@@ -0,0 +1,151 @@
+package orm_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestToSQL(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
+
+	statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+		var posts []Post
+		err := orm.New(tx).FindAll(&posts,
+			orm.Join{Query: "JOIN comments ON comments.post_id = posts.id"},
+			orm.Where{Query: "posts.title LIKE ?", Args: []any{"%go%"}},
+			orm.Group{Name: "posts.id"},
+			orm.Having{Query: "COUNT(comments.id) > ?", Args: []any{2}},
+			orm.Order{Name: "posts.id DESC"},
+			orm.Limit{L: 10, O: 20},
+		)
+		if err != nil {
+			return err
+		}
+
+		_, err = orm.Paginate(&Post{}, 2, 10, tx, orm.Where{Query: "id > ?", Args: []any{5}})
+		return err
+	})
+
+	if err != nil {
+		t.Fatalf("ToSQL failed with error: %v", err)
+	}
+
+	if len(statements) != 3 {
+		t.Fatalf("expected 3 statements, got %d: %v", len(statements), statements)
+	}
+
+	want := "SELECT `posts`.`id`,`posts`.`title`,`posts`.`create_at` FROM `posts` " +
+		"JOIN comments ON comments.post_id = posts.id WHERE posts.title LIKE ? " +
+		"GROUP BY `posts`.`id` HAVING COUNT(comments.id) > ? ORDER BY posts.id DESC LIMIT 10 OFFSET 20"
+
+	if statements[0].SQL != want {
+		t.Errorf("unexpected SQL:\n%s", statements[0].SQL)
+	}
+
+	if !reflect.DeepEqual(statements[0].Vars, []any{"%go%", 2}) {
+		t.Errorf("unexpected vars: %v", statements[0].Vars)
+	}
+
+	if !strings.Contains(statements[0].String(), `LIKE "%go%"`) {
+		t.Errorf("expected interpolated args, got %s", statements[0])
+	}
+
+	if !strings.HasPrefix(statements[1].SQL, "SELECT count(*) FROM `posts`") ||
+		!strings.HasSuffix(statements[2].SQL, "WHERE id > ? LIMIT 10 OFFSET 10") {
+		t.Errorf("unexpected Paginate statements: %v", statements[1:])
+	}
+
+	// writes are not executed
+	statements, err = orm.ToSQL(db, func(tx *gorm.DB) error {
+		dborm := orm.New(tx)
+		post := &Post{ID: 1, Title: "dry"}
+		if err := dborm.Insert(post); err != nil {
+			return err
+		}
+
+		if err := dborm.PartialUpdate(post, Post{Title: "wet"}, orm.Where{}); err != nil {
+			return err
+		}
+		return dborm.Delete(post)
+	})
+
+	if err != nil {
+		t.Fatalf("ToSQL of writes failed with error: %v", err)
+	}
+
+	if len(statements) != 3 || !strings.HasPrefix(statements[0].SQL, "INSERT INTO `posts`") ||
+		!strings.HasPrefix(statements[1].SQL, "UPDATE `posts` SET `title`=?") ||
+		!strings.HasPrefix(statements[2].SQL, "DELETE FROM `posts`") {
+		t.Errorf("unexpected write statements: %v", statements)
+	}
+
+	ormtest.AssertCount[Post](t, db, 0)
+
+	// db is left as it was and concurrent previews don't mix statements
+	dialector := reflect.TypeOf(db.Dialector)
+	var wg sync.WaitGroup
+	for i := 1; i <= 4; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+
+			statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+				return orm.New(tx).FindAll(&[]Post{}, orm.Where{Query: "id = ?", Args: []any{id}})
+			})
+
+			if err != nil || len(statements) != 1 || statements[0].Vars[0] != id {
+				t.Errorf("unexpected statements %v, error %v", statements, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if reflect.TypeOf(db.Dialector) != dialector {
+		t.Errorf("ToSQL changed the dialector of db to %T", db.Dialector)
+	}
+}
+
+func TestToSQLPostgres(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+		if err := orm.New(tx).Insert(&Post{Title: "hello"}); err != nil {
+			return err
+		}
+		return orm.New(tx).First(&Post{}, 7, orm.Select{Fields: []any{"id", "title"}})
+	})
+
+	if err != nil {
+		t.Fatalf("ToSQL failed with error: %v", err)
+	}
+
+	if len(statements) != 2 {
+		t.Fatalf("expected 2 statements, got %v", statements)
+	}
+
+	if want := `INSERT INTO "posts" ("title","create_at") VALUES ($1,$2) RETURNING "id"`; statements[0].SQL != want {
+		t.Errorf("unexpected insert SQL: %s", statements[0].SQL)
+	}
+
+	want := `SELECT "id","title" FROM "posts" WHERE "posts"."id" = 7 ORDER BY "posts"."id" LIMIT 1`
+	if statements[1].String() != want {
+		t.Errorf("unexpected query: %s", statements[1])
+	}
+}
@@ -0,0 +1,643 @@
+package orm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sync"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// A model with subscribers was written in a transaction that was not
+// started by Bus.Transaction, whose commit the bus can't observe.
+var ErrUnobservedTransaction = errors.New("transaction not started by Bus.Transaction")
+
+// Kind of change of a model
+type EventType int
+
+const (
+	Created EventType = iota + 1
+	Updated
+	Deleted
+)
+
+func (t EventType) String() string {
+	switch t {
+	case Created:
+		return "created"
+	case Updated:
+		return "updated"
+	case Deleted:
+		return "deleted"
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event describes a committed change of a record of T.
+type Event[T any] struct {
+	Type  EventType
+	Table string // table of the model
+	Old   *T     // value before the change, nil for Created
+	New   *T     // value after the change, nil for Deleted
+}
+
+// BusOptions configure an event bus.
+type BusOptions struct {
+	// Number of goroutines delivering events.
+	// Zero delivers events synchronously after the write.
+	Workers int
+
+	// Capacity of the queue of asynchronous deliveries.
+	// Publishing blocks when the queue is full.
+	QueueSize int
+
+	// Called with the recovered value when a subscriber panics.
+	// The panic is logged by default.
+	OnPanic func(recovered any)
+}
+
+/*
+Bus publishes typed events for records created, updated and deleted
+through a gorm.DB, after the transaction of the write commits.
+
+	bus := orm.NewBus(orm.BusOptions{Workers: 4})
+	bus.Register(db)
+	defer bus.Close()
+
+	orm.Subscribe(bus, func(e orm.Event[Post]) {
+		if e.Type == orm.Created {
+			sendNewPostEmail(e.New)
+		}
+	})
+
+Writes outside of a transaction, or in gorm's default transaction, are
+published once the statement completes. Use Bus.Transaction or Transaction
+for explicit transactions: their events are held back until they commit and
+dropped if they roll back. The helpers of this package, e.g InsertMany,
+Importer and Association, do the same. Since gorm has no commit hook,
+writes of models that have subscribers fail with ErrUnobservedTransaction
+in other transactions, e.g those of db.Transaction.
+
+Old values are loaded before updates and deletes, and new values after
+updates, only for models that have subscribers. Records that already
+existed when upserted, e.g associations saved with their owner, are not
+published as created.
+*/
+type Bus struct {
+	opts BusOptions
+
+	mu       sync.RWMutex
+	handlers map[reflect.Type][]*subscriber
+	closed   bool
+
+	jobs    chan func()
+	wg      sync.WaitGroup // workers
+	sending sync.WaitGroup // publishers sending to jobs
+}
+
+type subscriber struct {
+	deliver func(e change)
+}
+
+// an untyped event
+type change struct {
+	bus      *Bus // publishes the change
+	typ      EventType
+	model    reflect.Type
+	table    string
+	old, new reflect.Value // struct values, invalid if absent
+}
+
+// NewBus returns a bus with the given options. Call Register to publish
+// the events of a database.
+func NewBus(opts BusOptions) *Bus {
+	b := &Bus{opts: opts, handlers: make(map[reflect.Type][]*subscriber)}
+
+	if opts.Workers > 0 {
+		b.jobs = make(chan func(), opts.QueueSize)
+		for i := 0; i < opts.Workers; i++ {
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				for job := range b.jobs {
+					job()
+				}
+			}()
+		}
+	}
+	return b
+}
+
+// Subscribe registers fn for the events of model T.
+// Call the returned function to unsubscribe.
+func Subscribe[T any](b *Bus, fn func(Event[T])) (unsubscribe func()) {
+	modelType := reflect.TypeOf((*T)(nil)).Elem()
+	sub := &subscriber{
+		deliver: func(c change) {
+			e := Event[T]{Type: c.typ, Table: c.table}
+			if c.old.IsValid() {
+				old := c.old.Interface().(T)
+				e.Old = &old
+			}
+
+			if c.new.IsValid() {
+				v := c.new.Interface().(T)
+				e.New = &v
+			}
+			fn(e)
+		},
+	}
+
+	b.mu.Lock()
+	b.handlers[modelType] = append(b.handlers[modelType], sub)
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		subs := b.handlers[modelType]
+		for i, s := range subs {
+			if s == sub {
+				b.handlers[modelType] = append(subs[:i:i], subs[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// returns true if there are subscribers for the model type
+func (b *Bus) subscribed(modelType reflect.Type) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.handlers[modelType]) > 0
+}
+
+// Close waits for queued asynchronous deliveries. Events published
+// after Close are delivered synchronously.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	if b.jobs != nil {
+		b.sending.Wait()
+		close(b.jobs)
+		b.wg.Wait()
+	}
+}
+
+// delivers changes to their subscribers
+func (b *Bus) publish(changes []change) {
+	for _, c := range changes {
+		b.mu.RLock()
+		subs := append([]*subscriber(nil), b.handlers[c.model]...)
+		async := b.jobs != nil && !b.closed
+		if async {
+			// keeps Close from closing jobs while sending
+			b.sending.Add(1)
+		}
+		b.mu.RUnlock()
+
+		// the lock is released since sending blocks while the queue is
+		// full, and subscribers may subscribe or write meanwhile
+		for _, sub := range subs {
+			sub, c := sub, c
+			if async {
+				b.jobs <- func() { b.deliver(sub, c) }
+			} else {
+				b.deliver(sub, c)
+			}
+		}
+
+		if async {
+			b.sending.Done()
+		}
+	}
+}
+
+// calls the subscriber, isolating the publisher from panics
+func (b *Bus) deliver(sub *subscriber, c change) {
+	defer func() {
+		if r := recover(); r != nil {
+			if b.opts.OnPanic != nil {
+				b.opts.OnPanic(r)
+			} else {
+				log.Printf("orm: event subscriber panicked on %s %s: %v", c.table, c.typ, r)
+			}
+		}
+	}()
+	sub.deliver(c)
+}
+
+// context key of the events buffered by Bus.Transaction
+type eventBufferKey struct{}
+
+type eventBuffer struct {
+	mu      sync.Mutex
+	changes []change
+}
+
+func (buf *eventBuffer) add(changes []change) {
+	buf.mu.Lock()
+	buf.changes = append(buf.changes, changes...)
+	buf.mu.Unlock()
+}
+
+// publishes each change with the bus that collected it
+func publishChanges(changes []change) {
+	for _, c := range changes {
+		c.bus.publish([]change{c})
+	}
+}
+
+// Transaction runs fc in a transaction of db like db.Transaction.
+// Events of writes made with tx are published after the transaction commits.
+// Nested calls publish their events with the outermost transaction.
+func (b *Bus) Transaction(db *gorm.DB, fc func(tx *gorm.DB) error) error {
+	_, nested := db.Statement.Context.Value(eventBufferKey{}).(*eventBuffer)
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok && !nested {
+		return fmt.Errorf("orm: %w: nested in another transaction", ErrUnobservedTransaction)
+	}
+	return Transaction(db, fc)
+}
+
+/*
+Transaction runs fc in a transaction of db like db.Transaction, holding
+back the events of the buses registered on db until it commits. Unlike
+Bus.Transaction, it needs no bus: it is used by the helpers of this
+package that open their own transactions, e.g InsertMany and Importer.
+
+Inside a transaction the buses can't observe, fc runs in a nested
+transaction and writes of models with subscribers still fail with
+ErrUnobservedTransaction.
+*/
+func Transaction(db *gorm.DB, fc func(tx *gorm.DB) error) error {
+	parent, nested := db.Statement.Context.Value(eventBufferKey{}).(*eventBuffer)
+	if _, ok := db.Statement.ConnPool.(gorm.TxCommitter); ok && !nested {
+		return db.Transaction(fc)
+	}
+
+	buf := &eventBuffer{}
+	ctx := context.WithValue(db.Statement.Context, eventBufferKey{}, buf)
+
+	err := db.WithContext(ctx).Transaction(fc)
+	if err != nil {
+		return err
+	}
+
+	if nested {
+		parent.add(buf.changes)
+	} else {
+		publishChanges(buf.changes)
+	}
+	return nil
+}
+
+// names of the settings holding changes of a statement
+const (
+	eventsOldKey     = "orm:events_old"
+	eventsPendingKey = "orm:events_pending"
+	eventsBufferKey  = "orm:events_buffer"
+)
+
+// Register publishes the events of writes made through db and its sessions.
+func (b *Bus) Register(db *gorm.DB) error {
+	cb := db.Callback()
+
+	// buffers must be set up before associations are saved
+
+	err := cb.Create().After("gorm:begin_transaction").Before("gorm:before_create").
+		Register("orm:events_begin_create", b.begin)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Update().After("gorm:begin_transaction").Before("gorm:before_update").
+		Register("orm:events_begin_update", b.begin)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Delete().After("gorm:begin_transaction").Before("gorm:before_delete").
+		Register("orm:events_begin_delete", b.begin)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Create().Before("gorm:create").Register("orm:events_load_create", b.loadExisting)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Create().After("gorm:create").Register("orm:events_collect_create", func(tx *gorm.DB) {
+		b.collect(tx, Created)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cb.Create().After("gorm:commit_or_rollback_transaction").Register("orm:events_publish_create", b.flush)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Update().Before("gorm:update").Register("orm:events_load_update", b.loadOld)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Update().After("gorm:update").Register("orm:events_collect_update", func(tx *gorm.DB) {
+		b.collect(tx, Updated)
+	})
+	if err != nil {
+		return err
+	}
+
+	err = cb.Update().After("gorm:commit_or_rollback_transaction").Register("orm:events_publish_update", b.flush)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Delete().Before("gorm:delete").Register("orm:events_load_delete", b.loadOld)
+	if err != nil {
+		return err
+	}
+
+	err = cb.Delete().After("gorm:delete").Register("orm:events_collect_delete", func(tx *gorm.DB) {
+		b.collect(tx, Deleted)
+	})
+	if err != nil {
+		return err
+	}
+
+	return cb.Delete().After("gorm:commit_or_rollback_transaction").Register("orm:events_publish_delete", b.flush)
+}
+
+// returns the schema of the statement if its model has subscribers
+func (b *Bus) schemaOf(tx *gorm.DB) *schema.Schema {
+	if tx.Error != nil || tx.Statement.Schema == nil || tx.DryRun {
+		return nil
+	}
+
+	if !b.subscribed(tx.Statement.Schema.ModelType) {
+		return nil
+	}
+	return tx.Statement.Schema
+}
+
+// loads the records that an update or delete is about to change
+func (b *Bus) loadOld(tx *gorm.DB) {
+	s := b.schemaOf(tx)
+	if s == nil {
+		return
+	}
+
+	exprs := statementWhere(tx)
+	if len(exprs) == 0 && !tx.AllowGlobalUpdate {
+		// gorm refuses the write
+		return
+	}
+
+	rows, err := loadRows(tx, s, exprs)
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	tx.InstanceSet(eventsOldKey, rows)
+}
+
+// loads the records an upsert, e.g of associations, would update
+func (b *Bus) loadExisting(tx *gorm.DB) {
+	s := b.schemaOf(tx)
+	if s == nil || len(s.PrimaryFields) == 0 {
+		return
+	}
+
+	if _, ok := tx.Statement.Clauses["ON CONFLICT"]; !ok {
+		return
+	}
+
+	keyed := reflect.MakeSlice(reflect.SliceOf(s.ModelType), 0, 0)
+	for _, rv := range records(tx.Statement.ReflectValue) {
+		if rv.Type() == s.ModelType && len(primaryKeyWhere(tx, s, rv)) == len(s.PrimaryFields) {
+			keyed = reflect.Append(keyed, rv)
+		}
+	}
+
+	if keyed.Len() == 0 {
+		return
+	}
+
+	rows, err := loadRows(tx, s, []clause.Expression{keysIn(s, keyed)})
+	if err != nil {
+		tx.AddError(err)
+		return
+	}
+	tx.InstanceSet(eventsOldKey, rows)
+}
+
+// returns the struct values of a statement's value
+func records(rv reflect.Value) []reflect.Value {
+	rv = reflect.Indirect(rv)
+	switch rv.Kind() {
+	case reflect.Struct:
+		return []reflect.Value{rv}
+	case reflect.Slice, reflect.Array:
+		values := make([]reflect.Value, 0, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			if v := reflect.Indirect(rv.Index(i)); v.Kind() == reflect.Struct {
+				values = append(values, v)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// returns the where conditions of the statement including the
+// primary keys of the model, which gorm adds while executing it.
+func statementWhere(tx *gorm.DB) []clause.Expression {
+	var exprs []clause.Expression
+	if c, ok := tx.Statement.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok {
+			exprs = append(exprs, where.Exprs...)
+		}
+	}
+
+	rv := tx.Statement.ReflectValue
+	if rv.Kind() == reflect.Struct && rv.Type() == tx.Statement.Schema.ModelType {
+		exprs = append(exprs, primaryKeyWhere(tx, tx.Statement.Schema, rv)...)
+	}
+	return exprs
+}
+
+// loads the records matching exprs in the connection of tx
+func loadRows(tx *gorm.DB, s *schema.Schema, exprs []clause.Expression) (reflect.Value, error) {
+	rows := reflect.New(reflect.SliceOf(s.ModelType))
+	err := tx.Session(&gorm.Session{NewDB: true, SkipHooks: true}).Unscoped().
+		Model(reflect.New(s.ModelType).Interface()).
+		Clauses(clause.Where{Exprs: exprs}).Find(rows.Interface()).Error
+	return rows.Elem(), err
+}
+
+// records the changes made by the statement
+func (b *Bus) collect(tx *gorm.DB, typ EventType) {
+	s := b.schemaOf(tx)
+	if s == nil {
+		return
+	}
+
+	var changes []change
+	switch typ {
+	case Created:
+		var existing reflect.Value
+		if value, ok := tx.InstanceGet(eventsOldKey); ok {
+			existing = value.(reflect.Value)
+		}
+
+		for _, rv := range records(tx.Statement.ReflectValue) {
+			// upserted records that existed before were not created
+			if existing.IsValid() && findByKey(s, existing, rv).IsValid() {
+				continue
+			}
+			changes = append(changes, change{bus: b, typ: Created, model: s.ModelType, table: s.Table, new: copyModel(rv)})
+		}
+	case Updated, Deleted:
+		value, ok := tx.InstanceGet(eventsOldKey)
+		if !ok {
+			return
+		}
+
+		olds := value.(reflect.Value)
+		if olds.Len() == 0 || tx.Statement.RowsAffected == 0 {
+			return
+		}
+
+		var news reflect.Value
+		if typ == Updated {
+			var err error
+			news, err = loadRows(tx, s, []clause.Expression{keysIn(s, olds)})
+			if err != nil {
+				tx.AddError(err)
+				return
+			}
+		}
+
+		for i := 0; i < olds.Len(); i++ {
+			c := change{bus: b, typ: typ, model: s.ModelType, table: s.Table, old: olds.Index(i)}
+			if typ == Updated {
+				c.new = findByKey(s, news, c.old)
+				if !c.new.IsValid() {
+					continue
+				}
+			}
+			changes = append(changes, c)
+		}
+	}
+
+	if len(changes) > 0 {
+		tx.InstanceSet(eventsPendingKey, changes)
+	}
+}
+
+// buffers the events of statements run in the transaction gorm started
+// for tx, e.g to save associations, until the transaction commits.
+// Writes in transactions the bus does not observe are refused.
+func (b *Bus) begin(tx *gorm.DB) {
+	if _, ok := tx.InstanceGet("gorm:started_transaction"); !ok {
+		_, buffered := tx.Statement.Context.Value(eventBufferKey{}).(*eventBuffer)
+		if _, inTx := tx.Statement.ConnPool.(gorm.TxCommitter); inTx && !buffered {
+			if s := b.schemaOf(tx); s != nil {
+				tx.AddError(fmt.Errorf("orm: %w: write of %s", ErrUnobservedTransaction, s.Table))
+			}
+		}
+		return
+	}
+
+	buf := &eventBuffer{}
+	tx.Statement.Context = context.WithValue(tx.Statement.Context, eventBufferKey{}, buf)
+	tx.InstanceSet(eventsBufferKey, buf)
+}
+
+// publishes the changes of a statement after it committed,
+// or buffers them for the enclosing transaction
+func (b *Bus) flush(tx *gorm.DB) {
+	var changes []change
+	if value, ok := tx.InstanceGet(eventsPendingKey); ok {
+		changes = value.([]change)
+	}
+
+	if value, ok := tx.InstanceGet(eventsBufferKey); ok {
+		changes = append(changes, value.(*eventBuffer).changes...)
+	} else if buf, ok := tx.Statement.Context.Value(eventBufferKey{}).(*eventBuffer); ok {
+		if tx.Error == nil {
+			buf.add(changes)
+		}
+		return
+	}
+
+	if tx.Error == nil && len(changes) > 0 {
+		publishChanges(changes)
+	}
+}
+
+// returns a copy of the model in rv so that subscribers do not share it
+func copyModel(rv reflect.Value) reflect.Value {
+	rv = reflect.Indirect(rv)
+	v := reflect.New(rv.Type()).Elem()
+	v.Set(rv)
+	return v
+}
+
+// returns a condition matching the primary keys of rows
+func keysIn(s *schema.Schema, rows reflect.Value) clause.Expression {
+	ctx := context.Background()
+
+	if len(s.PrimaryFields) == 1 {
+		pk := s.PrimaryFields[0]
+		values := make([]any, rows.Len())
+		for i := range values {
+			values[i], _ = pk.ValueOf(ctx, rows.Index(i))
+		}
+		return clause.IN{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Values: values}
+	}
+
+	ors := make([]clause.Expression, rows.Len())
+	for i := range ors {
+		ands := make([]clause.Expression, len(s.PrimaryFields))
+		for j, pk := range s.PrimaryFields {
+			value, _ := pk.ValueOf(ctx, rows.Index(i))
+			ands[j] = clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName}, Value: value}
+		}
+		ors[i] = clause.And(ands...)
+	}
+	return clause.Or(ors...)
+}
+
+// returns the row of rows with the primary key of v
+func findByKey(s *schema.Schema, rows reflect.Value, v reflect.Value) reflect.Value {
+	ctx := context.Background()
+
+next:
+	for i := 0; i < rows.Len(); i++ {
+		for _, pk := range s.PrimaryFields {
+			a, _ := pk.ValueOf(ctx, rows.Index(i))
+			b, _ := pk.ValueOf(ctx, v)
+			if !reflect.DeepEqual(a, b) {
+				continue next
+			}
+		}
+		return rows.Index(i)
+	}
+	return reflect.Value{}
+}
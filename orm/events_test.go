@@ -0,0 +1,258 @@
+package orm_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/gorm"
+)
+
+func TestEventBus(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
+	bus := orm.NewBus(orm.BusOptions{})
+	if err := bus.Register(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []orm.Event[Post]
+	unsubscribe := orm.Subscribe(bus, func(e orm.Event[Post]) {
+		events = append(events, e)
+	})
+
+	var comments []orm.Event[Comment]
+	orm.Subscribe(bus, func(e orm.Event[Comment]) {
+		comments = append(comments, e)
+	})
+
+	dborm := orm.New(db)
+	post := &Post{Title: "draft", Comments: []Comment{{}, {}}}
+	if err := dborm.Insert(post); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 1 || events[0].Type != orm.Created || events[0].Old != nil || events[0].New.ID != post.ID {
+		t.Fatalf("expected a created event for the post, got %+v", events)
+	}
+
+	if len(comments) != 2 || comments[0].New.PostID != post.ID {
+		t.Errorf("expected created events for the saved associations, got %+v", comments)
+	}
+
+	post.Title = "published"
+	dborm.Update(post)
+	dborm.PartialUpdate(post, Post{Title: "edited"}, orm.Where{})
+
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+
+	if e := events[1]; e.Type != orm.Updated || e.Old.Title != "draft" || e.New.Title != "published" {
+		t.Errorf("unexpected update event: %v -> %v", e.Old, e.New)
+	}
+
+	if e := events[2]; e.Old.Title != "published" || e.New.Title != "edited" {
+		t.Errorf("unexpected partial update event: %v -> %v", e.Old, e.New)
+	}
+
+	// failed writes publish nothing
+	dborm.PartialUpdate(&Post{ID: 100}, Post{Title: "missing"}, orm.Where{})
+	if len(events) != 3 {
+		t.Errorf("expected no event for a failed update, got %d events", len(events))
+	}
+
+	// events of explicit transactions are published on commit only
+	failure := errors.New("rollback")
+	err := bus.Transaction(db, func(tx *gorm.DB) error {
+		tx.Create(&Post{Title: "rolled back"})
+		return failure
+	})
+
+	if !errors.Is(err, failure) || len(events) != 3 {
+		t.Errorf("expected no events from a rolled back transaction, got %d", len(events))
+	}
+
+	err = bus.Transaction(db, func(tx *gorm.DB) error {
+		tx.Create(&Post{Title: "committed"})
+		if len(events) != 3 {
+			t.Error("events must not be published before commit")
+		}
+
+		// nested transactions publish with the outer one
+		return bus.Transaction(tx, func(tx *gorm.DB) error {
+			return tx.Create(&Post{Title: "nested"}).Error
+		})
+	})
+
+	if err != nil || len(events) != 5 || events[4].New.Title != "nested" {
+		t.Errorf("expected events after commit, got %d, err: %v", len(events), err)
+	}
+
+	// other transactions can't be observed, so their writes are refused
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return tx.Create(&Post{Title: "unobserved"}).Error
+	})
+
+	if !errors.Is(err, orm.ErrUnobservedTransaction) || len(events) != 5 {
+		t.Errorf("expected ErrUnobservedTransaction, got %v and %d events", err, len(events))
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return bus.Transaction(tx, func(tx *gorm.DB) error { return nil })
+	})
+
+	if !errors.Is(err, orm.ErrUnobservedTransaction) {
+		t.Errorf("expected ErrUnobservedTransaction for a nested bus transaction, got %v", err)
+	}
+
+	dborm.Delete(&Comment{}, orm.Where{Query: "post_id = ?", Args: []any{post.ID}})
+	if len(comments) != 4 || comments[3].Type != orm.Deleted || comments[3].Old.PostID != post.ID {
+		t.Errorf("expected delete events for the comments, got %+v", comments)
+	}
+
+	if err := dborm.Delete(post); err != nil {
+		t.Fatal(err)
+	}
+
+	if e := events[len(events)-1]; e.Type != orm.Deleted || e.New != nil || e.Old.Title != "edited" {
+		t.Errorf("unexpected delete event: %+v", e)
+	}
+
+	unsubscribe()
+	dborm.Insert(&Post{Title: "unobserved"})
+	if len(events) != 6 {
+		t.Errorf("unsubscribed handler received events, got %d", len(events))
+	}
+}
+
+func TestEventBusHelpers(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{}, &Author{}, &Bio{}, &Tag{}, &Story{})
+	bus := orm.NewBus(orm.BusOptions{})
+	if err := bus.Register(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var posts, tags int
+	orm.Subscribe(bus, func(e orm.Event[Post]) { posts++ })
+	orm.Subscribe(bus, func(e orm.Event[Tag]) { tags++ })
+
+	// the transactions the package opens itself are observed
+	batch := []Post{{Title: "a"}, {Title: "b"}, {Title: "c"}}
+	if err := orm.New(db).InsertMany(&batch, 2); err != nil || posts != 3 {
+		t.Errorf("InsertMany: expected 3 events, got %d, err: %v", posts, err)
+	}
+
+	importer := orm.Importer[Post]{DB: db}
+	report, err := importer.ImportCSV(context.Background(), strings.NewReader("title\nd\ne\n"))
+	if err != nil || report.Inserted != 2 || posts != 5 {
+		t.Errorf("ImportCSV: expected 2 inserted rows and 5 events, got %+v, %d events, err: %v", report, posts, err)
+	}
+
+	story := &Story{Title: "Generics"}
+	orm.New(db).Insert(story)
+	association := orm.Association{DB: db, Model: story, Name: "Tags"}
+	if err := association.Append(&Tag{Name: "go"}); err != nil || tags != 1 {
+		t.Errorf("Association.Append: expected 1 event, got %d, err: %v", tags, err)
+	}
+
+	if err := orm.MigrateConstraints(db, &Post{}); err != nil {
+		t.Errorf("MigrateConstraints failed with error: %v", err)
+	}
+
+	// an unobserved transaction still refuses writes of subscribed models
+	err = db.Transaction(func(tx *gorm.DB) error {
+		return orm.New(tx).InsertMany(&[]Post{{Title: "f"}}, 1)
+	})
+
+	if !errors.Is(err, orm.ErrUnobservedTransaction) || posts != 5 {
+		t.Errorf("expected ErrUnobservedTransaction, got %v and %d events", err, posts)
+	}
+}
+
+func TestEventBusAsync(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{})
+
+	var panics int32
+	bus := orm.NewBus(orm.BusOptions{
+		Workers:   3,
+		QueueSize: 10,
+		OnPanic:   func(recovered any) { atomic.AddInt32(&panics, 1) },
+	})
+	bus.Register(db)
+
+	var mu sync.Mutex
+	titles := map[string]bool{}
+	orm.Subscribe(bus, func(e orm.Event[Post]) {
+		mu.Lock()
+		titles[e.New.Title] = true
+		mu.Unlock()
+	})
+
+	// a panicking subscriber affects neither the write nor other subscribers
+	orm.Subscribe(bus, func(e orm.Event[Post]) {
+		panic("subscriber failed")
+	})
+
+	posts := []Post{{Title: "a"}, {Title: "b"}, {Title: "c"}}
+	if err := db.Create(&posts).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Close()
+
+	if len(titles) != 3 || !titles["a"] || !titles["c"] {
+		t.Errorf("expected 3 delivered events, got %v", titles)
+	}
+
+	if atomic.LoadInt32(&panics) != 3 {
+		t.Errorf("expected 3 recovered panics, got %d", panics)
+	}
+}
+
+func TestEventBusFullQueue(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{})
+	bus := orm.NewBus(orm.BusOptions{Workers: 1, QueueSize: 1})
+	bus.Register(db)
+
+	// subscribing takes the lock that publishers must not hold while the
+	// queue is full
+	var delivered int32
+	orm.Subscribe(bus, func(e orm.Event[Post]) {
+		unsubscribe := orm.Subscribe(bus, func(e orm.Event[Post]) {})
+		unsubscribe()
+		atomic.AddInt32(&delivered, 1)
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 5; i++ {
+			db.Create(&Post{Title: "post"})
+		}
+		bus.Close()
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publishing to a full queue deadlocked")
+	}
+
+	if n := atomic.LoadInt32(&delivered); n != 5 {
+		t.Errorf("expected 5 delivered events, got %d", n)
+	}
+}
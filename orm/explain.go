@@ -0,0 +1,303 @@
+package orm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Tables with at least this many rows are reported by Explain
+// when they are scanned in full.
+var LargeTableRows int64 = 10000
+
+// PlanNode is a step of a query plan.
+type PlanNode struct {
+	Operation string // e.g Seq Scan, Index Scan (postgres) or SCAN, SEARCH (sqlite)
+	Table     string // table read by the step, if any
+	Index     string // index used by the step, if any
+	FullScan  bool   // whether every row of Table is read
+	Detail    string // the step as described by the database
+
+	// Estimates and measurements of postgres. Zero on sqlite.
+	Cost       float64 // total cost estimate
+	Rows       float64 // actual number of rows returned
+	ActualTime float64 // actual total time in milliseconds
+
+	Children []*PlanNode
+}
+
+// Plan is the query plan of a statement.
+type Plan struct {
+	Statement Statement   // the explained statement
+	Nodes     []*PlanNode // top level steps
+	Warnings  []string    // full scans of large tables
+}
+
+// String returns the plan as an indented tree.
+func (p *Plan) String() string {
+	var sb strings.Builder
+	var write func(nodes []*PlanNode, depth int)
+	write = func(nodes []*PlanNode, depth int) {
+		for _, node := range nodes {
+			sb.WriteString(strings.Repeat("  ", depth))
+			sb.WriteString(node.Detail)
+			sb.WriteByte('\n')
+			write(node.Children, depth+1)
+		}
+	}
+	write(p.Nodes, 0)
+	return sb.String()
+}
+
+/*
+Explain returns the plan of the query FindAll would run for T with the
+conditions. Use Limit to explain a page of Paginate.
+
+	plan, err := orm.Explain[Post](db, orm.Where{Query: "title = ?", Args: []any{"go"}})
+	fmt.Print(plan)
+	for _, warning := range plan.Warnings {
+		log.Println(warning) // full scan of posts (25000 rows)
+	}
+
+On postgres the query is run with EXPLAIN (ANALYZE, FORMAT JSON) so that
+actual rows and times are reported; on sqlite EXPLAIN QUERY PLAN is used.
+*/
+func Explain[T any](db *gorm.DB, conditions ...Condition) (*Plan, error) {
+	statements, err := ToSQL(db, func(tx *gorm.DB) error {
+		var results []T
+		return applyConditions(tx.Model(new(T)), conditions...).Find(&results).Error
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("explain: no statement generated for %T", *new(T))
+	}
+
+	plan := &Plan{Statement: statements[0]}
+	switch db.Dialector.Name() {
+	case "postgres":
+		plan.Nodes, err = explainPostgres(db, plan.Statement)
+	case "sqlite":
+		plan.Nodes, err = explainSQLite(db, plan.Statement)
+	default:
+		err = fmt.Errorf("explain: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if plan.Warnings, err = fullScanWarnings(db, plan.Nodes); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// runs the explain query on the connection of db. The statement is
+// passed as is, since its placeholders are those of the dialect.
+func queryPlan(db *gorm.DB, prefix string, stmt Statement, scan func(scan func(dest ...any) error) error) error {
+	rows, err := db.Statement.ConnPool.QueryContext(db.Statement.Context, prefix+stmt.SQL, stmt.Vars...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows.Scan); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func explainSQLite(db *gorm.DB, stmt Statement) ([]*PlanNode, error) {
+	var roots []*PlanNode
+	nodes := make(map[int]*PlanNode)
+
+	err := queryPlan(db, "EXPLAIN QUERY PLAN ", stmt, func(scan func(dest ...any) error) error {
+		var id, parent, notused int
+		var detail string
+		if err := scan(&id, &parent, &notused, &detail); err != nil {
+			return err
+		}
+
+		node := parseSQLiteStep(detail)
+		nodes[id] = node
+
+		if p, ok := nodes[parent]; ok {
+			p.Children = append(p.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+		return nil
+	})
+	return roots, err
+}
+
+// parses a step like "SEARCH posts USING INDEX idx_title (title=?)"
+func parseSQLiteStep(detail string) *PlanNode {
+	node := &PlanNode{Detail: detail}
+	words := strings.Fields(detail)
+	if len(words) == 0 {
+		return node
+	}
+
+	node.Operation = words[0]
+	if node.Operation != "SCAN" && node.Operation != "SEARCH" {
+		return node
+	}
+
+	rest := words[1:]
+	// sqlite before 3.36 writes SCAN TABLE posts
+	if len(rest) > 0 && rest[0] == "TABLE" {
+		rest = rest[1:]
+	}
+
+	if len(rest) > 0 {
+		node.Table = rest[0]
+		rest = rest[1:]
+	}
+
+	// skip the alias of the table
+	if len(rest) > 1 && rest[0] == "AS" {
+		rest = rest[2:]
+	}
+
+	for i, word := range rest {
+		if word == "INDEX" && i+1 < len(rest) {
+			node.Index = rest[i+1]
+			break
+		}
+
+		if word == "PRIMARY" {
+			node.Index = "PRIMARY KEY"
+			break
+		}
+	}
+
+	node.FullScan = node.Operation == "SCAN" && node.Index == ""
+	return node
+}
+
+// a node of EXPLAIN (FORMAT JSON)
+type pgPlanNode struct {
+	NodeType   string       `json:"Node Type"`
+	Relation   string       `json:"Relation Name"`
+	Index      string       `json:"Index Name"`
+	TotalCost  float64      `json:"Total Cost"`
+	ActualRows float64      `json:"Actual Rows"`
+	ActualTime float64      `json:"Actual Total Time"`
+	Plans      []pgPlanNode `json:"Plans"`
+}
+
+func explainPostgres(db *gorm.DB, stmt Statement) ([]*PlanNode, error) {
+	var output []byte
+	err := queryPlan(db, "EXPLAIN (ANALYZE, FORMAT JSON) ", stmt, func(scan func(dest ...any) error) error {
+		return scan(&output)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+	return parsePostgresPlan(output)
+}
+
+func parsePostgresPlan(output []byte) ([]*PlanNode, error) {
+	var plans []struct {
+		Plan pgPlanNode `json:"Plan"`
+	}
+
+	if err := json.Unmarshal(output, &plans); err != nil {
+		return nil, fmt.Errorf("explain: %w", err)
+	}
+
+	var convert func(n pgPlanNode) *PlanNode
+	convert = func(n pgPlanNode) *PlanNode {
+		node := &PlanNode{
+			Operation:  n.NodeType,
+			Table:      n.Relation,
+			Index:      n.Index,
+			FullScan:   n.NodeType == "Seq Scan",
+			Cost:       n.TotalCost,
+			Rows:       n.ActualRows,
+			ActualTime: n.ActualTime,
+			Detail:     n.NodeType,
+		}
+
+		if n.Relation != "" {
+			node.Detail += " on " + n.Relation
+		}
+
+		if n.Index != "" {
+			node.Detail += " using " + n.Index
+		}
+
+		for _, child := range n.Plans {
+			node.Children = append(node.Children, convert(child))
+		}
+		return node
+	}
+
+	nodes := make([]*PlanNode, len(plans))
+	for i, p := range plans {
+		nodes[i] = convert(p.Plan)
+	}
+	return nodes, nil
+}
+
+// returns a warning for each table scanned in full that has at least LargeTableRows
+func fullScanWarnings(db *gorm.DB, nodes []*PlanNode) ([]string, error) {
+	var warnings []string
+	seen := make(map[string]bool)
+
+	var walk func(nodes []*PlanNode) error
+	walk = func(nodes []*PlanNode) error {
+		for _, node := range nodes {
+			if node.FullScan && node.Table != "" && !seen[node.Table] {
+				seen[node.Table] = true
+
+				rows, err := tableRows(db, node.Table)
+				if err != nil {
+					return err
+				}
+
+				if rows >= LargeTableRows {
+					warnings = append(warnings, fmt.Sprintf("full scan of %s (%d rows)", node.Table, rows))
+				}
+			}
+
+			if err := walk(node.Children); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return warnings, walk(nodes)
+}
+
+// returns the number of rows of table, estimated on postgres
+func tableRows(db *gorm.DB, table string) (int64, error) {
+	rows := int64(-1)
+	tx := db.Session(&gorm.Session{NewDB: true})
+
+	if db.Dialector.Name() == "postgres" {
+		// resolved like the table of the query, through the search path
+		err := tx.Raw("SELECT reltuples::bigint FROM pg_class WHERE oid = ?::regclass", tx.Statement.Quote(table)).
+			Scan(&rows).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// tables that were never analyzed have no estimate
+	if rows < 0 {
+		err := tx.Table(table).Count(&rows).Error
+		return rows, err
+	}
+	return rows, nil
+}
@@ -0,0 +1,60 @@
+package orm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+func TestExplain(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
+
+	plan, err := orm.Explain[Post](db, orm.Where{Query: "id = ?", Args: []any{1}})
+	if err != nil {
+		t.Fatalf("Explain failed with error: %v", err)
+	}
+
+	if len(plan.Nodes) != 1 {
+		t.Fatalf("expected 1 step, got %s", plan)
+	}
+
+	if node := plan.Nodes[0]; node.Operation != "SEARCH" || node.Table != "posts" || node.FullScan {
+		t.Errorf("expected search of posts by primary key, got %+v", node)
+	}
+
+	if len(plan.Warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", plan.Warnings)
+	}
+
+	// large table scanned in full
+	err = db.Exec(`INSERT INTO posts (title) WITH RECURSIVE seq(x) AS
+		(SELECT 1 UNION ALL SELECT x + 1 FROM seq WHERE x < ?) SELECT 'post ' || x FROM seq`, orm.LargeTableRows).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err = orm.Explain[Post](db,
+		orm.Where{Query: "title LIKE ?", Args: []any{"%go%"}},
+		orm.Order{Name: "title"},
+		orm.Limit{L: 10, O: 10},
+	)
+	if err != nil {
+		t.Fatalf("Explain failed with error: %v", err)
+	}
+
+	if !strings.HasSuffix(plan.Statement.SQL, "LIMIT 10 OFFSET 10") {
+		t.Errorf("unexpected statement: %s", plan.Statement.SQL)
+	}
+
+	if node := plan.Nodes[0]; node.Operation != "SCAN" || node.Table != "posts" || !node.FullScan {
+		t.Errorf("expected full scan of posts, got %+v", node)
+	}
+
+	if len(plan.Warnings) != 1 || !strings.HasPrefix(plan.Warnings[0], "full scan of posts") {
+		t.Errorf("expected warning for full scan of posts, got %v", plan.Warnings)
+	}
+}
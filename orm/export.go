@@ -0,0 +1,363 @@
+package orm
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Output format of Export.
+type Format string
+
+const (
+	CSV    Format = "csv"    // comma separated values with a header row
+	NDJSON Format = "ndjson" // one JSON object per line
+)
+
+// Options for Export and ExportHandler.
+type ExportOptions struct {
+	// Output format, default: CSV
+	Format Format
+
+	// json names of the fields to export, in order.
+	// Defaults to all fields with a json name that are not relationships.
+	Columns []string
+
+	// Layout used to format time.Time values, default: time.RFC3339.
+	// NDJSON exports of all columns use the json encoding of the model.
+	TimeFormat string
+
+	// Written for nil pointers and NULL values in CSV exports, default: "".
+	NullValue string
+
+	// Prefix CSV text cells starting with =, +, -, @, tab or carriage return
+	// with a single quote so that spreadsheets do not evaluate them as formulas.
+	// Numbers are not changed.
+	EscapeFormulas bool
+}
+
+// a column of an export
+type exportColumn struct {
+	name  string // json name
+	field string // name of the struct field
+	index []int  // index for reflect.Value.FieldByIndex
+}
+
+var (
+	timeType   = reflect.TypeOf(time.Time{})
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+)
+
+/*
+Export writes records of T matching the conditions to w as CSV or NDJSON.
+Rows are streamed from the database one at a time, so exports of
+large tables do not have to fit in memory.
+
+	err := orm.Export[Post](ctx, db, w, orm.ExportOptions{
+		Columns:    []string{"id", "title", "created_at"},
+		TimeFormat: "2006-01-02",
+	}, orm.Order{Name: "id"})
+
+CSV headers are the json names of the fields.
+*/
+func Export[T any](ctx context.Context, db *gorm.DB, w io.Writer, opts ExportOptions, conditions ...Condition) error {
+	columns, err := exportColumns(reflect.TypeOf(new(T)).Elem(), opts.Columns)
+	if err != nil {
+		return err
+	}
+
+	if opts.TimeFormat == "" {
+		opts.TimeFormat = time.RFC3339
+	}
+
+	rows, err := Iterate[T](ctx, db, conditions...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	switch opts.Format {
+	case CSV, "":
+		err = exportCSV(rows, w, columns, opts)
+	case NDJSON:
+		err = exportNDJSON(rows, w, columns, opts)
+	default:
+		err = fmt.Errorf("export: unsupported format %q", opts.Format)
+	}
+
+	if err != nil {
+		return err
+	}
+	return rows.Err()
+}
+
+func exportCSV[T any](rows *Rows[T], w io.Writer, columns []exportColumn, opts ExportOptions) error {
+	cw := csv.NewWriter(w)
+
+	record := make([]string, len(columns))
+	for i, column := range columns {
+		record[i] = column.name
+	}
+
+	if err := cw.Write(record); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		value := rows.Value()
+		rv := reflect.ValueOf(&value).Elem()
+
+		for i, column := range columns {
+			record[i] = formatCSV(fieldByIndex(rv, column.index), opts)
+		}
+
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+func exportNDJSON[T any](rows *Rows[T], w io.Writer, columns []exportColumn, opts ExportOptions) error {
+	enc := json.NewEncoder(w)
+	allColumns := len(opts.Columns) == 0
+
+	for rows.Next() {
+		value := rows.Value()
+		if allColumns {
+			if err := enc.Encode(value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		rv := reflect.ValueOf(&value).Elem()
+		object := make(map[string]any, len(columns))
+		for _, column := range columns {
+			object[column.name] = formatJSON(fieldByIndex(rv, column.index), opts)
+		}
+
+		if err := enc.Encode(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExportHandler returns an http.Handler that streams an Export of T as an attachment.
+// The extension of the format is appended to filename.
+//
+// Errors before any bytes are sent are returned with status 500. Later
+// errors abort the response with http.ErrAbortHandler.
+//
+// conditions is called for every request to build the query conditions,
+// e.g from query parameters. It may be nil.
+func ExportHandler[T any](db *gorm.DB, filename string, opts ExportOptions, conditions func(r *http.Request) []Condition) http.Handler {
+	format := opts.Format
+	if format == "" {
+		format = CSV
+	}
+
+	contentType := "text/csv; charset=utf-8"
+	if format == NDJSON {
+		contentType = "application/x-ndjson"
+	}
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{
+		"filename": filename + "." + string(format),
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var conds []Condition
+		if conditions != nil {
+			conds = conditions(r)
+		}
+
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", disposition)
+
+		cw := &countingWriter{w: w}
+		err := Export[T](r.Context(), db, cw, opts, conds...)
+
+		if err == nil {
+			return
+		}
+
+		// once bytes are sent the status can no longer change; aborting
+		// the response tells the client that the export is truncated
+		if cw.n > 0 {
+			panic(http.ErrAbortHandler)
+		}
+
+		w.Header().Del("Content-Disposition")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// resolves the columns to export from the json names of the fields of t
+func exportColumns(t reflect.Type, names []string) ([]exportColumn, error) {
+	var all []exportColumn
+	collectColumns(t, nil, &all)
+
+	if len(names) == 0 {
+		return all, nil
+	}
+
+	byName := make(map[string]exportColumn, len(all))
+	for _, column := range all {
+		byName[column.name] = column
+	}
+
+	columns := make([]exportColumn, len(names))
+	for i, name := range names {
+		column, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("export: unknown column %q", name)
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+func collectColumns(t reflect.Type, index []int, columns *[]exportColumn) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		fieldIndex := append(append([]int{}, index...), i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+
+		// promote fields of embedded structs like gorm.Model
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			collectColumns(ft, fieldIndex, columns)
+			continue
+		}
+
+		if isRelationship(ft) {
+			continue
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		*columns = append(*columns, exportColumn{name: name, field: field.Name, index: fieldIndex})
+	}
+}
+
+// structs and slices of structs that are not scalar database values
+func isRelationship(t reflect.Type) bool {
+	if t.Kind() == reflect.Slice && t.Elem().Kind() != reflect.Uint8 {
+		return !reflect.PointerTo(t).Implements(valuerType) && !t.Implements(valuerType)
+	}
+
+	if t.Kind() == reflect.Struct {
+		return t != timeType && !t.Implements(valuerType) && !reflect.PointerTo(t).Implements(valuerType)
+	}
+	return false
+}
+
+// like reflect.Value.FieldByIndex but returns an invalid value for nil embedded pointers
+func fieldByIndex(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				return reflect.Value{}
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// returns the value of v to export or nil for NULL values
+func exportValue(v reflect.Value) any {
+	if !v.IsValid() {
+		return nil
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() != timeType {
+		if valuer, ok := v.Interface().(driver.Valuer); ok {
+			value, err := valuer.Value()
+			if err != nil {
+				return nil
+			}
+			return value
+		}
+	}
+	return v.Interface()
+}
+
+func formatCSV(v reflect.Value, opts ExportOptions) string {
+	switch value := exportValue(v).(type) {
+	case nil:
+		return opts.NullValue
+	case time.Time:
+		return value.Format(opts.TimeFormat)
+	case []byte:
+		return escapeFormula(string(value), opts)
+	case string:
+		return escapeFormula(value, opts)
+	default:
+		return fmt.Sprint(value)
+	}
+}
+
+// prefixes cells that spreadsheets would evaluate as formulas, see ExportOptions.EscapeFormulas
+func escapeFormula(s string, opts ExportOptions) string {
+	if opts.EscapeFormulas && s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func formatJSON(v reflect.Value, opts ExportOptions) any {
+	switch value := exportValue(v).(type) {
+	case time.Time:
+		return value.Format(opts.TimeFormat)
+	case []byte:
+		return string(value)
+	default:
+		return value
+	}
+}
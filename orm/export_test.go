@@ -0,0 +1,131 @@
+package orm_test
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+type Customer struct {
+	ID        uint           `json:"id" gorm:"primaryKey"`
+	Name      string         `json:"name"`
+	Email     sql.NullString `json:"email"`
+	Notes     *string        `json:"notes"`
+	Password  string         `json:"-"`
+	CreatedAt time.Time      `json:"created_at"`
+	Orders    []Sale         `json:"orders" gorm:"-"`
+}
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Customer{})
+
+	notes := "pays, late"
+	created := time.Date(2022, time.October, 1, 8, 30, 0, 0, time.UTC)
+	db.Create(&[]Customer{
+		{Name: "Alice", Email: sql.NullString{String: "alice@example.com", Valid: true}, Notes: &notes, CreatedAt: created},
+		{Name: "Bob", Password: "secret", CreatedAt: created},
+	})
+
+	ctx := context.Background()
+	buf := &bytes.Buffer{}
+
+	err := orm.Export[Customer](ctx, db, buf, orm.ExportOptions{
+		TimeFormat: "2006-01-02",
+		NullValue:  "NULL",
+	}, orm.Order{Name: "id"})
+
+	if err != nil {
+		t.Fatalf("csv export failed with error: %v", err)
+	}
+
+	expected := "id,name,email,notes,created_at\n" +
+		"1,Alice,alice@example.com,\"pays, late\",2022-10-01\n" +
+		"2,Bob,NULL,NULL,2022-10-01\n"
+
+	if buf.String() != expected {
+		t.Errorf("unexpected csv export:\n%s", buf.String())
+	}
+
+	// selected columns as ndjson
+	buf.Reset()
+	err = orm.Export[Customer](ctx, db, buf, orm.ExportOptions{
+		Format:  orm.NDJSON,
+		Columns: []string{"name", "email"},
+	}, orm.Where{Query: "name = ?", Args: []any{"Bob"}})
+
+	if err != nil {
+		t.Fatalf("ndjson export failed with error: %v", err)
+	}
+
+	if buf.String() != `{"email":null,"name":"Bob"}`+"\n" {
+		t.Errorf("unexpected ndjson export: %s", buf.String())
+	}
+
+	err = orm.Export[Customer](ctx, db, buf, orm.ExportOptions{Columns: []string{"password"}})
+	if err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+
+	// http handler
+	handler := orm.ExportHandler[Customer](db, "customers", orm.ExportOptions{Columns: []string{"id", "name"}},
+		func(r *http.Request) []orm.Condition {
+			return []orm.Condition{orm.Where{Query: "name = ?", Args: []any{r.URL.Query().Get("name")}}}
+		})
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/export?name=Alice", nil))
+
+	if w.Header().Get("Content-Disposition") != `attachment; filename=customers.csv` {
+		t.Errorf("unexpected Content-Disposition: %q", w.Header().Get("Content-Disposition"))
+	}
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/csv") {
+		t.Errorf("unexpected Content-Type: %q", w.Header().Get("Content-Type"))
+	}
+
+	if w.Body.String() != "id,name\n1,Alice\n" {
+		t.Errorf("unexpected response body: %q", w.Body.String())
+	}
+
+	// errors after the first bytes abort the response
+	func() {
+		defer func() {
+			if r := recover(); r != http.ErrAbortHandler {
+				t.Errorf("expected the handler to panic with ErrAbortHandler, got %v", r)
+			}
+		}()
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(&failingWriter{ResponseWriter: w}, httptest.NewRequest(http.MethodGet, "/export?name=Alice", nil))
+	}()
+
+	db.Create(&Customer{Name: "=HYPERLINK(\"http://x\")", Notes: &notes})
+	buf.Reset()
+	err = orm.Export[Customer](ctx, db, buf, orm.ExportOptions{Columns: []string{"id", "name"}, EscapeFormulas: true},
+		orm.Where{Query: "name LIKE ?", Args: []any{"=%"}})
+
+	if err != nil || buf.String() != "id,name\n3,\"'=HYPERLINK(\"\"http://x\"\")\"\n" {
+		t.Errorf("expected escaped formula, got %q, error %v", buf.String(), err)
+	}
+}
+
+// fails after writing part of the first write
+type failingWriter struct {
+	http.ResponseWriter
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	n, _ := w.ResponseWriter.Write(b[:len(b)/2])
+	return n, errors.New("connection reset")
+}
@@ -0,0 +1,235 @@
+/*
+Package factory generates valid model instances for tests and demo data.
+
+Values are random but deterministic for a seed and satisfy the validate
+tags of the model, e.g max=255, email or oneof=draft published.
+
+	comments := factory.New[Comment](1)
+	posts := factory.New[Post](1).
+		Field("Title", factory.Sequence("Post %d")).
+		HasMany("Comments", 3, comments)
+
+	// 10 posts with 3 comments each
+	_, err := posts.CreateN(orm.New(db), 10)
+
+	// overrides are applied last
+	draft := posts.Build(func(p *Post) { p.Status = "draft" })
+
+Primary keys, timestamps managed by gorm and integer fields named like
+foreign keys (ending in ID) are left zero. Relationships are only built
+when registered with HasMany. Build panics when no generated value can
+satisfy the length rules of a field, e.g a uuid with max=10; set such
+fields with Field.
+*/
+package factory
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gorm.io/gorm/schema"
+)
+
+// Default number of records inserted per statement by CreateN
+const DefaultBatchSize = 100
+
+// Generator returns the value of a field for the seq-th record of a factory.
+type Generator func(seq int, r *rand.Rand) any
+
+// Builder builds records of a model. It is implemented by *Factory
+// and used to build related records of a different type.
+type Builder interface {
+	// BuildAny returns a new record as a struct value
+	BuildAny() any
+}
+
+// Factory generates records of T.
+type Factory[T any] struct {
+	// Number of records per insert statement in CreateN
+	BatchSize int
+
+	mu       sync.Mutex
+	rand     *rand.Rand
+	seq      int
+	schema   *schema.Schema
+	fields   map[string]Generator
+	children []child
+}
+
+// a has-many relationship built with the parent
+type child struct {
+	field   *schema.Field
+	n       int
+	builder Builder
+}
+
+var cache sync.Map
+
+// New returns a factory of T whose values are determined by seed.
+// It panics if T is not a struct.
+func New[T any](seed int64) *Factory[T] {
+	s, err := schema.Parse(new(T), &cache, schema.NamingStrategy{})
+	if err != nil {
+		panic(fmt.Sprintf("factory: %v", err))
+	}
+
+	return &Factory[T]{
+		BatchSize: DefaultBatchSize,
+		rand:      rand.New(rand.NewSource(seed)),
+		schema:    s,
+		fields:    make(map[string]Generator),
+	}
+}
+
+// Field sets the generator of the struct field name instead of
+// generating it from the validate tag. It panics if T has no such field.
+func (f *Factory[T]) Field(name string, gen Generator) *Factory[T] {
+	if f.schema.LookUpField(name) == nil {
+		panic(fmt.Sprintf("factory: %s has no field %s", f.schema.Name, name))
+	}
+
+	f.fields[name] = gen
+	return f
+}
+
+// HasMany builds n records with builder for the has-many relationship field.
+// They are inserted with the parent, which sets their foreign keys.
+// It panics if field is not a has-many relationship of T.
+func (f *Factory[T]) HasMany(field string, n int, builder Builder) *Factory[T] {
+	rel, ok := f.schema.Relationships.Relations[field]
+	if !ok || rel.Type != schema.HasMany {
+		panic(fmt.Sprintf("factory: %s is not a has-many relationship of %s", field, f.schema.Name))
+	}
+
+	f.children = append(f.children, child{field: rel.Field, n: n, builder: builder})
+	return f
+}
+
+// Build returns a new record. overrides are applied after the
+// values have been generated.
+func (f *Factory[T]) Build(overrides ...func(*T)) T {
+	f.mu.Lock()
+	f.seq++
+	v := new(T)
+	rv := reflect.ValueOf(v).Elem()
+
+	for _, field := range f.schema.Fields {
+		if gen, ok := f.fields[field.Name]; ok {
+			setValue(field, rv, gen(f.seq, f.rand))
+			continue
+		}
+
+		if skipField(field) {
+			continue
+		}
+
+		if value, ok := generate(field, f.seq, f.rand); ok {
+			setValue(field, rv, value)
+		}
+	}
+	f.mu.Unlock()
+
+	// children lock their own factories
+	for _, c := range f.children {
+		slice := reflect.MakeSlice(c.field.FieldType, 0, c.n)
+		elemType := c.field.FieldType.Elem()
+
+		for i := 0; i < c.n; i++ {
+			elem := reflect.ValueOf(c.builder.BuildAny())
+			if elemType.Kind() == reflect.Pointer {
+				ptr := reflect.New(elem.Type())
+				ptr.Elem().Set(elem)
+				elem = ptr
+			}
+			slice = reflect.Append(slice, elem)
+		}
+		c.field.Set(context.Background(), rv, slice.Interface())
+	}
+
+	for _, override := range overrides {
+		override(v)
+	}
+	return *v
+}
+
+// BuildN returns n new records.
+func (f *Factory[T]) BuildN(n int, overrides ...func(*T)) []T {
+	values := make([]T, n)
+	for i := range values {
+		values[i] = f.Build(overrides...)
+	}
+	return values
+}
+
+// BuildAny implements Builder.
+func (f *Factory[T]) BuildAny() any {
+	return f.Build()
+}
+
+// Create builds a record and inserts it with o.
+func (f *Factory[T]) Create(o orm.ORM, overrides ...func(*T)) (T, error) {
+	v := f.Build(overrides...)
+	if err := o.Insert(&v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// CreateN builds n records and inserts them with o.InsertMany.
+func (f *Factory[T]) CreateN(o orm.ORM, n int, overrides ...func(*T)) ([]T, error) {
+	values := f.BuildN(n, overrides...)
+	if n == 0 {
+		return values, nil
+	}
+
+	if err := o.InsertMany(&values, f.BatchSize); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Sequence returns a generator of fmt.Sprintf(format, seq)
+// e.g Sequence("user%d@example.com").
+func Sequence(format string) Generator {
+	return func(seq int, r *rand.Rand) any {
+		return fmt.Sprintf(format, seq)
+	}
+}
+
+// OneOf returns a generator that picks one of values at random.
+func OneOf(values ...any) Generator {
+	return func(seq int, r *rand.Rand) any {
+		return values[r.Intn(len(values))]
+	}
+}
+
+// returns true for fields that are not generated
+func skipField(field *schema.Field) bool {
+	if field.DBName == "" || field.PrimaryKey || !field.Creatable {
+		return true
+	}
+
+	if field.AutoCreateTime > 0 || field.AutoUpdateTime > 0 {
+		return true
+	}
+
+	// foreign keys are set by gorm or by overrides
+	return strings.HasSuffix(field.Name, "ID") && isInteger(field.IndirectFieldType)
+}
+
+// sets value on field, converting it to the type of the field
+func setValue(field *schema.Field, rv reflect.Value, value any) {
+	if err := field.Set(context.Background(), rv, value); err == nil {
+		return
+	}
+
+	v := reflect.ValueOf(value)
+	if v.IsValid() && v.CanConvert(field.IndirectFieldType) {
+		field.Set(context.Background(), rv, v.Convert(field.IndirectFieldType).Interface())
+	}
+}
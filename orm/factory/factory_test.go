@@ -0,0 +1,178 @@
+package factory_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/factory"
+	"github.com/abiiranathan/gowrap/orm/ormfake"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"github.com/abiiranathan/gowrap/validation"
+)
+
+type Author struct {
+	ID        uint      `gorm:"primaryKey"`
+	Name      string    `validate:"required,max=20"`
+	Email     string    `validate:"required,email"`
+	Bio       *string   `validate:"omitempty,min=30,max=40"`
+	Age       uint8     `validate:"gte=18,lte=99"`
+	Rating    float64   `validate:"gt=0,lt=5"`
+	Role      string    `validate:"oneof=admin editor viewer"`
+	Code      string    `validate:"len=6,alphanum"`
+	Website   string    `validate:"url"`
+	Birthday  string    `validate:"datetime=2006-01-02"`
+	Active    bool      `validate:"required"`
+	CreatedAt time.Time `validate:"-"`
+	Books     []Book
+}
+
+type Book struct {
+	ID       uint   `gorm:"primaryKey"`
+	AuthorID uint   `gorm:"not null"`
+	Title    string `validate:"required,max=255"`
+	Pages    int    `validate:"min=50,max=900"`
+}
+
+func TestFactory(t *testing.T) {
+	t.Parallel()
+
+	books := factory.New[Book](1)
+	authors := factory.New[Author](42).
+		Field("Name", factory.Sequence("Author %d")).
+		HasMany("Books", 2, books)
+
+	built := authors.BuildN(20)
+
+	// generated values satisfy the validate tags
+	validator := validation.NewValidator("validate")
+	if err := validator.Validate(built); err != nil {
+		t.Fatalf("generated authors are invalid: %v", err)
+	}
+
+	for i, author := range built {
+		if author.ID != 0 || !author.CreatedAt.IsZero() {
+			t.Errorf("primary keys and timestamps must not be generated: %+v", author)
+		}
+
+		if len(author.Books) != 2 {
+			t.Fatalf("expected 2 books, got %d", len(author.Books))
+		}
+
+		if err := validator.Validate(author.Books); err != nil {
+			t.Errorf("generated books are invalid: %v", err)
+		}
+
+		if author.Books[0].AuthorID != 0 {
+			t.Errorf("foreign keys must not be generated, got %d", author.Books[0].AuthorID)
+		}
+
+		if want := "Author " + string(rune('1'+i)); i < 9 && author.Name != want {
+			t.Errorf("expected sequence %q, got %q", want, author.Name)
+		}
+	}
+
+	// values are deterministic for a seed
+	again := factory.New[Author](42).
+		Field("Name", factory.Sequence("Author %d")).
+		HasMany("Books", 2, factory.New[Book](1)).
+		BuildN(20)
+
+	if !reflect.DeepEqual(built, again) {
+		t.Error("factories with the same seed generated different values")
+	}
+
+	// overrides are applied last
+	author := authors.Build(func(a *Author) { a.Role = "owner" })
+	if author.Role != "owner" {
+		t.Errorf("override not applied, got %q", author.Role)
+	}
+}
+
+func TestFactoryCreate(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Author{}, &Book{})
+	dborm := orm.New(db)
+
+	authors := factory.New[Author](7).HasMany("Books", 3, factory.New[Book](7))
+	authors.BatchSize = 4
+
+	created, err := authors.CreateN(dborm, 10)
+	if err != nil {
+		t.Fatalf("CreateN failed with error: %v", err)
+	}
+
+	if created[9].ID == 0 || created[9].Books[2].AuthorID != created[9].ID {
+		t.Errorf("records were not inserted with their relationships")
+	}
+
+	ormtest.AssertCount[Author](t, db, 10)
+	ormtest.AssertCount[Book](t, db, 30)
+
+	author, err := authors.Create(dborm, func(a *Author) { a.Email = "jane@example.com" })
+	if err != nil {
+		t.Fatalf("Create failed with error: %v", err)
+	}
+
+	ormtest.AssertExists[Author](t, db, orm.Where{Query: "id = ? AND email = ?", Args: []any{author.ID, "jane@example.com"}})
+
+	// factories work with the in-memory fake
+	fake := ormfake.New()
+	if _, err := factory.New[Book](1).CreateN(fake, 5); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored []Book
+	fake.FindAll(&stored, orm.Where{Query: "title LIKE ?", Args: []any{"%"}})
+	if len(stored) != 5 || strings.TrimSpace(stored[0].Title) == "" {
+		t.Errorf("expected 5 books in fake, got %d", len(stored))
+	}
+}
+
+// length rules of formatted strings and ranges wider than Int63n
+type Limits struct {
+	ID      uint   `gorm:"primaryKey"`
+	Email   string `validate:"required,email,max=16"`
+	Website string `validate:"url,min=40"`
+	Key     string `validate:"uuid,len=36"`
+	Day     string `validate:"datetime=2006-01-02,max=10"`
+	Big     int64  `validate:"min=-9223372036854775808,max=9223372036854775807"`
+	Huge    uint64 `validate:"max=18446744073709551615"`
+	Small   uint8  `validate:"min=250,max=1000"`
+}
+
+type BadUUID struct {
+	ID  uint   `gorm:"primaryKey"`
+	Key string `validate:"uuid,max=10"`
+}
+
+func TestFactoryLimits(t *testing.T) {
+	t.Parallel()
+
+	built := factory.New[Limits](7).BuildN(50)
+	if err := validation.NewValidator("validate").Validate(built); err != nil {
+		t.Fatalf("generated values are invalid: %v", err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for a uuid that can't meet max=10")
+		}
+	}()
+	factory.New[BadUUID](1).Build()
+}
+
+func TestFactoryPanics(t *testing.T) {
+	t.Parallel()
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected a panic for an unknown relationship")
+		}
+	}()
+
+	factory.New[Author](1).HasMany("Name", 1, factory.New[Book](1))
+}
@@ -0,0 +1,285 @@
+package factory
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/schema"
+)
+
+// Struct tag of the validation rules values are generated for
+const ValidateTag = "validate"
+
+// generated times lie in the year after epoch
+var epoch = time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+var (
+	firstNames = []string{"Alice", "Brian", "Carol", "David", "Esther", "Frank", "Grace", "Henry",
+		"Irene", "James", "Kate", "Lucas", "Mary", "Nathan", "Olivia", "Peter", "Ruth", "Samuel"}
+
+	lastNames = []string{"Achieng", "Brown", "Clarke", "Davis", "Evans", "Fischer", "Garcia",
+		"Hughes", "Kato", "Lopez", "Mugisha", "Nakato", "Okello", "Patel", "Smith", "Wright"}
+
+	words = []string{"lorem", "ipsum", "dolor", "sit", "amet", "consectetur", "adipiscing",
+		"elit", "sed", "do", "eiusmod", "tempor", "incididunt", "ut", "labore", "et", "dolore",
+		"magna", "aliqua", "enim", "ad", "minim", "veniam", "quis", "nostrud", "exercitation"}
+)
+
+// validation rules of a field by name e.g max -> 255
+type rules map[string]string
+
+// parses the validate tag of field. Rules of nested values (after dive) are ignored.
+func parseRules(field *schema.Field) rules {
+	r := make(rules)
+	for _, rule := range strings.Split(field.Tag.Get(ValidateTag), ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "dive" {
+			break
+		}
+
+		if name != "" {
+			r[name] = param
+		}
+	}
+	return r
+}
+
+func (r rules) has(name string) bool {
+	_, ok := r[name]
+	return ok
+}
+
+// returns the float parameter of the first of names present
+func (r rules) number(names ...string) (float64, bool) {
+	for _, name := range names {
+		if param, ok := r[name]; ok {
+			if n, err := strconv.ParseFloat(param, 64); err == nil {
+				return n, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// generates a value for field satisfying its validation rules.
+// ok is false for types that are not generated.
+func generate(field *schema.Field, seq int, rnd *rand.Rand) (any, bool) {
+	r := parseRules(field)
+	t := field.IndirectFieldType
+
+	if oneof, ok := r["oneof"]; ok {
+		options := strings.Fields(oneof)
+		if len(options) > 0 {
+			return options[rnd.Intn(len(options))], true
+		}
+	}
+
+	if t == timeType {
+		return epoch.Add(time.Duration(rnd.Int63n(365*24*3600)) * time.Second), true
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return generateString(field.Name, r, seq, rnd), true
+	case reflect.Bool:
+		return r.has("required") || rnd.Intn(2) == 1, true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		low, high := bounds(r, t)
+
+		// the span of wide ranges does not fit Int63n
+		if span := high - low; span < 1<<62 {
+			return low + float64(rnd.Int63n(int64(span)+1)), true
+		}
+		return math.Min(math.Floor(low+rnd.Float64()*(high-low)), high), true
+	case reflect.Float32, reflect.Float64:
+		low, high := bounds(r, t)
+		return math.Round((low+rnd.Float64()*(high-low))*100) / 100, true
+	}
+	return nil, false
+}
+
+// returns the inclusive range of numbers allowed by r
+func bounds(r rules, t reflect.Type) (low, high float64) {
+	low, high = 0, 100
+	if r.has("required") {
+		low = 1
+	}
+
+	integer := isInteger(t)
+	if n, ok := r.number("min", "gte"); ok {
+		low = n
+	} else if n, ok := r.number("gt"); ok {
+		low = n + 0.01
+		if integer {
+			low = n + 1
+		}
+	}
+
+	if n, ok := r.number("max", "lte"); ok {
+		high = n
+	} else if n, ok := r.number("lt"); ok {
+		high = n - 0.01
+		if integer {
+			high = n - 1
+		}
+	}
+
+	if n, ok := r.number("len", "eq"); ok {
+		low, high = n, n
+	}
+
+	if high < low {
+		high = low + 100
+	}
+
+	if integer {
+		min, max := integerRange(t)
+		low = math.Ceil(math.Max(low, min))
+		high = math.Floor(math.Min(high, max))
+		if high < low {
+			high = low
+		}
+	}
+	return low, high
+}
+
+// returns the range of the integer type t. max is below the exclusive
+// limit of t because float64(math.MaxInt64) rounds up and overflows.
+func integerRange(t reflect.Type) (min, max float64) {
+	bits := t.Bits()
+	switch t.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 0, math.Nextafter(math.Ldexp(1, bits), 0)
+	}
+	return -math.Ldexp(1, bits-1), math.Nextafter(math.Ldexp(1, bits-1), 0)
+}
+
+func generateString(name string, r rules, seq int, rnd *rand.Rand) string {
+	first := firstNames[rnd.Intn(len(firstNames))]
+	last := lastNames[rnd.Intn(len(lastNames))]
+	lower := strings.ToLower(name)
+
+	// formatted values only vary in length where it keeps them valid
+	var s string
+	switch {
+	case r.has("email") || strings.Contains(lower, "email"):
+		local := strings.ToLower(first) + "." + strings.ToLower(last)
+		return fitFormat(name, "", local, fmt.Sprintf("%d@example.com", seq), r, rnd)
+	case r.has("url") || r.has("http_url") || r.has("uri"):
+		return fitFormat(name, "https://example.com/", words[rnd.Intn(len(words))], fmt.Sprintf("/%d", seq), r, rnd)
+	case r.has("uuid") || r.has("uuid4"):
+		return fitFormat(name, uuid(rnd), "", "", r, rnd)
+	case r.has("datetime"):
+		layout := r["datetime"]
+		if layout == "" {
+			layout = time.RFC3339
+		}
+		return fitFormat(name, epoch.Add(time.Duration(rnd.Int63n(365*24*3600))*time.Second).Format(layout), "", "", r, rnd)
+	case r.has("numeric") || r.has("number") || strings.Contains(lower, "phone"):
+		s = randomString(rnd, "0123456789", 10)
+	case r.has("alpha"):
+		s = randomString(rnd, "abcdefghijklmnopqrstuvwxyz", 8)
+	case r.has("alphanum"):
+		s = randomString(rnd, "abcdefghijklmnopqrstuvwxyz0123456789", 8)
+	case strings.Contains(lower, "name"):
+		s = first + " " + last
+	default:
+		n := 3 + rnd.Intn(4)
+		parts := make([]string, n)
+		for i := range parts {
+			parts[i] = words[rnd.Intn(len(words))]
+		}
+		s = strings.Join(parts, " ")
+		s = strings.ToUpper(s[:1]) + s[1:]
+	}
+	return fitLength(s, r, rnd)
+}
+
+// returns the range of string lengths allowed by r. high is -1 without a maximum.
+func lengthBounds(r rules) (low, high int) {
+	high = -1
+	if n, ok := r.number("min", "gte", "len"); ok {
+		low = int(n)
+	} else if n, ok := r.number("gt"); ok {
+		low = int(n) + 1
+	} else if r.has("required") {
+		low = 1
+	}
+
+	if n, ok := r.number("max", "lte", "len"); ok {
+		high = int(n)
+	} else if n, ok := r.number("lt"); ok {
+		high = int(n) - 1
+	}
+	return low, high
+}
+
+// pads or truncates s to the length allowed by r
+func fitLength(s string, r rules, rnd *rand.Rand) string {
+	low, high := lengthBounds(r)
+	if high >= 0 && len(s) > high {
+		s = strings.TrimSpace(s[:high])
+	}
+
+	if len(s) < low {
+		s += randomString(rnd, "abcdefghijklmnopqrstuvwxyz", low-len(s))
+	}
+	return s
+}
+
+// pads or truncates body so that head+body+tail has a length allowed by r.
+// Values without a body have a fixed length. It panics if no body fits,
+// e.g for a uuid field with max=10.
+func fitFormat(name, head, body, tail string, r rules, rnd *rand.Rand) string {
+	low, high := lengthBounds(r)
+	fixed := len(head) + len(tail)
+
+	if high >= 0 && fixed+len(body) > high {
+		if fixed > high {
+			panic(fmt.Sprintf("factory: no value of %s fits its length rules, set it with Field", name))
+		}
+		body = body[:high-fixed]
+	}
+
+	if n := fixed + len(body); n < low {
+		if body == "" {
+			panic(fmt.Sprintf("factory: no value of %s fits its length rules, set it with Field", name))
+		}
+		body += randomString(rnd, "abcdefghijklmnopqrstuvwxyz", low-n)
+	}
+	return head + body + tail
+}
+
+func randomString(rnd *rand.Rand, alphabet string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = alphabet[rnd.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// returns a random version 4 uuid
+func uuid(rnd *rand.Rand) string {
+	b := make([]byte, 16)
+	rnd.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
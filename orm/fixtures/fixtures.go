@@ -0,0 +1,397 @@
+/*
+Package fixtures loads YAML or JSON fixture files into database tables for tests.
+
+Each file holds the records of one table and is named after it, e.g posts.yml.
+Records are keyed by a label that other fixtures use to reference them:
+
+	# posts.yml
+	first:
+	  title: My first post
+
+	# comments.yml
+	hello:
+	  post: $posts.first   # sets post_id to the id of posts.first
+	  body: Hello
+
+Fields are matched by column, field or json name. A reference may be assigned
+to a belongs-to relationship (post) or directly to the foreign key (post_id).
+
+	loader := fixtures.New(db, &Post{}, &Comment{})
+	if err := loader.Load("testdata/fixtures"); err != nil {
+		t.Fatal(err)
+	}
+	id := loader.ID("posts.first")
+*/
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Prefix of values that reference other fixtures e.g $posts.first
+const RefPrefix = "$"
+
+var (
+	// A fixture file is for a table that was not registered with New
+	ErrUnknownTable = errors.New("fixtures: unknown table")
+
+	// A reference points to a fixture that does not exist
+	ErrUnknownRef = errors.New("fixtures: unknown reference")
+
+	// Fixtures reference each other in a cycle
+	ErrCyclicRefs = errors.New("fixtures: cyclic references")
+)
+
+// Loader loads fixtures for a set of models.
+type Loader struct {
+	db     *gorm.DB
+	models map[string]*schema.Schema // registered models by table name
+	order  []string                  // tables ordered parents first
+	ids    map[string]any            // primary keys of loaded fixtures by table.label
+}
+
+// a single record of a fixture file
+type record struct {
+	table  string
+	label  string
+	fields []field
+}
+
+type field struct {
+	name  string
+	value any
+}
+
+// New returns a Loader for models. Only tables of registered models can be loaded.
+func New(db *gorm.DB, models ...any) *Loader {
+	l := &Loader{
+		db:     db,
+		models: make(map[string]*schema.Schema, len(models)),
+		ids:    make(map[string]any),
+	}
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			panic(fmt.Sprintf("fixtures: invalid model %T: %v", model, err))
+		}
+		l.models[stmt.Schema.Table] = stmt.Schema
+	}
+
+	l.order = l.sortTables()
+	return l
+}
+
+// ID returns the primary key of a loaded fixture referenced as "table.label".
+// Returns nil if there is no such fixture.
+func (l *Loader) ID(ref string) any {
+	return l.ids[ref]
+}
+
+/*
+Load resets the tables of all registered models and inserts the fixtures
+in paths. A path may be a file or a directory, in which case all .yml, .yaml
+and .json files in it are loaded.
+*/
+func (l *Loader) Load(paths ...string) error {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			switch filepath.Ext(entry.Name()) {
+			case ".yml", ".yaml", ".json":
+				files = append(files, filepath.Join(path, entry.Name()))
+			}
+		}
+	}
+
+	var records []record
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return err
+		}
+
+		table := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		parsed, err := l.parse(table, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		records = append(records, parsed...)
+	}
+
+	if err := l.Reset(); err != nil {
+		return err
+	}
+
+	l.ids = make(map[string]any, len(records))
+	return orm.Transaction(l.db, func(tx *gorm.DB) error {
+		return l.insert(tx, records)
+	})
+}
+
+/*
+Reset deletes all rows from the tables of the registered models
+and resets their auto increment sequences.
+Children are deleted before their parents so that foreign keys are not violated.
+*/
+func (l *Loader) Reset() error {
+	l.ids = make(map[string]any)
+
+	switch l.db.Dialector.Name() {
+	case "postgres":
+		if len(l.order) == 0 {
+			return nil
+		}
+
+		tables := make([]string, len(l.order))
+		for i, table := range l.order {
+			tables[i] = l.db.Statement.Quote(table)
+		}
+		return l.db.Exec("TRUNCATE " + strings.Join(tables, ", ") + " RESTART IDENTITY CASCADE").Error
+	default:
+		return orm.Transaction(l.db, func(tx *gorm.DB) error {
+			for i := len(l.order) - 1; i >= 0; i-- {
+				if err := tx.Exec("DELETE FROM " + tx.Statement.Quote(l.order[i])).Error; err != nil {
+					return err
+				}
+			}
+
+			if l.db.Dialector.Name() == "sqlite" && tx.Migrator().HasTable("sqlite_sequence") {
+				return tx.Exec("DELETE FROM sqlite_sequence WHERE name IN ?", l.order).Error
+			}
+			return nil
+		})
+	}
+}
+
+// parses the labelled records of a fixture file in document order
+func (l *Loader) parse(table string, data []byte) ([]record, error) {
+	if _, ok := l.models[table]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownTable, table)
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("fixtures must be a mapping of labels to records")
+	}
+
+	records := make([]record, 0, len(root.Content)/2)
+	for i := 0; i < len(root.Content); i += 2 {
+		label, body := root.Content[i].Value, root.Content[i+1]
+		if body.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("%s.%s: record must be a mapping of fields", table, label)
+		}
+
+		rec := record{table: table, label: label}
+		for j := 0; j < len(body.Content); j += 2 {
+			var value any
+			if err := body.Content[j+1].Decode(&value); err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", table, label, err)
+			}
+			rec.fields = append(rec.fields, field{name: body.Content[j].Value, value: value})
+		}
+		records = append(records, rec)
+	}
+	return records, nil
+}
+
+// inserts records once the fixtures they reference have been inserted
+func (l *Loader) insert(tx *gorm.DB, records []record) error {
+	for len(records) > 0 {
+		var pending []record
+		for _, rec := range records {
+			if !l.resolvable(rec) {
+				pending = append(pending, rec)
+				continue
+			}
+
+			if err := l.insertRecord(tx, rec); err != nil {
+				return fmt.Errorf("fixtures: %s.%s: %w", rec.table, rec.label, err)
+			}
+		}
+
+		if len(pending) == len(records) {
+			return l.unresolved(pending)
+		}
+		records = pending
+	}
+	return nil
+}
+
+// returns true if all references of rec are loaded
+func (l *Loader) resolvable(rec record) bool {
+	for _, f := range rec.fields {
+		if ref, ok := refOf(f.value); ok {
+			if _, loaded := l.ids[ref]; !loaded {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// reports why records could not be inserted
+func (l *Loader) unresolved(records []record) error {
+	labels := make(map[string]bool, len(records))
+	for _, rec := range records {
+		labels[rec.table+"."+rec.label] = true
+	}
+
+	for _, rec := range records {
+		for _, f := range rec.fields {
+			if ref, ok := refOf(f.value); ok && !labels[ref] {
+				if _, loaded := l.ids[ref]; !loaded {
+					return fmt.Errorf("%w %s%s in %s.%s", ErrUnknownRef, RefPrefix, ref, rec.table, rec.label)
+				}
+			}
+		}
+	}
+	return fmt.Errorf("%w between %d records", ErrCyclicRefs, len(records))
+}
+
+func (l *Loader) insertRecord(tx *gorm.DB, rec record) error {
+	s := l.models[rec.table]
+	rv := reflect.New(s.ModelType)
+	ctx := tx.Statement.Context
+
+	for _, f := range rec.fields {
+		value := f.value
+		if ref, ok := refOf(value); ok {
+			value = l.ids[ref]
+		}
+
+		target := lookupField(s, f.name)
+		if target == nil {
+			return fmt.Errorf("unknown field %q", f.name)
+		}
+
+		// references assigned to belongs-to relationships set the foreign key
+		if rel, ok := s.Relationships.Relations[target.Name]; ok {
+			if len(rel.References) != 1 || rel.References[0].OwnPrimaryKey {
+				return fmt.Errorf("field %q is not a belongs-to relationship", f.name)
+			}
+			target = rel.References[0].ForeignKey
+		}
+
+		if err := target.Set(ctx, rv.Elem(), value); err != nil {
+			return fmt.Errorf("field %q: %w", f.name, err)
+		}
+	}
+
+	if err := tx.Create(rv.Interface()).Error; err != nil {
+		return err
+	}
+
+	if pk := s.PrioritizedPrimaryField; pk != nil {
+		id, _ := pk.ValueOf(ctx, rv.Elem())
+		l.ids[rec.table+"."+rec.label] = id
+	}
+	return nil
+}
+
+// finds a field by column, field or json name
+func lookupField(s *schema.Schema, name string) *schema.Field {
+	if f := s.LookUpField(name); f != nil {
+		return f
+	}
+
+	for _, f := range s.Fields {
+		jsonName, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if jsonName == name || strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+// returns "table.label" if value is a reference
+func refOf(value any) (string, bool) {
+	s, ok := value.(string)
+	if !ok || !strings.HasPrefix(s, RefPrefix) || !strings.Contains(s, ".") {
+		return "", false
+	}
+	return strings.TrimPrefix(s, RefPrefix), true
+}
+
+// orders registered tables so that tables referenced by foreign keys
+// come before the tables holding the foreign keys.
+func (l *Loader) sortTables() []string {
+	tables := make([]string, 0, len(l.models))
+	parents := make(map[string][]string, len(l.models))
+
+	for table, s := range l.models {
+		tables = append(tables, table)
+		for _, rel := range s.Relationships.Relations {
+			for _, ref := range rel.References {
+				if ref.PrimaryKey == nil {
+					continue
+				}
+
+				child, parent := ref.ForeignKey.Schema.Table, ref.PrimaryKey.Schema.Table
+				if child != parent && l.models[child] != nil && l.models[parent] != nil {
+					parents[child] = append(parents[child], parent)
+				}
+			}
+		}
+	}
+	sort.Strings(tables)
+
+	var (
+		order   []string
+		visited = make(map[string]bool, len(tables))
+		visit   func(table string)
+	)
+
+	visit = func(table string) {
+		if visited[table] {
+			return
+		}
+		visited[table] = true
+
+		sort.Strings(parents[table])
+		for _, parent := range parents[table] {
+			visit(parent)
+		}
+		order = append(order, table)
+	}
+
+	for _, table := range tables {
+		visit(table)
+	}
+	return order
+}
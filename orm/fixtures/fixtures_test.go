@@ -0,0 +1,119 @@
+package fixtures_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/fixtures"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+type Author struct {
+	ID    uint   `json:"id" gorm:"primaryKey"`
+	Name  string `json:"name"`
+	Email string `json:"email" gorm:"unique"`
+}
+
+type Post struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Title       string    `json:"title"`
+	AuthorID    uint      `json:"author_id"`
+	Author      Author    `json:"author"`
+	PublishedAt time.Time `json:"published_at"`
+	Comments    []Comment `json:"comments"`
+}
+
+type Comment struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	PostID uint   `json:"post_id"`
+	Post   *Post  `json:"post"`
+	Body   string `json:"body"`
+}
+
+func TestLoad(t *testing.T) {
+	db := orm.ConnectToSqlite3(orm.MemorySQLiteDB, false)
+	if err := db.AutoMigrate(&Author{}, &Post{}, &Comment{}); err != nil {
+		t.Fatalf("unable to to run gorm automigrate: %v", err)
+	}
+
+	loader := fixtures.New(db, &Comment{}, &Post{}, &Author{})
+
+	// loading twice resets the tables in between
+	for i := 0; i < 2; i++ {
+		if err := loader.Load("testdata/fixtures"); err != nil {
+			t.Fatalf("Load failed with error: %v", err)
+		}
+	}
+
+	dborm := orm.New(db)
+	posts := []Post{}
+	err := dborm.FindAll(&posts, orm.Preload{Query: "Author"}, orm.Preload{Query: "Comments"}, orm.Order{Name: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(posts) != 2 {
+		t.Fatalf("expected 2 posts, got %d", len(posts))
+	}
+
+	first := posts[0]
+	if first.ID != 1 || loader.ID("posts.first") != first.ID {
+		t.Errorf("sequences were not reset or ids not recorded: %d, %v", first.ID, loader.ID("posts.first"))
+	}
+
+	if first.Author.Name != "Jane Doe" || posts[1].Author.Name != "John Doe" {
+		t.Errorf("author references not resolved: %+v", posts)
+	}
+
+	if len(first.Comments) != 2 {
+		t.Errorf("expected 2 comments on first post, got %d", len(first.Comments))
+	}
+
+	if !first.PublishedAt.Equal(time.Date(2022, time.October, 1, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected published_at: %v", first.PublishedAt)
+	}
+
+	if err := loader.Reset(); err != nil {
+		t.Fatal(err)
+	}
+
+	count, _ := orm.Count[Author](db)
+	if count != 0 {
+		t.Errorf("expected no authors after reset, got %d", count)
+	}
+}
+
+func TestLoadEvents(t *testing.T) {
+	db := ormtest.NewDB(t, &Author{}, &Post{}, &Comment{})
+	bus := orm.NewBus(orm.BusOptions{})
+	if err := bus.Register(db); err != nil {
+		t.Fatal(err)
+	}
+
+	var created int
+	orm.Subscribe(bus, func(e orm.Event[Author]) { created++ })
+
+	if err := fixtures.New(db, &Comment{}, &Post{}, &Author{}).Load("testdata/fixtures"); err != nil {
+		t.Fatalf("Load failed with error: %v", err)
+	}
+
+	if created != 2 {
+		t.Errorf("expected 2 created events for the authors, got %d", created)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	db := ormtest.NewDB(t, &Author{}, &Post{}, &Comment{})
+
+	err := fixtures.New(db, &Post{}, &Comment{}).Load("testdata/invalid/comments.yml")
+	if !errors.Is(err, fixtures.ErrUnknownRef) {
+		t.Errorf("expected ErrUnknownRef, got %v", err)
+	}
+
+	err = fixtures.New(db, &Comment{}).Load("testdata/fixtures/posts.yml")
+	if !errors.Is(err, fixtures.ErrUnknownTable) {
+		t.Errorf("expected ErrUnknownTable, got %v", err)
+	}
+}
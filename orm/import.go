@@ -0,0 +1,592 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/abiiranathan/gowrap/validation"
+	"github.com/go-playground/validator/v10"
+	"gorm.io/gorm"
+)
+
+// Controls how an Importer handles rejected rows.
+type ImportMode int
+
+const (
+	// Nothing is inserted if any row is rejected.
+	AllOrNothing ImportMode = iota
+
+	// Valid rows are inserted and rejected rows are reported.
+	BestEffort
+)
+
+// Layouts tried in order when importing time.Time values.
+var ImportTimeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+}
+
+// A rejected row of an import.
+type RowError struct {
+	Line    int    // line of a CSV file or position of a JSON record, starting at 1
+	Field   string // json name of the field or the input column, empty for errors of the whole row
+	Message string // why the row was rejected
+}
+
+func (e RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Message)
+}
+
+// Result of an import.
+type ImportReport struct {
+	Total    int        // number of rows read
+	Inserted int        // number of rows inserted
+	Errors   []RowError // errors of rejected rows
+}
+
+// Rejected returns the number of rejected rows.
+func (r *ImportReport) Rejected() int {
+	lines := make(map[int]bool, len(r.Errors))
+	for _, e := range r.Errors {
+		lines[e.Line] = true
+	}
+	return len(lines)
+}
+
+/*
+Importer loads CSV or JSON records into the table of T.
+
+Input columns are matched to fields by json name or field name, ignoring case.
+Each row is converted, validated with Validator and inserted in batches
+inside a transaction.
+
+	importer := orm.Importer[Customer]{DB: db, Mode: orm.BestEffort}
+	report, err := importer.ImportCSV(ctx, file)
+	for _, rowErr := range report.Errors {
+		log.Println(rowErr)
+	}
+
+The returned error is only set for failures of the import itself,
+rejected rows are listed in the report. Rows that all fail to insert with
+the same error, other than a constraint violation, fail the import.
+*/
+type Importer[T any] struct {
+	DB *gorm.DB
+
+	// Validates each row. Default: validation.NewValidator("validate")
+	Validator validation.Validator
+
+	// AllOrNothing (default) or BestEffort
+	Mode ImportMode
+
+	// Number of rows per insert, default: 100
+	BatchSize int
+
+	// Maps input columns to json names of fields e.g {"E-mail": "email"}
+	Mapping map[string]string
+
+	// Ignore input columns that do not match any field.
+	// By default they are reported as an error.
+	IgnoreUnknown bool
+}
+
+// an input record that has been converted into T
+type importRow[T any] struct {
+	line  int
+	value T
+}
+
+// ImportCSV imports records from CSV with a header row.
+// Empty cells are imported as zero values or nil pointers.
+func (im *Importer[T]) ImportCSV(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	cr := csv.NewReader(r)
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("import: reading header: %w", err)
+	}
+
+	columns, err := im.columns(header)
+	if err != nil {
+		return nil, err
+	}
+
+	return im.run(ctx, func(emit emitFunc) error {
+		for {
+			record, err := cr.Read()
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) && parseErr.Err == csv.ErrFieldCount {
+					line := parseErr.StartLine
+					err = emit(line, func(reflect.Value) []RowError {
+						return []RowError{{Line: line, Message: "wrong number of fields"}}
+					})
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				return err
+			}
+
+			line, _ := cr.FieldPos(0)
+			err = emit(line, func(rv reflect.Value) []RowError {
+				var errs []RowError
+				for i, cell := range record {
+					if columns[i] == nil {
+						continue
+					}
+
+					field := settableField(rv, columns[i].index)
+					if err := setFromString(field, cell); err != nil {
+						errs = append(errs, RowError{Line: line, Field: columns[i].name, Message: err.Error()})
+					}
+				}
+				return errs
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// ImportJSON imports records from a JSON array of objects or from
+// newline delimited JSON objects.
+func (im *Importer[T]) ImportJSON(ctx context.Context, r io.Reader) (*ImportReport, error) {
+	dec := json.NewDecoder(r)
+
+	// peek at the first token to detect arrays
+	var buffered bytes.Buffer
+	first, err := dec.Token()
+	if err == io.EOF {
+		return &ImportReport{}, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("import: %w", err)
+	}
+
+	isArray := first == json.Delim('[')
+	if !isArray && first != json.Delim('{') {
+		return nil, fmt.Errorf("import: expected JSON objects or an array of objects, got %v", first)
+	}
+
+	if !isArray {
+		// restart decoding with the consumed opening brace
+		buffered.WriteString("{")
+		dec = json.NewDecoder(io.MultiReader(&buffered, dec.Buffered(), r))
+	}
+
+	columns, err := exportColumns(reflect.TypeOf(new(T)).Elem(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return im.run(ctx, func(emit emitFunc) error {
+		for line := 1; ; line++ {
+			if isArray && !dec.More() {
+				return nil
+			}
+
+			var object map[string]json.RawMessage
+			err := dec.Decode(&object)
+			if err == io.EOF {
+				return nil
+			}
+
+			if err != nil {
+				return fmt.Errorf("import: record %d: %w", line, err)
+			}
+
+			n := line
+			err = emit(n, func(rv reflect.Value) []RowError {
+				var errs []RowError
+				for key, raw := range object {
+					column, err := im.lookupColumn(columns, key)
+					if err != nil {
+						errs = append(errs, RowError{Line: n, Field: key, Message: err.Error()})
+						continue
+					}
+
+					if column == nil {
+						continue
+					}
+
+					field := settableField(rv, column.index)
+					if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+						errs = append(errs, RowError{Line: n, Field: column.name, Message: conversionMessage(err)})
+					}
+				}
+				return errs
+			})
+
+			if err != nil {
+				return err
+			}
+		}
+	})
+}
+
+// receives a converter for each input row, see Importer.run
+type emitFunc func(line int, convert func(rv reflect.Value) []RowError) error
+
+// converts, validates and inserts the rows produced by read
+func (im *Importer[T]) run(ctx context.Context, read func(emit emitFunc) error) (*ImportReport, error) {
+	report := &ImportReport{}
+	v := im.Validator
+	if v == nil {
+		v = validation.NewValidator("validate")
+	}
+
+	batchSize := im.BatchSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
+
+	columns, err := exportColumns(reflect.TypeOf(new(T)).Elem(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = Transaction(im.DB.WithContext(ctx), func(tx *gorm.DB) error {
+		batch := make([]importRow[T], 0, batchSize)
+
+		flush := func() error {
+			if len(batch) == 0 {
+				return nil
+			}
+
+			// no point inserting rows that will be rolled back
+			if im.Mode == AllOrNothing && len(report.Errors) > 0 {
+				batch = batch[:0]
+				return nil
+			}
+
+			inserted, errs, err := im.insert(tx, batch)
+			report.Inserted += inserted
+			report.Errors = append(report.Errors, errs...)
+			batch = batch[:0]
+			return err
+		}
+
+		err := read(func(line int, convert func(rv reflect.Value) []RowError) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			report.Total++
+			row := importRow[T]{line: line}
+			errs := convert(reflect.ValueOf(&row.value).Elem())
+			if len(errs) == 0 {
+				errs = validationErrors(v.Validate(&row.value), line, columns)
+			}
+
+			if len(errs) > 0 {
+				report.Errors = append(report.Errors, errs...)
+				return nil
+			}
+
+			batch = append(batch, row)
+			if len(batch) < batchSize {
+				return nil
+			}
+			return flush()
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if err := flush(); err != nil {
+			return err
+		}
+
+		if im.Mode == AllOrNothing && len(report.Errors) > 0 {
+			return errRejectedRows
+		}
+		return nil
+	})
+
+	if err != nil {
+		report.Inserted = 0
+		if errors.Is(err, errRejectedRows) {
+			return report, nil
+		}
+		return report, err
+	}
+	return report, nil
+}
+
+// rolls back imports in AllOrNothing mode
+var errRejectedRows = errors.New("import: rejected rows")
+
+// inserts a batch of rows. A failing batch is retried row by row inside
+// savepoints so that the failing rows are reported with their line.
+func (im *Importer[T]) insert(tx *gorm.DB, batch []importRow[T]) (int, []RowError, error) {
+	values := make([]T, len(batch))
+	for i, row := range batch {
+		values[i] = row.value
+	}
+
+	var (
+		inserted int
+		errs     []RowError
+	)
+
+	err := tx.Transaction(func(batchTx *gorm.DB) error {
+		return New(batchTx).Insert(&values)
+	})
+
+	if err == nil {
+		return len(values), nil, nil
+	}
+
+	var rowErr error // the error of every failed row, if they are all the same
+	for i := range batch {
+		err := tx.Transaction(func(rowTx *gorm.DB) error {
+			return New(rowTx).Insert(&batch[i].value)
+		})
+
+		if err != nil {
+			// the import itself failed, not the row
+			if ctxErr := tx.Statement.Context.Err(); ctxErr != nil {
+				return inserted, errs, ctxErr
+			}
+
+			if i == 0 || (rowErr != nil && rowErr.Error() == err.Error()) {
+				rowErr = err
+			} else {
+				rowErr = nil
+			}
+
+			errs = append(errs, RowError{Line: batch[i].line, Message: err.Error()})
+			continue
+		}
+		inserted++
+		rowErr = nil
+	}
+
+	// every row failing the same way for a reason other than its values
+	// e.g a missing table, fails the import
+	if rowErr != nil && !isRowError(rowErr) {
+		return 0, nil, fmt.Errorf("import: %w", rowErr)
+	}
+	return inserted, errs, nil
+}
+
+// returns true if err is caused by the values of a row: a validation error,
+// a constraint violation or invalid data
+func isRowError(err error) bool {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		return true
+	}
+
+	// postgres errors of class 22 (data exception) or 23 (integrity constraint violation)
+	var pgErr interface{ SQLState() string }
+	if errors.As(err, &pgErr) {
+		state := pgErr.SQLState()
+		return strings.HasPrefix(state, "22") || strings.HasPrefix(state, "23")
+	}
+
+	// sqlite reports constraint violations e.g "UNIQUE constraint failed: users.email"
+	return strings.Contains(err.Error(), "constraint failed")
+}
+
+// returns the field of v at index like fieldByIndex, allocating the nil
+// embedded pointers on the way so that the field can be set
+func settableField(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
+
+// maps header columns to fields of T. Unmapped columns are nil.
+func (im *Importer[T]) columns(header []string) ([]*exportColumn, error) {
+	all, err := exportColumns(reflect.TypeOf(new(T)).Elem(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]*exportColumn, len(header))
+	for i, name := range header {
+		column, err := im.lookupColumn(all, name)
+		if err != nil {
+			return nil, fmt.Errorf("import: %w", err)
+		}
+		columns[i] = column
+	}
+	return columns, nil
+}
+
+func (im *Importer[T]) lookupColumn(columns []exportColumn, name string) (*exportColumn, error) {
+	name = strings.TrimSpace(name)
+	if mapped, ok := im.Mapping[name]; ok {
+		name = mapped
+	}
+
+	for i := range columns {
+		if strings.EqualFold(columns[i].name, name) {
+			return &columns[i], nil
+		}
+	}
+
+	if im.IgnoreUnknown {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown column %q", name)
+}
+
+// converts validator.ValidationErrors into row errors with json field names
+func validationErrors(err error, line int, columns []exportColumn) []RowError {
+	if err == nil {
+		return nil
+	}
+
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return []RowError{{Line: line, Message: err.Error()}}
+	}
+
+	errs := make([]RowError, len(verrs))
+	for i, fe := range verrs {
+		field := fe.Field()
+		for _, column := range columns {
+			if column.field == fe.StructField() {
+				field = column.name
+				break
+			}
+		}
+
+		message := "failed on the '" + fe.Tag() + "' rule"
+		if fe.Param() != "" {
+			message = "failed on the '" + fe.Tag() + "=" + fe.Param() + "' rule"
+		}
+		errs[i] = RowError{Line: line, Field: field, Message: message}
+	}
+	return errs
+}
+
+// strips the type details of json conversion errors
+func conversionMessage(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return fmt.Sprintf("cannot convert %s to %s", typeErr.Value, typeErr.Type)
+	}
+	return err.Error()
+}
+
+var scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+
+// sets v from the text s of a CSV cell
+func setFromString(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Pointer {
+		if strings.TrimSpace(s) == "" {
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+
+		elem := reflect.New(v.Type().Elem())
+		if err := setFromString(elem.Elem(), s); err != nil {
+			return err
+		}
+		v.Set(elem)
+		return nil
+	}
+
+	if v.Addr().Type().Implements(scannerType) {
+		if s == "" {
+			return v.Addr().Interface().(sql.Scanner).Scan(nil)
+		}
+		return v.Addr().Interface().(sql.Scanner).Scan(s)
+	}
+
+	if v.Type() == timeType {
+		if strings.TrimSpace(s) == "" {
+			v.Set(reflect.Zero(timeType))
+			return nil
+		}
+
+		for _, layout := range ImportTimeLayouts {
+			if t, err := time.Parse(layout, strings.TrimSpace(s)); err == nil {
+				v.Set(reflect.ValueOf(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("invalid time %q", s)
+	}
+
+	s = strings.TrimSpace(s)
+	if s == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			switch strings.ToLower(s) {
+			case "yes", "y":
+				b = true
+			case "no", "n":
+				b = false
+			default:
+				return fmt.Errorf("invalid boolean %q", s)
+			}
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", s)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", s)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", s)
+		}
+		v.SetFloat(n)
+	default:
+		return json.Unmarshal([]byte(s), v.Addr().Interface())
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package orm_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+// embedded by pointer to check that importing allocates it
+type Address struct {
+	City string `json:"city"`
+}
+
+type Contact struct {
+	*Address
+	ID       uint       `json:"id" gorm:"primaryKey"`
+	Name     string     `json:"name" validate:"required,max=10"`
+	Email    string     `json:"email" gorm:"unique" validate:"required,email"`
+	Age      int        `json:"age" validate:"gte=0,lte=150"`
+	Active   bool       `json:"active"`
+	JoinedAt *time.Time `json:"joined_at"`
+}
+
+func TestImportCSV(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Contact{})
+
+	input := "Name,E-mail,age,active,joined_at,city\n" +
+		"Alice,alice@example.com,30,yes,2022-10-01,Kampala\n" +
+		"Bob,not-an-email,forty,true,,\n" +
+		"Carol,carol@example.com,200,false,,\n" +
+		"Dave,alice@example.com,20,no,,\n" +
+		"Eve,eve@example.com,25,true,2022-10-02T10:00:00Z,\n"
+
+	ctx := context.Background()
+	importer := orm.Importer[Contact]{
+		DB:        db,
+		Mapping:   map[string]string{"E-mail": "email"},
+		BatchSize: 2,
+	}
+
+	// all or nothing
+	report, err := importer.ImportCSV(ctx, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("import failed with error: %v", err)
+	}
+
+	if report.Total != 5 || report.Inserted != 0 || report.Rejected() != 2 {
+		t.Errorf("unexpected all or nothing report: %+v", report)
+	}
+
+	count, _ := orm.Count[Contact](db)
+	if count != 0 {
+		t.Errorf("expected no contacts after rejected import, got %d", count)
+	}
+
+	// Bob has an invalid age, validation is skipped until conversion succeeds
+	if e := report.Errors[0]; e.Line != 3 || e.Field != "age" {
+		t.Errorf("unexpected conversion error: %v", e)
+	}
+
+	if e := report.Errors[1]; e.Line != 4 || e.Field != "age" || e.Message != "failed on the 'lte=150' rule" {
+		t.Errorf("unexpected validation error: %v", e)
+	}
+
+	// best effort, the duplicate email of Dave is rejected by the database
+	importer.Mode = orm.BestEffort
+	report, err = importer.ImportCSV(ctx, strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("import failed with error: %v", err)
+	}
+
+	if report.Inserted != 2 || report.Rejected() != 3 {
+		t.Errorf("unexpected best effort report: %+v", report)
+	}
+
+	contacts := []Contact{}
+	orm.New(db).FindAll(&contacts, orm.Order{Name: "id"})
+	if len(contacts) != 2 || contacts[0].Name != "Alice" || !contacts[0].Active || contacts[0].JoinedAt == nil {
+		t.Errorf("unexpected imported contacts: %+v", contacts)
+	}
+	ormtest.AssertExists[Contact](t, db, orm.Where{Query: "name = ? AND city = ?", Args: []any{"Alice", "Kampala"}})
+
+	// database errors are reported with their line in all or nothing mode
+	importer.Mode = orm.AllOrNothing
+	report, err = importer.ImportCSV(ctx, strings.NewReader("name,email\nZoe,zoe@example.com\nAl,alice@example.com\n"))
+	if err != nil {
+		t.Fatalf("import failed with error: %v", err)
+	}
+
+	if report.Inserted != 0 || len(report.Errors) != 1 || report.Errors[0].Line != 3 {
+		t.Errorf("expected the duplicate email on line 3 to be rejected, got %+v", report)
+	}
+	ormtest.AssertCount[Contact](t, db, 2)
+
+	// unknown columns
+	_, err = importer.ImportCSV(ctx, strings.NewReader("name,phone\nx,1\n"))
+	if err == nil {
+		t.Errorf("expected error for unknown column")
+	}
+}
+
+func TestImportJSON(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Contact{})
+
+	ctx := context.Background()
+	importer := orm.Importer[Contact]{DB: db, Mode: orm.BestEffort}
+
+	report, err := importer.ImportJSON(ctx, strings.NewReader(`[
+		{"name": "Alice", "email": "alice@example.com", "age": 30, "city": "Gulu"},
+		{"name": "Bob", "email": "bob@example.com", "age": "thirty"}
+	]`))
+
+	if err != nil {
+		t.Fatalf("import failed with error: %v", err)
+	}
+
+	if report.Inserted != 1 || len(report.Errors) != 1 || report.Errors[0].Line != 2 || report.Errors[0].Field != "age" {
+		t.Errorf("unexpected json array report: %+v", report)
+	}
+	ormtest.AssertExists[Contact](t, db, orm.Where{Query: "name = ? AND city = ?", Args: []any{"Alice", "Gulu"}})
+
+	report, err = importer.ImportJSON(ctx, strings.NewReader(
+		`{"name": "Carol", "email": "carol@example.com"}`+"\n"+
+			`{"name": "Dave", "email": "dave@example.com", "joined_at": "2022-10-01T00:00:00Z"}`+"\n"))
+
+	if err != nil {
+		t.Fatalf("import failed with error: %v", err)
+	}
+
+	if report.Total != 2 || report.Inserted != 2 {
+		t.Errorf("unexpected ndjson report: %+v", report)
+	}
+
+	for _, input := range []string{`"name"`, `42`, `null`} {
+		if _, err := importer.ImportJSON(ctx, strings.NewReader(input)); err == nil {
+			t.Errorf("expected an error importing %s", input)
+		}
+	}
+}
+
+func TestImportFailure(t *testing.T) {
+	t.Parallel()
+
+	// the contacts table does not exist, so no row can be inserted
+	db := ormtest.NewDB(t)
+
+	ctx := context.Background()
+	input := "name,email\nAlice,alice@example.com\nBob,bob@example.com\n"
+
+	for _, mode := range []orm.ImportMode{orm.AllOrNothing, orm.BestEffort} {
+		importer := orm.Importer[Contact]{DB: db, Mode: mode}
+		report, err := importer.ImportCSV(ctx, strings.NewReader(input))
+		if err == nil || report.Inserted != 0 || len(report.Errors) != 0 {
+			t.Errorf("expected the import to fail in mode %v, got %+v, err: %v", mode, report, err)
+		}
+	}
+
+	// the same constraint violation on every row rejects the rows
+	db = ormtest.NewDB(t, &Contact{})
+	importer := orm.Importer[Contact]{DB: db, Mode: orm.BestEffort}
+	importer.ImportCSV(ctx, strings.NewReader(input))
+
+	report, err := importer.ImportCSV(ctx, strings.NewReader(input))
+	if err != nil || report.Inserted != 0 || len(report.Errors) != 2 {
+		t.Errorf("expected 2 rejected rows, got %+v, err: %v", report, err)
+	}
+}
@@ -0,0 +1,138 @@
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// ErrStop can be returned from the callbacks of FindInBatches and Each
+// to stop iterating early. It is not returned to the caller.
+var ErrStop = errors.New("stop iteration")
+
+/*
+FindInBatches queries records of T matching the conditions batchSize rows at a
+time and calls fn with each batch, so that only one batch is held in memory.
+
+Batches are ordered by primary key; do not pass Order conditions.
+Iteration stops when ctx is cancelled or fn returns an error.
+Return ErrStop from fn to stop early without an error.
+
+	err := orm.FindInBatches(ctx, db, 500, func(posts []Post) error {
+		return export(posts)
+	}, orm.Where{Query: "published = ?", Args: []any{true}})
+*/
+func FindInBatches[T any](ctx context.Context, db *gorm.DB, batchSize int, fn func(batch []T) error, conditions ...Condition) error {
+	var batch []T
+
+	tx := applyConditions(db.WithContext(ctx).Model(new(T)), conditions...)
+	err := tx.FindInBatches(&batch, batchSize, func(*gorm.DB, int) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(batch)
+	}).Error
+
+	if errors.Is(err, ErrStop) {
+		return nil
+	}
+	return err
+}
+
+// Each calls fn for every record of T matching the conditions,
+// reading one row at a time from the database.
+// Return ErrStop from fn to stop early without an error.
+//
+// Preload conditions are not applied to rows read this way.
+// Use FindInBatches if you need to preload relationships.
+func Each[T any](ctx context.Context, db *gorm.DB, fn func(value T) error, conditions ...Condition) error {
+	rows, err := Iterate[T](ctx, db, conditions...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := fn(rows.Value()); err != nil {
+			if errors.Is(err, ErrStop) {
+				return nil
+			}
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+/*
+Rows is a typed iterator over the results of a query.
+
+	rows, err := orm.Iterate[Post](ctx, db, orm.Order{Name: "created_at"})
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		post := rows.Value()
+		...
+	}
+	return rows.Err()
+
+Rows must be closed, it holds a database connection until then.
+Breaking out of the loop early is safe as long as Close is called.
+*/
+type Rows[T any] struct {
+	db    *gorm.DB
+	rows  *sql.Rows
+	value T
+	err   error
+}
+
+// Iterate queries records of T matching the conditions and returns an iterator
+// over the results. The query is cancelled when ctx is done.
+func Iterate[T any](ctx context.Context, db *gorm.DB, conditions ...Condition) (*Rows[T], error) {
+	tx := applyConditions(db.WithContext(ctx).Model(new(T)), conditions...)
+	rows, err := tx.Rows()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Rows[T]{db: db.WithContext(ctx), rows: rows}, nil
+}
+
+// Next prepares the next value for reading with Value.
+// It returns false when there are no more rows or an error occurred.
+func (r *Rows[T]) Next() bool {
+	if r.err != nil || !r.rows.Next() {
+		return false
+	}
+
+	var value T
+	if err := r.db.ScanRows(r.rows, &value); err != nil {
+		r.err = err
+		return false
+	}
+
+	r.value = value
+	return true
+}
+
+// Value returns the current row.
+func (r *Rows[T]) Value() T {
+	return r.value
+}
+
+// Err returns the error, if any, that was encountered during iteration.
+func (r *Rows[T]) Err() error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.rows.Err()
+}
+
+// Close releases the underlying rows. It is safe to call Close more than once.
+func (r *Rows[T]) Close() error {
+	return r.rows.Close()
+}
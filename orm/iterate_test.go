@@ -0,0 +1,105 @@
+package orm_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+func TestIteration(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{})
+
+	posts := make([]Post, 25)
+	for i := range posts {
+		posts[i].Title = fmt.Sprintf("post %d", i+1)
+	}
+	db.Create(&posts)
+
+	ctx := context.Background()
+
+	// batches
+	var batches, total int
+	err := orm.FindInBatches(ctx, db, 10, func(batch []Post) error {
+		batches++
+		total += len(batch)
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("FindInBatches failed with error: %v", err)
+	}
+
+	if batches != 3 || total != 25 {
+		t.Errorf("expected 3 batches of 25 posts, got %d batches of %d posts", batches, total)
+	}
+
+	// conditions are honoured and ErrStop exits early without error
+	batches = 0
+	err = orm.FindInBatches(ctx, db, 5, func(batch []Post) error {
+		batches++
+		if batch[0].ID <= 10 {
+			t.Errorf("where condition not applied, got post %d", batch[0].ID)
+		}
+		return orm.ErrStop
+	}, orm.Where{Query: "id > ?", Args: []any{10}})
+
+	if err != nil || batches != 1 {
+		t.Errorf("expected ErrStop to stop after 1 batch, got %d batches, err: %v", batches, err)
+	}
+
+	// context cancellation
+	cancelCtx, cancel := context.WithCancel(ctx)
+	err = orm.FindInBatches(cancelCtx, db, 10, func(batch []Post) error {
+		cancel()
+		return nil
+	})
+
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	// Each
+	var titles []string
+	err = orm.Each(ctx, db, func(post Post) error {
+		titles = append(titles, post.Title)
+		if len(titles) == 3 {
+			return orm.ErrStop
+		}
+		return nil
+	}, orm.Order{Name: "id DESC"})
+
+	if err != nil || len(titles) != 3 || titles[0] != "post 25" {
+		t.Errorf("unexpected Each results: %v, err: %v", titles, err)
+	}
+
+	failure := errors.New("failed")
+	err = orm.Each(ctx, db, func(post Post) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Errorf("expected callback error to be returned, got %v", err)
+	}
+
+	// typed iterator
+	rows, err := orm.Iterate[Post](ctx, db, orm.Where{Query: "id <= ?", Args: []any{5}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	count := 0
+	for rows.Next() {
+		count++
+		if post := rows.Value(); post.ID != uint(count) {
+			t.Errorf("expected post %d, got %d", count, post.ID)
+		}
+	}
+
+	if rows.Err() != nil || count != 5 {
+		t.Errorf("expected 5 rows, got %d, err: %v", count, rows.Err())
+	}
+}
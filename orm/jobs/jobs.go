@@ -0,0 +1,203 @@
+/*
+Package jobs is a durable background job queue stored in the database.
+
+Jobs are enqueued with a kind and a payload encoded as JSON, possibly in
+the transaction of the write that requires them:
+
+	type Welcome struct{ UserID uint }
+
+	err := jobs.Migrate(db)
+	_, err = jobs.Enqueue(ctx, tx, "welcome", Welcome{UserID: user.ID}, jobs.Options{Priority: 10})
+
+Workers run the handlers registered for each kind:
+
+	worker := jobs.NewWorker(db, jobs.WorkerOptions{Concurrency: 4})
+	jobs.Handle(worker, "welcome", func(ctx context.Context, w Welcome) error {
+		return sendWelcomeEmail(ctx, w.UserID)
+	})
+	go worker.Run(ctx)
+
+Failed jobs are retried with backoff until they reach their maximum number
+of attempts, then they are dead and kept for inspection with List, Retry
+and Cancel. Jobs of workers that crashed are claimed again once their
+lease expires, so handlers may run more than once and should be idempotent.
+An expired lease counts as an attempt: a job that has none left is dead.
+*/
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// No job has the given id
+	ErrJobNotFound = errors.New("job not found")
+
+	// The job is not in a state allowing the operation
+	ErrInvalidState = errors.New("invalid job state")
+)
+
+// Name of the table of jobs.
+const TableName = "orm_jobs"
+
+// Number of attempts of jobs enqueued without MaxAttempts.
+const DefaultMaxAttempts = 5
+
+// State of a job.
+type Status string
+
+const (
+	Pending   Status = "pending"   // waiting for its run time
+	Running   Status = "running"   // claimed by a worker
+	Succeeded Status = "succeeded" // handled without error
+	Dead      Status = "dead"      // failed on its last attempt
+	Canceled  Status = "canceled"  // canceled before it ran
+)
+
+// Job is a row of the jobs table.
+type Job struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	Kind        string          `json:"kind" gorm:"not null;index"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      Status          `json:"status" gorm:"not null;index:idx_orm_jobs_claim,priority:1"`
+	Priority    int             `json:"priority"` // higher runs first
+	RunAt       time.Time       `json:"run_at" gorm:"index:idx_orm_jobs_claim,priority:2"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	LastError   string          `json:"last_error"`
+	LockedBy    string          `json:"locked_by"`    // claim of the worker running the job
+	LockedUntil *time.Time      `json:"locked_until"` // end of the lease of the claim
+	FinishedAt  *time.Time      `json:"finished_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+func (Job) TableName() string {
+	return TableName
+}
+
+// Migrate creates or updates the jobs table.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Job{})
+}
+
+// Options of an enqueued job.
+type Options struct {
+	RunAt       time.Time // defaults to now
+	Priority    int       // higher runs first
+	MaxAttempts int       // defaults to DefaultMaxAttempts
+}
+
+// Enqueue adds a job of kind with payload encoded as JSON.
+func Enqueue[T any](ctx context.Context, db *gorm.DB, kind string, payload T, opts Options) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("jobs: unable to encode payload of %s: %w", kind, err)
+	}
+
+	if opts.RunAt.IsZero() {
+		opts.RunAt = time.Now()
+	}
+
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = DefaultMaxAttempts
+	}
+
+	job := &Job{
+		Kind:        kind,
+		Payload:     data,
+		Status:      Pending,
+		Priority:    opts.Priority,
+		RunAt:       opts.RunAt.UTC(), // times are compared as text on sqlite
+		MaxAttempts: opts.MaxAttempts,
+	}
+
+	if err := db.WithContext(ctx).Create(job).Error; err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Filter selects the jobs returned by List.
+type Filter struct {
+	Kind   string // all kinds if empty
+	Status Status // all states if empty
+	Limit  int    // no limit if zero
+	Offset int
+}
+
+// List returns the jobs matching filter, most recent first.
+func List(ctx context.Context, db *gorm.DB, filter Filter) ([]Job, error) {
+	query := db.WithContext(ctx).Model(&Job{}).Order("id DESC")
+	if filter.Kind != "" {
+		query = query.Where("kind = ?", filter.Kind)
+	}
+
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+
+	var jobs []Job
+	err := query.Find(&jobs).Error
+	return jobs, err
+}
+
+// Retry schedules a dead or canceled job to run now,
+// with all its attempts available again.
+func Retry(ctx context.Context, db *gorm.DB, id uint) error {
+	return transition(ctx, db, id, []Status{Dead, Canceled}, map[string]any{
+		"status":       Pending,
+		"run_at":       time.Now().UTC(),
+		"attempts":     0,
+		"finished_at":  nil,
+		"locked_by":    "",
+		"locked_until": nil,
+	})
+}
+
+// Cancel prevents a pending job from running.
+func Cancel(ctx context.Context, db *gorm.DB, id uint) error {
+	now := time.Now().UTC()
+	return transition(ctx, db, id, []Status{Pending}, map[string]any{
+		"status":      Canceled,
+		"finished_at": &now,
+	})
+}
+
+// updates the job if it is in one of the states from
+func transition(ctx context.Context, db *gorm.DB, id uint, from []Status, updates map[string]any) error {
+	tx := db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND status IN ?", id, from).
+		Updates(updates)
+
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 1 {
+		return nil
+	}
+
+	var job Job
+	if err := db.WithContext(ctx).First(&job, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %d", ErrJobNotFound, id)
+		}
+		return err
+	}
+	return fmt.Errorf("%w: job %d is %s", ErrInvalidState, id, job.Status)
+}
@@ -0,0 +1,203 @@
+package jobs_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm/jobs"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/gorm"
+)
+
+type Email struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+}
+
+func newDB(t *testing.T) *gorm.DB {
+	db := ormtest.NewDB(t)
+	if err := jobs.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func TestWorker(t *testing.T) {
+	t.Parallel()
+
+	db := newDB(t)
+	ctx := context.Background()
+
+	jobs.Enqueue(ctx, db, "email", Email{To: "low@example.com"}, jobs.Options{})
+	jobs.Enqueue(ctx, db, "email", Email{To: "high@example.com"}, jobs.Options{Priority: 10})
+	jobs.Enqueue(ctx, db, "email", Email{To: "later@example.com"}, jobs.Options{RunAt: time.Now().Add(time.Hour)})
+	jobs.Enqueue(ctx, db, "sms", Email{To: "unhandled"}, jobs.Options{})
+
+	var sent []string
+	worker := jobs.NewWorker(db, jobs.WorkerOptions{})
+	jobs.Handle(worker, "email", func(ctx context.Context, e Email) error {
+		sent = append(sent, e.To)
+		return nil
+	})
+
+	for {
+		ran, err := worker.RunOnce(ctx)
+		if err != nil {
+			t.Fatalf("RunOnce failed with error: %v", err)
+		}
+
+		if !ran {
+			break
+		}
+	}
+
+	if len(sent) != 2 || sent[0] != "high@example.com" || sent[1] != "low@example.com" {
+		t.Errorf("expected ready jobs by priority, got %v", sent)
+	}
+
+	succeeded, err := jobs.List(ctx, db, jobs.Filter{Status: jobs.Succeeded})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(succeeded) != 2 || succeeded[0].Attempts != 1 || succeeded[0].FinishedAt == nil || succeeded[0].LockedBy != "" {
+		t.Errorf("unexpected succeeded jobs: %+v", succeeded)
+	}
+
+	pending, _ := jobs.List(ctx, db, jobs.Filter{Kind: "email", Status: jobs.Pending})
+	if len(pending) != 1 {
+		t.Fatalf("expected 1 pending email, got %+v", pending)
+	}
+
+	if err := jobs.Cancel(ctx, db, pending[0].ID); err != nil {
+		t.Errorf("Cancel failed with error: %v", err)
+	}
+
+	if err := jobs.Cancel(ctx, db, pending[0].ID); !errors.Is(err, jobs.ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState canceling a canceled job, got %v", err)
+	}
+
+	if err := jobs.Cancel(ctx, db, 100); !errors.Is(err, jobs.ErrJobNotFound) {
+		t.Errorf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestWorkerRetries(t *testing.T) {
+	t.Parallel()
+
+	db := newDB(t)
+	ctx := context.Background()
+
+	job, err := jobs.Enqueue(ctx, db, "flaky", 1, jobs.Options{MaxAttempts: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	worker := jobs.NewWorker(db, jobs.WorkerOptions{Backoff: func(int) time.Duration { return 0 }})
+	jobs.Handle(worker, "flaky", func(ctx context.Context, n int) error {
+		panic("boom")
+	})
+
+	for i := 0; i < 3; i++ {
+		worker.RunOnce(ctx)
+	}
+
+	dead, _ := jobs.List(ctx, db, jobs.Filter{Status: jobs.Dead})
+	if len(dead) != 1 || dead[0].Attempts != 2 || dead[0].LastError != "panic: boom" {
+		t.Fatalf("expected dead job after 2 attempts, got %+v", dead)
+	}
+
+	if err := jobs.Retry(ctx, db, job.ID); err != nil {
+		t.Fatalf("Retry failed with error: %v", err)
+	}
+
+	jobs.Handle(worker, "flaky", func(ctx context.Context, n int) error { return nil })
+	if ran, err := worker.RunOnce(ctx); !ran || err != nil {
+		t.Errorf("expected retried job to run, got %v, %v", ran, err)
+	}
+
+	if err := jobs.Retry(ctx, db, job.ID); !errors.Is(err, jobs.ErrInvalidState) {
+		t.Errorf("expected ErrInvalidState retrying a succeeded job, got %v", err)
+	}
+}
+
+func TestWorkerRun(t *testing.T) {
+	t.Parallel()
+
+	db := newDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var handled int32
+	worker := jobs.NewWorker(db, jobs.WorkerOptions{Concurrency: 2, PollInterval: 10 * time.Millisecond})
+	jobs.Handle(worker, "count", func(ctx context.Context, n int) error {
+		if atomic.AddInt32(&handled, 1) == 5 {
+			cancel()
+		}
+		return nil
+	})
+
+	for i := 0; i < 5; i++ {
+		jobs.Enqueue(ctx, db, "count", i, jobs.Options{})
+	}
+
+	done := make(chan error)
+	go func() { done <- worker.Run(ctx) }()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("expected context canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker did not run the jobs")
+	}
+
+	if n := atomic.LoadInt32(&handled); n != 5 {
+		t.Errorf("expected each job to run once, got %d runs", n)
+	}
+}
+
+func TestWorkerExpiredLease(t *testing.T) {
+	t.Parallel()
+
+	db := newDB(t)
+	ctx := context.Background()
+	jobs.Enqueue(ctx, db, "report", "daily", jobs.Options{})
+
+	// a worker crashed while running the job
+	expired := time.Now().Add(-time.Minute).UTC()
+	db.Model(&jobs.Job{}).Where("1 = 1").Updates(map[string]any{
+		"status": jobs.Running, "attempts": 1, "locked_by": "crashed", "locked_until": expired,
+	})
+
+	worker := jobs.NewWorker(db, jobs.WorkerOptions{})
+	jobs.Handle(worker, "report", func(ctx context.Context, s string) error { return nil })
+
+	if ran, err := worker.RunOnce(ctx); !ran || err != nil {
+		t.Fatalf("expected job with expired lease to run, got %v, %v", ran, err)
+	}
+
+	done, _ := jobs.List(ctx, db, jobs.Filter{Status: jobs.Succeeded})
+	if len(done) != 1 || done[0].Attempts != 2 {
+		t.Errorf("unexpected jobs: %+v", done)
+	}
+
+	// a lease lost on the last attempt does not run the job again
+	job, _ := jobs.Enqueue(ctx, db, "report", "weekly", jobs.Options{MaxAttempts: 2})
+	db.Model(job).Updates(map[string]any{
+		"status": jobs.Running, "attempts": 2, "locked_by": "crashed", "locked_until": expired,
+	})
+
+	if ran, err := worker.RunOnce(ctx); ran || err != nil {
+		t.Fatalf("expected exhausted job not to run, got %v, %v", ran, err)
+	}
+
+	dead, _ := jobs.List(ctx, db, jobs.Filter{Status: jobs.Dead})
+	if len(dead) != 1 || dead[0].ID != job.ID || dead[0].Attempts != 2 || dead[0].LastError == "" {
+		t.Errorf("expected the exhausted job to be dead, got %+v", dead)
+	}
+}
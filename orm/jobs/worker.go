@@ -0,0 +1,286 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// WorkerOptions configure a worker.
+type WorkerOptions struct {
+	// Number of jobs run at the same time. Defaults to 1.
+	Concurrency int
+
+	// How long to wait before looking for jobs again when none is ready.
+	// Defaults to one second.
+	PollInterval time.Duration
+
+	// How long a job may run before other workers consider its worker
+	// dead and claim it again. Defaults to five minutes.
+	Lease time.Duration
+
+	// Returns the delay before the next attempt of a job that failed
+	// its attempt-th attempt. Defaults to Backoff.
+	Backoff func(attempt int) time.Duration
+}
+
+// Backoff doubles the delay between attempts, from one second up to an hour.
+func Backoff(attempt int) time.Duration {
+	if attempt > 12 {
+		return time.Hour
+	}
+
+	delay := time.Second << (attempt - 1)
+	if delay > time.Hour {
+		return time.Hour
+	}
+	return delay
+}
+
+type handler func(ctx context.Context, payload json.RawMessage) error
+
+// Worker claims and runs jobs of the kinds it handles.
+type Worker struct {
+	db   *gorm.DB
+	opts WorkerOptions
+	id   string
+
+	mu       sync.RWMutex
+	handlers map[string]handler
+}
+
+// NewWorker returns a worker of the jobs of db.
+// Register handlers with Handle before calling Run.
+func NewWorker(db *gorm.DB, opts WorkerOptions) *Worker {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	if opts.Lease <= 0 {
+		opts.Lease = 5 * time.Minute
+	}
+
+	if opts.Backoff == nil {
+		opts.Backoff = Backoff
+	}
+
+	return &Worker{db: db, opts: opts, id: randomID(), handlers: make(map[string]handler)}
+}
+
+// Handle registers fn to run the jobs of kind with payloads decoded into T.
+func Handle[T any](w *Worker, kind string, fn func(ctx context.Context, payload T) error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.handlers[kind] = func(ctx context.Context, data json.RawMessage) error {
+		var payload T
+		if err := json.Unmarshal(data, &payload); err != nil {
+			return fmt.Errorf("jobs: unable to decode payload of %s: %w", kind, err)
+		}
+		return fn(ctx, payload)
+	}
+}
+
+func (w *Worker) kinds() []string {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	kinds := make([]string, 0, len(w.handlers))
+	for kind := range w.handlers {
+		kinds = append(kinds, kind)
+	}
+	return kinds
+}
+
+// Run runs jobs until ctx is done. Jobs that are running when ctx is done
+// see their context canceled and are retried according to their attempts.
+func (w *Worker) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < w.opts.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.loop(ctx)
+		}()
+	}
+
+	wg.Wait()
+	return ctx.Err()
+}
+
+func (w *Worker) loop(ctx context.Context) {
+	for ctx.Err() == nil {
+		ran, err := w.RunOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("jobs: %v", err)
+		}
+
+		if ran && err == nil {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(w.opts.PollInterval):
+		}
+	}
+}
+
+// RunOnce claims and runs a single ready job. It reports whether
+// a job was run; its failure is recorded and not returned.
+func (w *Worker) RunOnce(ctx context.Context) (bool, error) {
+	job, err := w.claim(ctx)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	w.mu.RLock()
+	handle := w.handlers[job.Kind]
+	w.mu.RUnlock()
+
+	jobCtx, cancel := context.WithTimeout(ctx, w.opts.Lease)
+	err = run(jobCtx, handle, job.Payload)
+	cancel()
+
+	// recorded even if ctx is done
+	return true, w.finish(context.Background(), job, err)
+}
+
+// runs the handler, turning panics into errors
+func run(ctx context.Context, handle handler, payload json.RawMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handle(ctx, payload)
+}
+
+// jobs that are ready or whose worker lost its lease with attempts left
+func ready(db *gorm.DB, kinds []string, now time.Time) *gorm.DB {
+	return db.Model(&Job{}).
+		Where("kind IN ?", kinds).
+		Where("(status = ? AND run_at <= ?) OR (status = ? AND locked_until <= ? AND attempts < max_attempts)",
+			Pending, now, Running, now).
+		Order("priority DESC, run_at, id")
+}
+
+// marks as dead the jobs whose worker lost its lease on their last attempt.
+// locked_by is kept so that the worker can still record the outcome.
+func bury(db *gorm.DB, kinds []string, now time.Time) error {
+	return db.Model(&Job{}).
+		Where("kind IN ? AND status = ? AND locked_until <= ? AND attempts >= max_attempts", kinds, Running, now).
+		Updates(map[string]any{
+			"status":       Dead,
+			"last_error":   "lease expired on the last attempt",
+			"locked_until": nil,
+			"finished_at":  &now,
+		}).Error
+}
+
+// claims the next ready job, or returns nil if there is none
+func (w *Worker) claim(ctx context.Context) (*Job, error) {
+	kinds := w.kinds()
+	if len(kinds) == 0 {
+		return nil, nil
+	}
+
+	db := w.db.WithContext(ctx)
+	now := time.Now().UTC()
+	claim := w.id + "-" + randomID()
+	lockedUntil := now.Add(w.opts.Lease)
+
+	if err := bury(db, kinds, now); err != nil {
+		return nil, err
+	}
+
+	updates := map[string]any{
+		"status":       Running,
+		"attempts":     gorm.Expr("attempts + 1"),
+		"locked_by":    claim,
+		"locked_until": lockedUntil,
+	}
+
+	var job Job
+	if db.Dialector.Name() == "postgres" {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			err := ready(tx, kinds, now).
+				Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Limit(1).Take(&job).Error
+			if err != nil {
+				return err
+			}
+			return tx.Model(&job).Updates(updates).Error
+		})
+
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		job.Status = Running
+		job.Attempts++
+		job.LockedBy = claim
+		job.LockedUntil = &lockedUntil
+		return &job, nil
+	}
+
+	// the row is claimed by a single atomic update, in which the
+	// subquery and the update see the same snapshot of the table
+	next := ready(db.Session(&gorm.Session{NewDB: true}), kinds, now).Select("id").Limit(1)
+	tx := db.Model(&Job{}).Where("id = (?)", next).Updates(updates)
+	if tx.Error != nil || tx.RowsAffected == 0 {
+		return nil, tx.Error
+	}
+
+	if err := db.Where("locked_by = ?", claim).Take(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// records the outcome of the attempt, unless the job was claimed again
+func (w *Worker) finish(ctx context.Context, job *Job, err error) error {
+	now := time.Now().UTC()
+	updates := map[string]any{"locked_by": "", "locked_until": nil}
+
+	switch {
+	case err == nil:
+		updates["status"] = Succeeded
+		updates["finished_at"] = &now
+	case job.Attempts >= job.MaxAttempts:
+		updates["status"] = Dead
+		updates["last_error"] = err.Error()
+		updates["finished_at"] = &now
+	default:
+		updates["status"] = Pending
+		updates["last_error"] = err.Error()
+		updates["run_at"] = now.Add(w.opts.Backoff(job.Attempts))
+	}
+
+	return w.db.WithContext(ctx).Model(&Job{}).
+		Where("id = ? AND locked_by = ?", job.ID, job.LockedBy).
+		Updates(updates).Error
+}
+
+func randomID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
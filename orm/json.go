@@ -0,0 +1,372 @@
+package orm
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+/*
+JSON is a column holding a JSON document, stored as jsonb on postgres
+and as text on sqlite.
+
+	type Product struct {
+		ID   uint
+		Meta orm.JSON
+	}
+
+	meta, err := orm.NewJSON(map[string]any{"color": "red", "sizes": []int{40, 42}})
+
+Its documents are queried with JSONPath, JSONContains and JSONHasKey.
+*/
+type JSON json.RawMessage
+
+// NewJSON returns the JSON encoding of v.
+func NewJSON(v any) (JSON, error) {
+	data, err := json.Marshal(v)
+	return JSON(data), err
+}
+
+// Unmarshal decodes the document into v.
+func (j JSON) Unmarshal(v any) error {
+	return json.Unmarshal(j, v)
+}
+
+// Value implements driver.Valuer. An empty document is stored as NULL.
+func (j JSON) Value() (driver.Value, error) {
+	if len(j) == 0 {
+		return nil, nil
+	}
+	return string(j), nil
+}
+
+// Scan implements sql.Scanner.
+func (j *JSON) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*j = nil
+	case []byte:
+		*j = append(JSON(nil), v...)
+	case string:
+		*j = JSON(v)
+	default:
+		return fmt.Errorf("json: cannot scan %T", value)
+	}
+	return nil
+}
+
+func (j JSON) MarshalJSON() ([]byte, error) {
+	if len(j) == 0 {
+		return []byte("null"), nil
+	}
+	return j, nil
+}
+
+func (j *JSON) UnmarshalJSON(data []byte) error {
+	*j = append(JSON(nil), data...)
+	return nil
+}
+
+func (JSON) GormDataType() string {
+	return "json"
+}
+
+func (JSON) GormDBDataType(db *gorm.DB, field *schema.Field) string {
+	if db.Dialector.Name() == "postgres" {
+		return "JSONB"
+	}
+	return "JSON"
+}
+
+/*
+JSONField is a value inside the JSON documents of a column, selected by
+a dotted path. Numeric keys index arrays.
+
+	err := dborm.FindAll(&products,
+		orm.JSONPath("meta", "color").Eq("red"),
+		orm.JSONPath("meta", "dimensions.width").Gt(10),
+		orm.JSONPath("meta", "sizes.0").Asc(),
+	)
+
+Strings are compared as text, numbers numerically and booleans as booleans,
+depending on the type of the value compared with. Fields that are missing
+or null are matched by Eq(nil).
+*/
+type JSONField struct {
+	Column string   // column of the documents, may be qualified by its table
+	Path   []string // keys of the value, from the root of the document
+}
+
+// JSONPath returns the field of column at path e.g "dimensions.width".
+func JSONPath(column, path string) JSONField {
+	return JSONField{Column: column, Path: strings.Split(path, ".")}
+}
+
+func (f JSONField) Eq(v any) Condition  { return f.compare("=", v) }
+func (f JSONField) Ne(v any) Condition  { return f.compare("<>", v) }
+func (f JSONField) Gt(v any) Condition  { return f.compare(">", v) }
+func (f JSONField) Gte(v any) Condition { return f.compare(">=", v) }
+func (f JSONField) Lt(v any) Condition  { return f.compare("<", v) }
+func (f JSONField) Lte(v any) Condition { return f.compare("<=", v) }
+
+// Asc orders the results by the field in ascending order.
+func (f JSONField) Asc() Condition { return jsonOrder{f, false} }
+
+// Desc orders the results by the field in descending order.
+func (f JSONField) Desc() Condition { return jsonOrder{f, true} }
+
+func (f JSONField) compare(op string, v any) Condition {
+	return conditionFunc(func(db *gorm.DB) *gorm.DB {
+		if v == nil {
+			if op != "=" && op != "<>" {
+				db.AddError(fmt.Errorf("json: cannot compare %s null", op))
+				return db
+			}
+
+			value, err := f.text(db)
+			if err != nil {
+				db.AddError(err)
+				return db
+			}
+
+			if op == "=" {
+				return db.Where("? IS NULL", value)
+			}
+			return db.Where("? IS NOT NULL", value)
+		}
+
+		value, err := f.typed(db, v)
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+		return db.Where("? "+op+" ?", value, v)
+	})
+}
+
+// returns the field as text, or as SQL NULL if it is missing or null
+func (f JSONField) text(db *gorm.DB) (clause.Expr, error) {
+	column := clause.Column{Name: f.Column}
+	switch db.Dialector.Name() {
+	case "postgres":
+		return clause.Expr{SQL: "(? #>> ?)", Vars: []any{column, postgresPath(f.Path)}}, nil
+	case "sqlite":
+		return clause.Expr{SQL: "json_extract(?, ?)", Vars: []any{column, sqlitePath(f.Path)}}, nil
+	}
+	return clause.Expr{}, fmt.Errorf("json: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+}
+
+// returns the field cast to the SQL type of v on postgres. sqlite
+// extracts values with their own type.
+func (f JSONField) typed(db *gorm.DB, v any) (clause.Expr, error) {
+	value, err := f.text(db)
+	if err != nil || db.Dialector.Name() != "postgres" {
+		return value, err
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		value.SQL += "::numeric"
+	case reflect.Bool:
+		value.SQL += "::boolean"
+	}
+	return value, nil
+}
+
+// orders results by a JSON field
+type jsonOrder struct {
+	field JSONField
+	desc  bool
+}
+
+func (o jsonOrder) Apply(db *gorm.DB) *gorm.DB {
+	value, err := o.field.text(db)
+	if err != nil {
+		db.AddError(err)
+		return db
+	}
+
+	// jsonb values order numbers numerically, unlike their text
+	if db.Dialector.Name() == "postgres" {
+		value.SQL = "(? #> ?)"
+	}
+
+	direction := " ASC"
+	if o.desc {
+		direction = " DESC"
+	}
+
+	return db.Clauses(clause.OrderBy{Expression: clause.Expr{
+		SQL:                "?" + direction,
+		Vars:               []any{value},
+		WithoutParentheses: true,
+	}})
+}
+
+/*
+JSONContains filters records whose document in column contains v: objects
+contain the members of v and arrays contain its elements, recursively.
+
+	orm.JSONContains("meta", map[string]any{"color": "red", "sizes": []int{42}})
+
+It compiles to @> on postgres and to json_extract and json_each lookups
+on sqlite.
+*/
+func JSONContains(column string, v any) Condition {
+	return conditionFunc(func(db *gorm.DB) *gorm.DB {
+		data, err := json.Marshal(v)
+		if err != nil {
+			db.AddError(err)
+			return db
+		}
+
+		col := clause.Column{Name: column}
+		switch db.Dialector.Name() {
+		case "postgres":
+			return db.Where("? @> ?::jsonb", col, string(data))
+		case "sqlite":
+			var doc any
+			if err := decodeJSON(data, &doc); err != nil {
+				db.AddError(err)
+				return db
+			}
+
+			c := &sqliteContains{}
+			return db.Where(c.expr(col, nil, doc))
+		}
+
+		db.AddError(fmt.Errorf("json: %w %q", ErrUnsupportedDialect, db.Dialector.Name()))
+		return db
+	})
+}
+
+// builds sqlite containment tests, naming the json_each tables it uses
+type sqliteContains struct {
+	tables int
+}
+
+// returns the test that doc at path contains v
+func (c *sqliteContains) expr(doc any, path []string, v any) clause.Expr {
+	switch v := v.(type) {
+	case map[string]any:
+		exprs := []clause.Expression{clause.Expr{SQL: "json_type(?, ?) = 'object'", Vars: []any{doc, sqlitePath(path)}}}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			exprs = append(exprs, c.expr(doc, append(path[:len(path):len(path)], key), v[key]))
+		}
+		return clause.Expr{SQL: "?", Vars: []any{clause.And(exprs...)}}
+	case []any:
+		exprs := []clause.Expression{clause.Expr{SQL: "json_type(?, ?) = 'array'", Vars: []any{doc, sqlitePath(path)}}}
+		for _, element := range v {
+			c.tables++
+			table := "je" + strconv.Itoa(c.tables)
+			exprs = append(exprs, clause.Expr{
+				SQL:  fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(?, ?) AS %s WHERE ?)", table),
+				Vars: []any{doc, sqlitePath(path), c.element(table, element)},
+			})
+		}
+		return clause.Expr{SQL: "?", Vars: []any{clause.And(exprs...)}}
+	case nil:
+		return clause.Expr{SQL: "json_type(?, ?) = 'null'", Vars: []any{doc, sqlitePath(path)}}
+	case bool:
+		return clause.Expr{SQL: "json_type(?, ?) = ?", Vars: []any{doc, sqlitePath(path), strconv.FormatBool(v)}}
+	case json.Number:
+		// compared as numbers, 1 matches 1.0
+		n, _ := v.Float64()
+		return clause.Expr{SQL: "json_extract(?, ?) = ?", Vars: []any{doc, sqlitePath(path), n}}
+	}
+	return clause.Expr{SQL: "json_extract(?, ?) = ?", Vars: []any{doc, sqlitePath(path), v}}
+}
+
+// returns the test that the row of a json_each table matches v
+func (c *sqliteContains) element(table string, v any) clause.Expr {
+	switch v := v.(type) {
+	case map[string]any, []any:
+		// containers are JSON text, unlike scalars
+		return c.expr(clause.Expr{SQL: table + ".value"}, nil, v)
+	case nil:
+		return clause.Expr{SQL: table + ".type = 'null'"}
+	case bool:
+		return clause.Expr{SQL: table + ".type = ?", Vars: []any{strconv.FormatBool(v)}}
+	case json.Number:
+		n, _ := v.Float64()
+		return clause.Expr{SQL: table + ".atom = ?", Vars: []any{n}}
+	}
+	return clause.Expr{SQL: table + ".atom = ?", Vars: []any{v}}
+}
+
+/*
+JSONHasKey filters records whose document in column has a member at path,
+which may be nested e.g "dimensions.width". Members set to null count.
+*/
+func JSONHasKey(column, path string) Condition {
+	return conditionFunc(func(db *gorm.DB) *gorm.DB {
+		keys := strings.Split(path, ".")
+		col := clause.Column{Name: column}
+
+		switch db.Dialector.Name() {
+		case "postgres":
+			parent := clause.Expr{SQL: "?", Vars: []any{col}}
+			if len(keys) > 1 {
+				parent = clause.Expr{SQL: "(? #> ?)", Vars: []any{col, postgresPath(keys[:len(keys)-1])}}
+			}
+
+			// the ? operator would be taken for a placeholder
+			key := keys[len(keys)-1]
+			if _, err := strconv.Atoi(key); err == nil {
+				return db.Where("jsonb_typeof(?) = 'array' AND jsonb_array_length(?) > ?", parent, parent, key)
+			}
+			return db.Where("jsonb_typeof(?) = 'object' AND jsonb_exists(?, ?)", parent, parent, key)
+		case "sqlite":
+			return db.Where("json_type(?, ?) IS NOT NULL", col, sqlitePath(keys))
+		}
+
+		db.AddError(fmt.Errorf("json: %w %q", ErrUnsupportedDialect, db.Dialector.Name()))
+		return db
+	})
+}
+
+// returns path as a postgres text array e.g {dimensions,"a b"}
+func postgresPath(path []string) string {
+	keys := make([]string, len(path))
+	for i, key := range path {
+		keys[i] = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key) + `"`
+	}
+	return "{" + strings.Join(keys, ",") + "}"
+}
+
+// returns path as a sqlite JSON path e.g $."dimensions"[0]
+func sqlitePath(path []string) string {
+	var b strings.Builder
+	b.WriteString("$")
+	for _, key := range path {
+		if _, err := strconv.ParseUint(key, 10, 64); err == nil {
+			b.WriteString("[" + key + "]")
+		} else {
+			b.WriteString(`."` + strings.ReplaceAll(key, `"`, `\"`) + `"`)
+		}
+	}
+	return b.String()
+}
+
+// adapts a function to a Condition
+type conditionFunc func(db *gorm.DB) *gorm.DB
+
+func (f conditionFunc) Apply(db *gorm.DB) *gorm.DB {
+	return f(db)
+}
@@ -0,0 +1,125 @@
+package orm_test
+
+import (
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type Product struct {
+	ID   uint
+	Name string
+	Meta orm.JSON
+}
+
+func TestJSONQueries(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Product{})
+	dborm := orm.New(db)
+
+	for name, meta := range map[string]any{
+		"shoe":  map[string]any{"color": "red", "size": 42, "tags": []string{"sale", "new"}, "dims": map[string]any{"width": 10}},
+		"shirt": map[string]any{"color": "blue", "size": 9.5, "tags": []string{"new"}, "active": true},
+		"hat":   map[string]any{"color": "red", "size": 7, "dims": map[string]any{"width": nil}},
+		"bag":   nil,
+	} {
+		var doc orm.JSON
+		if meta != nil {
+			var err error
+			if doc, err = orm.NewJSON(meta); err != nil {
+				t.Fatal(err)
+			}
+		}
+		dborm.Insert(&Product{Name: name, Meta: doc})
+	}
+
+	tests := []struct {
+		name       string
+		conditions []orm.Condition
+		want       []string
+	}{
+		{"Eq", []orm.Condition{orm.JSONPath("meta", "color").Eq("red"), orm.Order{Name: "name"}}, []string{"hat", "shoe"}},
+		{"Gt", []orm.Condition{orm.JSONPath("meta", "size").Gt(8), orm.Order{Name: "name"}}, []string{"shirt", "shoe"}},
+		{"Bool", []orm.Condition{orm.JSONPath("meta", "active").Eq(true)}, []string{"shirt"}},
+		{"Nested", []orm.Condition{orm.JSONPath("meta", "dims.width").Gte(10)}, []string{"shoe"}},
+		{"Index", []orm.Condition{orm.JSONPath("meta", "tags.0").Eq("new")}, []string{"shirt"}},
+		{"Null", []orm.Condition{orm.JSONPath("meta", "dims.width").Eq(nil), orm.JSONPath("meta", "color").Ne(nil), orm.Order{Name: "name"}}, []string{"hat", "shirt"}},
+		{"Asc", []orm.Condition{orm.JSONPath("meta", "size").Asc(), orm.Where{Query: "meta IS NOT NULL"}}, []string{"hat", "shirt", "shoe"}},
+		{"Desc", []orm.Condition{orm.JSONPath("meta", "size").Desc(), orm.Where{Query: "meta IS NOT NULL"}}, []string{"shoe", "shirt", "hat"}},
+		{"Contains", []orm.Condition{orm.JSONContains("meta", map[string]any{"color": "red", "tags": []string{"sale"}})}, []string{"shoe"}},
+		{"ContainsNumber", []orm.Condition{orm.JSONContains("meta", map[string]any{"size": 42.0})}, []string{"shoe"}},
+		{"HasKey", []orm.Condition{orm.JSONHasKey("meta", "dims.width"), orm.Order{Name: "name"}}, []string{"hat", "shoe"}},
+		{"HasIndex", []orm.Condition{orm.JSONHasKey("meta", "tags.1")}, []string{"shoe"}},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			var products []Product
+			if err := dborm.FindAll(&products, test.conditions...); err != nil {
+				t.Fatalf("FindAll failed with error: %v", err)
+			}
+
+			var got []string
+			for _, p := range products {
+				got = append(got, p.Name)
+			}
+
+			if len(got) != len(test.want) {
+				t.Fatalf("expected %v, got %v", test.want, got)
+			}
+
+			for i := range got {
+				if got[i] != test.want[i] {
+					t.Errorf("expected %v, got %v", test.want, got)
+					break
+				}
+			}
+		})
+	}
+
+	stored := &Product{}
+	dborm.FindOne(stored, orm.Where{Query: "name = ?", Args: []any{"shoe"}})
+
+	var meta struct{ Tags []string }
+	if err := stored.Meta.Unmarshal(&meta); err != nil || len(meta.Tags) != 2 {
+		t.Errorf("unexpected meta %s, err: %v", stored.Meta, err)
+	}
+}
+
+func TestJSONQueriesPostgres(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+		return orm.New(tx).FindAll(&[]Product{},
+			orm.JSONPath("meta", "dims.width").Gt(10),
+			orm.JSONPath("meta", "color").Eq("red"),
+			orm.JSONContains("meta", map[string]any{"tags": []string{"sale"}}),
+			orm.JSONHasKey("meta", "dims.width"),
+			orm.JSONPath("meta", "size").Desc(),
+		)
+	})
+
+	if err != nil {
+		t.Fatalf("FindAll failed with error: %v", err)
+	}
+
+	want := `SELECT * FROM "products" WHERE ("meta" #>> $1)::numeric > $2 AND ("meta" #>> $3) = $4 ` +
+		`AND "meta" @> $5::jsonb AND (jsonb_typeof(("meta" #> $6)) = 'object' AND jsonb_exists(("meta" #> $7), $8)) ` +
+		`ORDER BY ("meta" #> $9) DESC`
+	if len(statements) != 1 || statements[0].SQL != want {
+		t.Errorf("unexpected statements: %v", statements)
+	}
+}
@@ -0,0 +1,233 @@
+package orm
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// The primary key passed in does not match the primary key of the model
+var ErrInvalidKey = errors.New("invalid primary key")
+
+/*
+KeyValues returns the values of the primary key fields of s, in the order
+of s.PrimaryFields, for a key given as:
+
+  - a single value, e.g 1 or "0189c7a2-...", for models with one primary key
+  - a struct with fields named like the primary key fields, which may be the model
+  - a map from field or column names to values
+
+For example, with a composite key:
+
+	type OrderLine struct {
+		OrderID   uint   `gorm:"primaryKey"`
+		ProductID string `gorm:"primaryKey"`
+		Quantity  int
+	}
+
+	err := dborm.First(&line, map[string]any{"order_id": 1, "product_id": "p-42"})
+	err = dborm.First(&line, OrderLine{OrderID: 1, ProductID: "p-42"})
+*/
+func KeyValues(s *schema.Schema, id any) ([]any, error) {
+	if len(s.PrimaryFields) == 0 {
+		return nil, fmt.Errorf("%w: %s has no primary key", ErrInvalidKey, s.Table)
+	}
+
+	rv := reflect.ValueOf(id)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil, fmt.Errorf("%w: nil", ErrInvalidKey)
+		}
+		rv = rv.Elem()
+	}
+
+	_, isValuer := id.(driver.Valuer)
+	switch {
+	case rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String:
+		return mapKeyValues(s, rv)
+	case rv.Kind() == reflect.Struct && !isValuer && rv.Type() != reflect.TypeOf(time.Time{}):
+		return structKeyValues(s, rv)
+	case !rv.IsValid():
+		return nil, fmt.Errorf("%w: nil", ErrInvalidKey)
+	}
+
+	if len(s.PrimaryFields) > 1 {
+		return nil, fmt.Errorf("%w: %s has a composite key, use a struct or map", ErrInvalidKey, s.Table)
+	}
+	return []any{rv.Interface()}, nil
+}
+
+func mapKeyValues(s *schema.Schema, rv reflect.Value) ([]any, error) {
+	if rv.Len() != len(s.PrimaryFields) {
+		return nil, fmt.Errorf("%w: expected %d values for %s, got %d", ErrInvalidKey, len(s.PrimaryFields), s.Table, rv.Len())
+	}
+
+	values := make([]any, len(s.PrimaryFields))
+	for i, pk := range s.PrimaryFields {
+		value := rv.MapIndex(reflect.ValueOf(pk.DBName).Convert(rv.Type().Key()))
+		if !value.IsValid() {
+			value = rv.MapIndex(reflect.ValueOf(pk.Name).Convert(rv.Type().Key()))
+		}
+
+		if !value.IsValid() {
+			return nil, fmt.Errorf("%w: missing %s of %s", ErrInvalidKey, pk.DBName, s.Table)
+		}
+		values[i] = value.Interface()
+	}
+	return values, nil
+}
+
+func structKeyValues(s *schema.Schema, rv reflect.Value) ([]any, error) {
+	values := make([]any, len(s.PrimaryFields))
+	for i, pk := range s.PrimaryFields {
+		if rv.Type() == s.ModelType {
+			values[i], _ = pk.ValueOf(context.Background(), rv)
+			continue
+		}
+
+		field := rv.FieldByName(pk.Name)
+		if !field.IsValid() {
+			return nil, fmt.Errorf("%w: %s has no field %s", ErrInvalidKey, rv.Type(), pk.Name)
+		}
+		values[i] = field.Interface()
+	}
+	return values, nil
+}
+
+// adds the conditions selecting the record with primary key id
+func whereKey(db *gorm.DB, s *schema.Schema, id any) (*gorm.DB, error) {
+	values, err := KeyValues(s, id)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, pk := range s.PrimaryFields {
+		db = db.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: pk.DBName},
+			Value:  values[i],
+		})
+	}
+	return db, nil
+}
+
+// NewUUID returns a random version 7 UUID, whose first 48 bits are the
+// unix time in milliseconds so that keys are ordered by creation time.
+func NewUUID() string {
+	b := timeOrderedBytes()
+	b[6] = 0x70 | b[6]&0x0f // version 7
+	b[8] = 0x80 | b[8]&0x3f // RFC 4122 variant
+
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+// Crockford's base32 alphabet used by ULIDs
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a random ULID, a 26 character key ordered by creation time.
+func NewULID() string {
+	b := timeOrderedBytes()
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+
+	// 128 bits encoded 5 at a time from the end
+	var buf [26]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = ulidAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+// returns 48 bits of unix time in milliseconds followed by 80 random bits
+func timeOrderedBytes() [16]byte {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+
+	if _, err := rand.Read(b[6:]); err != nil {
+		panic("orm: unable to read random bytes: " + err.Error())
+	}
+	return b
+}
+
+// GeneratedKey returns a new key for field if it is tagged `orm:"uuid"`
+// or `orm:"ulid"`, and whether it is tagged.
+func GeneratedKey(field *schema.Field) (string, bool) {
+	switch {
+	case hasTagOption(field, "uuid"):
+		return NewUUID(), true
+	case hasTagOption(field, "ulid"):
+		return NewULID(), true
+	}
+	return "", false
+}
+
+// sets the zero fields of the records of v tagged `orm:"uuid"` or `orm:"ulid"`
+func generateKeys(db *gorm.DB, v any) error {
+	s, err := parseSchema(db, v)
+	if err != nil {
+		return err
+	}
+
+	var fields []*schema.Field
+	for _, field := range s.Fields {
+		if field.DBName != "" && (hasTagOption(field, "uuid") || hasTagOption(field, "ulid")) {
+			fields = append(fields, field)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	ctx := context.Background()
+	rv := indirectValue(v)
+	records := []reflect.Value{rv}
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		records = records[:0]
+		for i := 0; i < rv.Len(); i++ {
+			records = append(records, reflect.Indirect(rv.Index(i)))
+		}
+	}
+
+	for _, record := range records {
+		if !record.IsValid() {
+			continue
+		}
+
+		for _, field := range fields {
+			if _, isZero := field.ValueOf(ctx, record); !isZero {
+				continue
+			}
+
+			key, _ := GeneratedKey(field)
+			if err := field.Set(ctx, record, key); err != nil {
+				return fmt.Errorf("orm: unable to set generated key of %s: %w", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
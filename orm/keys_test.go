@@ -0,0 +1,63 @@
+package orm_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestGeneratedKeysOrder(t *testing.T) {
+	t.Parallel()
+
+	uuid, ulid := orm.NewUUID(), orm.NewULID()
+	time.Sleep(2 * time.Millisecond)
+
+	if next := orm.NewUUID(); next <= uuid || next[19] < '8' || next[19] > 'b' {
+		t.Errorf("expected ordered UUIDv7 of RFC 4122 variant, got %s after %s", next, uuid)
+	}
+
+	next := orm.NewULID()
+	if next <= ulid || len(next) != 26 || next[0] > '7' {
+		t.Errorf("expected ordered ULIDs, got %s after %s", next, ulid)
+	}
+
+	if strings.ContainsAny(next, "ILOU") {
+		t.Errorf("ULID %s is not in Crockford's base32", next)
+	}
+}
+
+type OrderLine struct {
+	OrderID   uint   `gorm:"primaryKey;autoIncrement:false"`
+	ProductID string `gorm:"primaryKey"`
+	Quantity  int
+}
+
+func TestFirstCompositeKeyPostgres(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+		return orm.New(tx).First(&OrderLine{}, map[string]any{"order_id": 1, "product_id": "p-42"})
+	})
+
+	if err != nil {
+		t.Fatalf("First failed with error: %v", err)
+	}
+
+	want := `SELECT * FROM "order_lines" WHERE "order_lines"."order_id" = $1 AND "order_lines"."product_id" = $2 ` +
+		`ORDER BY "order_lines"."order_id" LIMIT 1`
+	if len(statements) != 1 || statements[0].SQL != want {
+		t.Errorf("unexpected statements: %v", statements)
+	}
+}
@@ -0,0 +1,360 @@
+package orm
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// The lock was released or taken over before its lease was renewed
+	ErrLockLost = errors.New("lock lost")
+
+	// The time to live of a lock is not positive
+	ErrInvalidTTL = errors.New("lock ttl must be positive")
+)
+
+// Table holding the leases of locks on sqlite.
+const LockTable = "orm_locks"
+
+// How often Acquire retries to take a lock held by another owner on sqlite.
+var LockRetryInterval = 100 * time.Millisecond
+
+/*
+Lock is a named lock shared by the processes using a database.
+It is renewed in the background until released.
+
+On postgres, the lock is a session advisory lock held by a dedicated
+connection, and is lost when the connection is. On sqlite, the lock is a
+lease in LockTable that expires ttl after its last renewal, so that locks
+of crashed processes are eventually taken over.
+*/
+type Lock struct {
+	Name string
+
+	db    *gorm.DB
+	ttl   time.Duration
+	owner string // unique id of the lease on sqlite
+
+	conn *sql.Conn // holds the advisory lock on postgres
+	key  int64
+
+	mu          sync.Mutex
+	lastRenewed time.Time
+
+	lost     chan struct{}
+	lostOnce sync.Once
+
+	stop        chan struct{}
+	done        chan struct{}
+	releaseOnce sync.Once
+	releaseErr  error
+}
+
+/*
+Acquire blocks until it holds the lock called name or ctx is done.
+
+	lock, err := orm.Acquire(ctx, db, "nightly-report", 30*time.Second)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(context.Background())
+
+	select {
+	case <-lock.Lost():
+		// another process may now hold the lock
+	case <-work:
+	}
+
+The lock is renewed every ttl/3 until Release is called.
+*/
+func Acquire(ctx context.Context, db *gorm.DB, name string, ttl time.Duration) (*Lock, error) {
+	if ttl <= 0 {
+		return nil, ErrInvalidTTL
+	}
+
+	l := &Lock{
+		Name: name,
+		db:   db,
+		ttl:  ttl,
+		lost: make(chan struct{}),
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	var err error
+	switch db.Dialector.Name() {
+	case "postgres":
+		err = l.acquirePostgres(ctx)
+	case "sqlite":
+		err = l.acquireSQLite(ctx)
+	default:
+		err = fmt.Errorf("lock: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	l.lastRenewed = time.Now()
+	go l.renewLoop()
+	return l, nil
+}
+
+/*
+WithLock runs fn while holding the lock called name. The context of fn is
+canceled if the lock is lost, in which case ErrLockLost is returned unless
+fn returns another error.
+
+	err := orm.WithLock(ctx, db, "cleanup", time.Minute, func(ctx context.Context) error {
+		return cleanup(ctx, db.WithContext(ctx))
+	})
+*/
+func WithLock(ctx context.Context, db *gorm.DB, name string, ttl time.Duration, fn func(ctx context.Context) error) error {
+	lock, err := Acquire(ctx, db, name, ttl)
+	if err != nil {
+		return err
+	}
+
+	fnCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	go func() {
+		select {
+		case <-lock.Lost():
+			cancel()
+		case <-fnCtx.Done():
+		}
+	}()
+
+	err = fn(fnCtx)
+	lost := lock.isLost()
+
+	// released with ctx of the caller, which may be done
+	releaseErr := lock.Release(context.Background())
+
+	if err != nil {
+		return err
+	}
+
+	if lost {
+		return ErrLockLost
+	}
+	return releaseErr
+}
+
+// Lost returns a channel closed when the lock is lost.
+// It is not closed by Release.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *Lock) isLost() bool {
+	select {
+	case <-l.lost:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *Lock) markLost() {
+	l.lostOnce.Do(func() { close(l.lost) })
+}
+
+// Renew extends the lease of the lock by its ttl. Locks are renewed
+// automatically; call Renew to check that the lock is still held.
+// It returns ErrLockLost if it is not.
+func (l *Lock) Renew(ctx context.Context) error {
+	if l.isLost() {
+		return ErrLockLost
+	}
+
+	var err error
+	if l.conn != nil {
+		err = l.conn.PingContext(ctx)
+		if err != nil {
+			// the advisory lock does not survive its connection
+			l.markLost()
+			return fmt.Errorf("%w: %v", ErrLockLost, err)
+		}
+	} else {
+		err = l.renewSQLite(ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	l.lastRenewed = time.Now()
+	l.mu.Unlock()
+	return nil
+}
+
+// renews the lock until it is released. The lock is lost when a lease
+// is taken over or could not be renewed within ttl.
+func (l *Lock) renewLoop() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+			err := l.Renew(ctx)
+			cancel()
+
+			if errors.Is(err, ErrLockLost) {
+				return
+			}
+
+			l.mu.Lock()
+			expired := time.Since(l.lastRenewed) >= l.ttl
+			l.mu.Unlock()
+
+			if err != nil && expired {
+				l.markLost()
+				return
+			}
+		}
+	}
+}
+
+// Release stops the renewal of the lock and releases it.
+// Calling Release more than once has no effect.
+func (l *Lock) Release(ctx context.Context) error {
+	l.releaseOnce.Do(func() {
+		close(l.stop)
+		<-l.done
+
+		if l.conn != nil {
+			l.releaseErr = l.releasePostgres(ctx)
+		} else {
+			l.releaseErr = l.releaseSQLite(ctx)
+		}
+	})
+	return l.releaseErr
+}
+
+// advisory locks are identified by integers
+func lockKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+func (l *Lock) acquirePostgres(ctx context.Context) error {
+	sqlDB, err := l.db.DB()
+	if err != nil {
+		return err
+	}
+
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	l.key = lockKey(l.Name)
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", l.key); err != nil {
+		conn.Close()
+		return err
+	}
+
+	l.conn = conn
+	return nil
+}
+
+func (l *Lock) releasePostgres(ctx context.Context) error {
+	defer l.conn.Close()
+
+	var released bool
+	err := l.conn.QueryRowContext(ctx, "SELECT pg_advisory_unlock($1)", l.key).Scan(&released)
+	if err != nil {
+		return err
+	}
+
+	if !released {
+		return ErrLockLost
+	}
+	return nil
+}
+
+// creates the table of leases if it does not exist
+func migrateLocks(db *gorm.DB) error {
+	return db.Exec(`CREATE TABLE IF NOT EXISTS ` + LockTable + ` (
+		name TEXT PRIMARY KEY,
+		owner TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`).Error
+}
+
+func (l *Lock) acquireSQLite(ctx context.Context) error {
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return err
+	}
+	l.owner = hex.EncodeToString(owner)
+
+	db := l.db.Session(&gorm.Session{NewDB: true, Context: ctx})
+	if err := migrateLocks(db); err != nil {
+		return err
+	}
+
+	for {
+		now := time.Now()
+
+		// inserts the lease, or takes over an expired one
+		tx := db.Exec(`INSERT INTO `+LockTable+` (name, owner, expires_at) VALUES (?, ?, ?)
+			ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at
+			WHERE `+LockTable+`.expires_at <= ?`,
+			l.Name, l.owner, now.Add(l.ttl).UnixNano(), now.UnixNano())
+
+		if tx.Error != nil {
+			return tx.Error
+		}
+
+		if tx.RowsAffected == 1 {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(LockRetryInterval):
+		}
+	}
+}
+
+func (l *Lock) renewSQLite(ctx context.Context) error {
+	tx := l.db.Session(&gorm.Session{NewDB: true, Context: ctx}).
+		Exec(`UPDATE `+LockTable+` SET expires_at = ? WHERE name = ? AND owner = ?`,
+			time.Now().Add(l.ttl).UnixNano(), l.Name, l.owner)
+
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	if tx.RowsAffected == 0 {
+		l.markLost()
+		return ErrLockLost
+	}
+	return nil
+}
+
+func (l *Lock) releaseSQLite(ctx context.Context) error {
+	return l.db.Session(&gorm.Session{NewDB: true, Context: ctx}).
+		Exec(`DELETE FROM `+LockTable+` WHERE name = ? AND owner = ?`, l.Name, l.owner).Error
+}
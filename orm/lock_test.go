@@ -0,0 +1,132 @@
+package orm_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t)
+	ctx := context.Background()
+
+	lock, err := orm.Acquire(ctx, db, "report", 300*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Acquire failed with error: %v", err)
+	}
+
+	// held past its ttl, since it is renewed
+	time.Sleep(400 * time.Millisecond)
+
+	timeout, cancel := context.WithTimeout(ctx, 200*time.Millisecond)
+	defer cancel()
+
+	if _, err := orm.Acquire(timeout, db, "report", time.Second); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected deadline exceeded acquiring a held lock, got %v", err)
+	}
+
+	if err := lock.Renew(ctx); err != nil {
+		t.Errorf("Renew failed with error: %v", err)
+	}
+
+	if err := lock.Release(ctx); err != nil {
+		t.Fatalf("Release failed with error: %v", err)
+	}
+
+	other, err := orm.Acquire(ctx, db, "report", time.Second)
+	if err != nil {
+		t.Fatalf("Acquire of a released lock failed with error: %v", err)
+	}
+	defer other.Release(ctx)
+
+	select {
+	case <-lock.Lost():
+		t.Error("released lock must not be reported lost")
+	default:
+	}
+}
+
+func TestLockLost(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t)
+	ctx := context.Background()
+
+	lock, err := orm.Acquire(ctx, db, "report", 150*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(ctx)
+
+	// another process takes over the lease
+	db.Exec("UPDATE orm_locks SET owner = 'other'")
+
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("expected lock to be lost")
+	}
+
+	if err := lock.Renew(ctx); !errors.Is(err, orm.ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+}
+
+func TestLockExpired(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t)
+	ctx := context.Background()
+
+	lock, err := orm.Acquire(ctx, db, "report", time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Release(ctx)
+
+	// the holder crashed and its lease expired
+	db.Exec("UPDATE orm_locks SET expires_at = 0")
+
+	other, err := orm.Acquire(ctx, db, "report", time.Second)
+	if err != nil {
+		t.Fatalf("Acquire of an expired lock failed with error: %v", err)
+	}
+	other.Release(ctx)
+}
+
+func TestWithLock(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t)
+	ctx := context.Background()
+
+	ran := false
+	err := orm.WithLock(ctx, db, "cleanup", time.Second, func(ctx context.Context) error {
+		ran = true
+		return nil
+	})
+
+	if err != nil || !ran {
+		t.Errorf("WithLock failed with error: %v", err)
+	}
+
+	err = orm.WithLock(ctx, db, "cleanup", 150*time.Millisecond, func(ctx context.Context) error {
+		db.Exec("DELETE FROM orm_locks")
+		<-ctx.Done()
+		return nil
+	})
+
+	if !errors.Is(err, orm.ErrLockLost) {
+		t.Errorf("expected ErrLockLost, got %v", err)
+	}
+
+	if _, err := orm.Acquire(ctx, db, "cleanup", 0); !errors.Is(err, orm.ErrInvalidTTL) {
+		t.Errorf("expected ErrInvalidTTL, got %v", err)
+	}
+}
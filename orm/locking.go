@@ -0,0 +1,183 @@
+package orm
+
+import (
+	"fmt"
+	"reflect"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrStaleObject is returned by Update and PartialUpdate when a versioned
+// model was changed by someone else since it was read.
+//
+// Opt in to optimistic locking by tagging an integer field:
+//
+//	type Post struct {
+//		ID      uint
+//		Title   string
+//		Version int64 `orm:"version"`
+//	}
+//
+// Use errors.As to get the version currently stored in the database.
+type ErrStaleObject struct {
+	Table   string // table of the model
+	Version int64  // version the caller tried to update
+	Current int64  // version currently stored in the database
+}
+
+func (e *ErrStaleObject) Error() string {
+	return fmt.Sprintf("stale object: %s at version %d, current version is %d",
+		e.Table, e.Version, e.Current)
+}
+
+// returns the field tagged as the version column or nil
+// if the model does not use optimistic locking.
+func versionField(db *gorm.DB, v any) (*schema.Schema, *schema.Field) {
+	s, err := parseSchema(db, v)
+	if err != nil {
+		// let gorm report the error when executing the query
+		return nil, nil
+	}
+	return s, taggedField(s, "version")
+}
+
+// reads field as an int64. Version fields must be integers.
+func versionOf(db *gorm.DB, field *schema.Field, rv reflect.Value) (int64, error) {
+	value, _ := field.ValueOf(db.Statement.Context, rv)
+	switch n := reflect.ValueOf(value); n.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return n.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(n.Uint()), nil
+	}
+	return 0, fmt.Errorf("version field %s must be an integer, got %T", field.Name, value)
+}
+
+// Update v where the version column matches the version held by v.
+// On success, the version of v is incremented.
+func (o *orm) updateVersioned(v any, s *schema.Schema, field *schema.Field) error {
+	rv := indirectValue(v)
+	current, err := versionOf(o.DB, field, rv)
+	if err != nil {
+		return err
+	}
+
+	if err := field.Set(o.DB.Statement.Context, rv, current+1); err != nil {
+		return err
+	}
+
+	ret := o.DB.Where(versionEq(field, current)).Select("*").Save(v)
+	if ret.Error == nil && (ret.RowsAffected > 0 || ret.DryRun) {
+		return nil
+	}
+
+	// restore the version the caller holds
+	field.Set(o.DB.Statement.Context, rv, current)
+	if ret.Error != nil {
+		return ret.Error
+	}
+
+	return o.staleError(s, field, current, primaryKeyWhere(o.DB, s, rv))
+}
+
+// Partial update of a versioned model.
+// The version column is checked against the version of model and incremented.
+func (o *orm) partialUpdateVersioned(model any, updates any, where Where, s *schema.Schema, field *schema.Field) error {
+	rv := indirectValue(model)
+	current, err := versionOf(o.DB, field, rv)
+	if err != nil {
+		return err
+	}
+
+	values, err := updatesMap(o.DB, updates)
+	if err != nil {
+		return err
+	}
+	values[field.DBName] = current + 1
+
+	ret := o.DB.Model(model).Where(where.Query, where.Args...).Where(versionEq(field, current)).Updates(values)
+	if ret.Error != nil {
+		field.Set(o.DB.Statement.Context, rv, current)
+		return ret.Error
+	}
+
+	if ret.RowsAffected > 0 || ret.DryRun {
+		return field.Set(o.DB.Statement.Context, rv, current+1)
+	}
+
+	field.Set(o.DB.Statement.Context, rv, current)
+	exprs := primaryKeyWhere(o.DB, s, rv)
+	if where.Query != "" {
+		exprs = append(exprs, clause.Expr{SQL: where.Query, Vars: where.Args})
+	}
+	return o.staleError(s, field, current, exprs)
+}
+
+// Converts the updates passed to PartialUpdate to a map of column names
+// so that the version column can be assigned along with them.
+// Like gorm, zero values of structs are not updated.
+func updatesMap(db *gorm.DB, updates any) (map[string]any, error) {
+	if m, ok := updates.(map[string]any); ok {
+		values := make(map[string]any, len(m)+1)
+		for k, v := range m {
+			values[k] = v
+		}
+		return values, nil
+	}
+
+	s, err := parseSchema(db, updates)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := indirectValue(updates)
+	values := make(map[string]any)
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.PrimaryKey || !field.Updatable {
+			continue
+		}
+
+		if value, isZero := field.ValueOf(db.Statement.Context, rv); !isZero {
+			values[field.DBName] = value
+		}
+	}
+	return values, nil
+}
+
+// Returns ErrStaleObject with the version currently stored for the record
+// matching exprs, or ErrNoRecordsUpdated if there is no such record.
+func (o *orm) staleError(s *schema.Schema, field *schema.Field, version int64, exprs []clause.Expression) error {
+	var versions []int64
+	err := o.DB.Session(&gorm.Session{NewDB: true}).
+		Table(s.Table).Clauses(clause.Where{Exprs: exprs}).
+		Limit(1).Pluck(field.DBName, &versions).Error
+
+	if err != nil {
+		return err
+	}
+
+	if len(versions) == 0 {
+		return ErrNoRecordsUpdated
+	}
+	return &ErrStaleObject{Table: s.Table, Version: version, Current: versions[0]}
+}
+
+func versionEq(field *schema.Field, version int64) clause.Expression {
+	return clause.Eq{
+		Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+		Value:  version,
+	}
+}
+
+// returns equality conditions for the non-zero primary keys of rv
+func primaryKeyWhere(db *gorm.DB, s *schema.Schema, rv reflect.Value) []clause.Expression {
+	exprs := make([]clause.Expression, 0, len(s.PrimaryFields))
+	for _, pf := range s.PrimaryFields {
+		if value, isZero := pf.ValueOf(db.Statement.Context, rv); !isZero {
+			exprs = append(exprs, clause.Eq{Column: clause.Column{Name: pf.DBName}, Value: value})
+		}
+	}
+	return exprs
+}
@@ -0,0 +1,85 @@
+package orm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+type Document struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	Title   string `json:"title"`
+	Version int64  `json:"version" orm:"version"`
+}
+
+func TestOptimisticLocking(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Document{})
+
+	dborm := orm.New(db)
+	doc := &Document{Title: "draft"}
+	if err := dborm.Insert(doc); err != nil {
+		t.Fatal(err)
+	}
+
+	// two users read the same record
+	first, second := &Document{}, &Document{}
+	dborm.First(first, doc.ID)
+	dborm.First(second, doc.ID)
+
+	first.Title = "first edit"
+	if err := dborm.Update(first); err != nil {
+		t.Fatalf("update failed with error: %v", err)
+	}
+
+	if first.Version != 1 {
+		t.Errorf("expected version to be incremented to 1, got %d", first.Version)
+	}
+
+	second.Title = "second edit"
+	err := dborm.Update(second)
+
+	var stale *orm.ErrStaleObject
+	if !errors.As(err, &stale) {
+		t.Fatalf("expected ErrStaleObject, got %v", err)
+	}
+
+	if stale.Current != 1 || stale.Version != 0 {
+		t.Errorf("unexpected stale versions: %+v", stale)
+	}
+
+	if second.Version != 0 {
+		t.Errorf("version of stale object should not change, got %d", second.Version)
+	}
+
+	// partial update with the current version succeeds
+	err = dborm.PartialUpdate(first, Document{Title: "partial"}, orm.Where{Query: "id=?", Args: []any{first.ID}})
+	if err != nil {
+		t.Fatalf("partial update failed with error: %v", err)
+	}
+
+	if first.Version != 2 || first.Title != "partial" {
+		t.Errorf("partial update did not update model: %+v", first)
+	}
+
+	// partial update of the stale object fails
+	err = dborm.PartialUpdate(second, map[string]any{"title": "stale"}, orm.Where{Query: "id=?", Args: []any{second.ID}})
+	if !errors.As(err, &stale) || stale.Current != 2 {
+		t.Errorf("expected ErrStaleObject at version 2, got %v", err)
+	}
+
+	stored := &Document{}
+	dborm.First(stored, doc.ID)
+	if stored.Title != "partial" || stored.Version != 2 {
+		t.Errorf("stale updates must not be written, got %+v", stored)
+	}
+
+	// missing records are not reported as stale
+	err = dborm.PartialUpdate(&Document{ID: 100}, Document{Title: "x"}, orm.Where{})
+	if !errors.Is(err, orm.ErrNoRecordsUpdated) {
+		t.Errorf("expected ErrNoRecordsUpdated, got %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package orm
 
 import (
+	"context"
 	"errors"
 	"reflect"
 
@@ -13,14 +14,19 @@ var (
 
 	// An update query affected 0 rows
 	ErrNoRecordsUpdated = errors.New("no records updated")
+
+	// The value passed in is not a pointer to a slice
+	ErrNotSlice = errors.New("not a pointer to a slice")
 )
 
 type ORM interface {
+	WithContext(ctx context.Context) ORM
 	Insert(v any) error
+	InsertMany(slicePtr any, batchSize int) error
 	Update(v any) error
 	PartialUpdate(model any, updates any, where Where) error
 	Delete(v any, conditions ...Condition) error
-	First(v any, id uint, conditions ...Condition) error
+	First(v any, id any, conditions ...Condition) error
 	FindOne(v any, where Where, conditions ...Condition) error
 	FindAll(slicePtr any, conditions ...Condition) error
 }
@@ -41,37 +47,106 @@ func IsPointer(v any) bool {
 // Insert v into the database.
 // Note that relationships are not preloaded after insert.
 // Requery the database with Preload conditions to load the records with relationships.
+//
+// Zero fields tagged `orm:"uuid"` or `orm:"ulid"` are set to a new UUIDv7 or ULID.
+// They may be strings or types scanning strings like uuid.UUID.
 func (o *orm) Insert(v any) error {
 	if !IsPointer(v) {
 		return ErrNotPointer
 	}
 
+	if err := generateKeys(o.DB, v); err != nil {
+		return err
+	}
+
+	if err := stampCreate(o.DB, v); err != nil {
+		return err
+	}
 	return o.DB.Create(v).Error
 }
 
+// InsertMany inserts the records of slicePtr in batches of batchSize.
+// All batches are inserted in a single transaction.
+func (o *orm) InsertMany(slicePtr any, batchSize int) error {
+	if !IsPointer(slicePtr) {
+		return ErrNotPointer
+	}
+
+	if indirectValue(slicePtr).Kind() != reflect.Slice {
+		return ErrNotSlice
+	}
+
+	if err := generateKeys(o.DB, slicePtr); err != nil {
+		return err
+	}
+
+	if err := stampCreate(o.DB, slicePtr); err != nil {
+		return err
+	}
+	// CreateInBatches opens a transaction whose events are published on commit
+	return Transaction(o.DB, func(tx *gorm.DB) error {
+		return tx.CreateInBatches(slicePtr, batchSize).Error
+	})
+}
+
 // Update v in the database. v must have a primary key field(id) set
+//
+// If v has a field tagged `orm:"version"`, the update only succeeds if the
+// stored version matches that of v, otherwise *ErrStaleObject is returned.
 func (o *orm) Update(v any) error {
 	if !IsPointer(v) {
 		return ErrNotPointer
 	}
 
+	omit, err := stampUpdate(o.DB, v)
+	if err != nil {
+		return err
+	}
+
+	if len(omit) > 0 {
+		o = &orm{DB: o.DB.Omit(omit...)}
+	}
+
+	if s, field := versionField(o.DB, v); field != nil {
+		return o.updateVersioned(v, s, field)
+	}
+
 	return o.DB.Save(v).Error
 
 }
 
 // Partial update of model(pointer) with updates struct.
 // Where condition specified the select where condition is must be provided.
+//
+// Zero values of updates structs are skipped. To update them, pass a
+// FieldMask or a map, whose keys may be columns, field or json names.
+// Versioned models are checked and incremented like in Update.
 func (o *orm) PartialUpdate(model any, updates any, where Where) error {
 	if !IsPointer(model) {
 		return ErrNotPointer
 	}
 
+	updates, err := resolveUpdates(o.DB, model, updates)
+	if err != nil {
+		return err
+	}
+
+	updates, err = stampUpdates(o.DB, model, updates)
+	if err != nil {
+		return err
+	}
+
+	if s, field := versionField(o.DB, model); field != nil {
+		return o.partialUpdateVersioned(model, updates, where, s, field)
+	}
+
 	ret := o.DB.Model(model).Where(where.Query, where.Args...).Updates(updates)
 	if ret.Error != nil {
 		return ret.Error
 	}
 
-	if ret.RowsAffected < 1 {
+	// nothing is executed in dry run mode
+	if ret.RowsAffected < 1 && !ret.DryRun {
 		return ErrNoRecordsUpdated
 	}
 
@@ -88,14 +163,24 @@ func (o *orm) Delete(v any, conditions ...Condition) error {
 	return model.Unscoped().Delete(v).Error
 }
 
-// Get record by ID
+// Get record by primary key id, which may be of any type.
+// Composite keys are given as a struct or map, see KeyValues.
 // v pointer is populated by the query
-func (o *orm) First(v any, id uint, conditions ...Condition) error {
+func (o *orm) First(v any, id any, conditions ...Condition) error {
 	if !IsPointer(v) {
 		return ErrNotPointer
 	}
-	model := applyConditions(o.DB, conditions...)
-	return model.First(v, id).Error
+
+	s, err := parseSchema(o.DB, v)
+	if err != nil {
+		return err
+	}
+
+	model, err := whereKey(applyConditions(o.DB, conditions...), s, id)
+	if err != nil {
+		return err
+	}
+	return model.First(v).Error
 }
 
 // FindOne is similar to First except that you must
@@ -131,9 +216,10 @@ type PaginatedResult[T any] struct {
 }
 
 func Paginate[T any](table *T, page int, limit int, db *gorm.DB, conditions ...Condition) (PaginatedResult[T], error) {
+	// The count and the page are separate statements: a statement keeps
+	// the SQL it executed in dry run mode and would run the count twice.
 	var count int64
-	model := db.Model(table)
-	err := model.Count(&count).Error
+	err := db.Model(table).Count(&count).Error
 
 	if err != nil {
 		return PaginatedResult[T]{}, err
@@ -144,7 +230,7 @@ func Paginate[T any](table *T, page int, limit int, db *gorm.DB, conditions ...C
 	}
 
 	results := PaginatedResult[T]{}
-	model = applyConditions(model, conditions...)
+	model := applyConditions(db.Model(table), conditions...)
 	err = model.Offset(limit * (page - 1)).Limit(limit).Find(&results.Results).Error
 	if err != nil {
 		return PaginatedResult[T]{}, err
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/gorm"
 )
 
 type Post struct {
@@ -24,18 +26,12 @@ type Comment struct {
 func TestORM(t *testing.T) {
 	t.Parallel()
 
-	db := orm.ConnectToSqlite3(orm.MemorySQLiteDB, true)
-	err := db.AutoMigrate(&Post{}, &Comment{})
-
-	if err != nil {
-		t.Fatalf("unable to to run gorm automigrate: %v", err)
-	}
-
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
 	dborm := orm.New(db)
 
 	// Test database insert
 	p := &Post{Title: "My first post", CreateAt: db.NowFunc()}
-	err = dborm.Insert(p)
+	err := dborm.Insert(p)
 
 	if err != nil {
 		t.Errorf("db insert failed with error: %v", err)
@@ -167,3 +163,42 @@ func TestORM(t *testing.T) {
 	c := Comment{CreateAt: db.NowFunc()}
 	dborm.Insert(&c)
 }
+
+func TestPaginate(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
+	posts := make([]Post, 15)
+	for i := range posts {
+		posts[i].Title = "post"
+	}
+	orm.New(db).InsertMany(&posts, 100)
+
+	results, err := orm.Paginate(&Post{}, 2, 4, db, orm.Where{Query: "id > ?", Args: []any{5}}, orm.Order{Name: "id"})
+	if err != nil {
+		t.Fatalf("Paginate failed with error: %v", err)
+	}
+
+	// conditions select the page while the count is of the whole table
+	if results.Count != 15 || results.TotalPages != 4 || !results.HasNext || !results.HasPrev {
+		t.Errorf("unexpected page %+v", results)
+	}
+
+	if len(results.Results) != 4 || results.Results[0].ID != 10 || results.Results[3].ID != 13 {
+		t.Errorf("expected posts 10 to 13, got %+v", results.Results)
+	}
+
+	// the page query must not reuse the SQL of the count in dry run mode
+	statements, err := orm.ToSQL(db, func(tx *gorm.DB) error {
+		_, err := orm.Paginate(&Post{}, 1, 4, tx)
+		return err
+	})
+
+	if err != nil {
+		t.Fatalf("ToSQL failed with error: %v", err)
+	}
+
+	if len(statements) != 2 || statements[0].SQL == statements[1].SQL {
+		t.Errorf("expected a count and a page query, got %v", statements)
+	}
+}
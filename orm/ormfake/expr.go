@@ -0,0 +1,644 @@
+package ormfake
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gorm.io/gorm/schema"
+)
+
+// predicate evaluated against a stored row
+type predicate func(row reflect.Value) bool
+
+// a value in an expression, either a column or a constant
+type operand func(row reflect.Value) any
+
+/*
+parses the where clause query of orm.Where into a predicate.
+
+Supported expressions are a subset of SQL:
+
+	column = ?, !=, <>, <, <=, >, >=
+	column IS NULL, column IS NOT NULL
+	column [NOT] IN (?), column [NOT] IN (?, ?)
+	column [NOT] LIKE ?
+	column BETWEEN ? AND ?
+	NOT, AND, OR and parentheses
+
+Operands are columns, ? placeholders, numbers, 'strings', TRUE, FALSE and NULL.
+*/
+func parseWhere(s *schema.Schema, query string, args []any) (predicate, error) {
+	if strings.TrimSpace(query) == "" {
+		return func(reflect.Value) bool { return true }, nil
+	}
+
+	tokens, err := tokenize(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{schema: s, tokens: tokens, args: args}
+	pred, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("ormfake: unexpected %q in %q", p.tokens[p.pos].text, query)
+	}
+
+	if p.arg < len(args) {
+		return nil, fmt.Errorf("ormfake: %d arguments for %d placeholders in %q", len(args), p.arg, query)
+	}
+	return pred, nil
+}
+
+type tokenKind int
+
+const (
+	identToken tokenKind = iota
+	stringToken
+	numberToken
+	symbolToken
+	placeholderToken
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+// returns true if t is the keyword kw
+func (t token) is(kw string) bool {
+	return (t.kind == identToken || t.kind == symbolToken) && strings.EqualFold(t.text, kw)
+}
+
+func tokenize(query string) ([]token, error) {
+	var tokens []token
+	runes := []rune(query)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '?':
+			tokens = append(tokens, token{placeholderToken, "?"})
+			i++
+		case r == '\'':
+			var sb strings.Builder
+			i++
+			for {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("ormfake: unterminated string in %q", query)
+				}
+				if runes[i] == '\'' {
+					if i+1 < len(runes) && runes[i+1] == '\'' {
+						sb.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			tokens = append(tokens, token{stringToken, sb.String()})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			start := i
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, token{numberToken, string(runes[start:i])})
+		case unicode.IsLetter(r) || r == '_' || r == '"' || r == '`':
+			var sb strings.Builder
+			for i < len(runes) {
+				c := runes[i]
+				if c == '"' || c == '`' {
+					i++
+					continue
+				}
+
+				if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' && c != '.' {
+					break
+				}
+				sb.WriteRune(c)
+				i++
+			}
+			tokens = append(tokens, token{identToken, sb.String()})
+		default:
+			for _, op := range []string{"<=", ">=", "<>", "!=", "=", "<", ">", "(", ")", ","} {
+				if strings.HasPrefix(string(runes[i:]), op) {
+					tokens = append(tokens, token{symbolToken, op})
+					i += len(op)
+					goto next
+				}
+			}
+			return nil, fmt.Errorf("ormfake: unsupported character %q in %q", r, query)
+		next:
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	schema *schema.Schema
+	tokens []token
+	pos    int
+	args   []any
+	arg    int // next placeholder argument
+}
+
+func (p *parser) peek() (token, bool) {
+	if p.pos >= len(p.tokens) {
+		return token{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// consumes the next token if it is the keyword or symbol kw
+func (p *parser) accept(kw string) bool {
+	if t, ok := p.peek(); ok && t.is(kw) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kw string) error {
+	if !p.accept(kw) {
+		return p.errorf("expected %s", kw)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	near := "end of query"
+	if t, ok := p.peek(); ok {
+		near = strconv.Quote(t.text)
+	}
+	return fmt.Errorf("ormfake: "+format+" near %s", append(args, near)...)
+}
+
+func (p *parser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("OR") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(row reflect.Value) bool { return l(row) || right(row) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (predicate, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.accept("AND") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+
+		l := left
+		left = func(row reflect.Value) bool { return l(row) && right(row) }
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (predicate, error) {
+	if p.accept("NOT") {
+		pred, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(row reflect.Value) bool { return !pred(row) }, nil
+	}
+
+	if p.accept("(") {
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return pred, p.expect(")")
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (predicate, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorf("expected an operator")
+	}
+
+	switch {
+	case t.is("IS"):
+		p.pos++
+		not := p.accept("NOT")
+		if err := p.expect("NULL"); err != nil {
+			return nil, err
+		}
+		return func(row reflect.Value) bool {
+			return (normalize(left(row)) == nil) != not
+		}, nil
+	case t.is("BETWEEN"):
+		p.pos++
+		low, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect("AND"); err != nil {
+			return nil, err
+		}
+
+		high, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		return func(row reflect.Value) bool {
+			v := left(row)
+			c1, ok1 := compare(v, low(row))
+			c2, ok2 := compare(v, high(row))
+			return ok1 && ok2 && c1 >= 0 && c2 <= 0
+		}, nil
+	}
+
+	not := p.accept("NOT")
+	switch {
+	case p.accept("IN"):
+		values, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		return func(row reflect.Value) bool {
+			v := left(row)
+			for _, value := range values {
+				if c, ok := compare(v, value(row)); ok && c == 0 {
+					return !not
+				}
+			}
+			return not
+		}, nil
+	case p.accept("LIKE"):
+		t, _ := p.peek()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+
+		// constant patterns are compiled once
+		if !t.isColumn() {
+			pattern, ok := normalize(right(reflect.Value{})).(string)
+			re := likeRegexp(pattern)
+			return func(row reflect.Value) bool {
+				s, isString := normalize(left(row)).(string)
+				return ok && isString && re.MatchString(s) != not
+			}, nil
+		}
+
+		return func(row reflect.Value) bool {
+			s, ok1 := normalize(left(row)).(string)
+			pattern, ok2 := normalize(right(row)).(string)
+			return ok1 && ok2 && likeRegexp(pattern).MatchString(s) != not
+		}, nil
+	case not:
+		return nil, p.errorf("expected IN or LIKE after NOT")
+	}
+
+	op := t.text
+	switch op {
+	case "=", "!=", "<>", "<", "<=", ">", ">=":
+		p.pos++
+	default:
+		return nil, p.errorf("unsupported operator")
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	return func(row reflect.Value) bool {
+		c, ok := compare(left(row), right(row))
+		if !ok {
+			return false
+		}
+
+		switch op {
+		case "=":
+			return c == 0
+		case "!=", "<>":
+			return c != 0
+		case "<":
+			return c < 0
+		case "<=":
+			return c <= 0
+		case ">":
+			return c > 0
+		default:
+			return c >= 0
+		}
+	}, nil
+}
+
+// parses the list of an IN expression, expanding slice arguments
+func (p *parser) parseList() ([]operand, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var values []operand
+	for {
+		t, ok := p.peek()
+		if !ok {
+			return nil, p.errorf("unterminated IN list")
+		}
+
+		if t.kind == placeholderToken {
+			arg, err := p.nextArg()
+			if err != nil {
+				return nil, err
+			}
+			p.pos++
+
+			rv := reflect.ValueOf(arg)
+			if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() != reflect.Uint8 {
+				for i := 0; i < rv.Len(); i++ {
+					value := rv.Index(i).Interface()
+					values = append(values, func(reflect.Value) any { return value })
+				}
+			} else {
+				values = append(values, func(reflect.Value) any { return arg })
+			}
+		} else {
+			operand, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, operand)
+		}
+
+		if p.accept(")") {
+			return values, nil
+		}
+
+		if err := p.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *parser) nextArg() (any, error) {
+	if p.arg >= len(p.args) {
+		return nil, p.errorf("missing argument for placeholder")
+	}
+
+	arg := p.args[p.arg]
+	p.arg++
+	return arg, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t, ok := p.peek()
+	if !ok {
+		return nil, p.errorf("expected an operand")
+	}
+	p.pos++
+
+	switch t.kind {
+	case placeholderToken:
+		arg, err := p.nextArg()
+		if err != nil {
+			return nil, err
+		}
+		return func(reflect.Value) any { return arg }, nil
+	case stringToken:
+		return func(reflect.Value) any { return t.text }, nil
+	case numberToken:
+		n, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", t.text)
+		}
+		return func(reflect.Value) any { return n }, nil
+	case identToken:
+		switch strings.ToUpper(t.text) {
+		case "TRUE":
+			return func(reflect.Value) any { return true }, nil
+		case "FALSE":
+			return func(reflect.Value) any { return false }, nil
+		case "NULL":
+			return func(reflect.Value) any { return nil }, nil
+		}
+
+		field := lookupColumn(p.schema, t.text)
+		if field == nil {
+			return nil, fmt.Errorf("ormfake: unknown column %q in %s", t.text, p.schema.Table)
+		}
+
+		// nil embedded pointers hold NULL columns
+		return func(row reflect.Value) any {
+			value, _ := field.ValueOf(background, row)
+			return value
+		}, nil
+	}
+
+	p.pos--
+	return nil, p.errorf("expected an operand")
+}
+
+// returns true if t is an operand read from the row
+func (t token) isColumn() bool {
+	if t.kind != identToken {
+		return false
+	}
+
+	switch strings.ToUpper(t.text) {
+	case "TRUE", "FALSE", "NULL":
+		return false
+	}
+	return true
+}
+
+// finds the field of a possibly quoted and table qualified column
+func lookupColumn(s *schema.Schema, column string) *schema.Field {
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = column[i+1:]
+	}
+
+	field := s.LookUpField(column)
+	if field == nil {
+		field = jsonField(s, column)
+	}
+
+	if field == nil || field.DBName == "" {
+		return nil
+	}
+	return field
+}
+
+// returns the field of s serialized to JSON as name
+func jsonField(s *schema.Schema, name string) *schema.Field {
+	for _, field := range s.Fields {
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == name && tag != "" && tag != "-" {
+			return field
+		}
+	}
+	return nil
+}
+
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
+// converts v to nil, float64, string, bool or time.Time for comparisons
+func normalize(v any) any {
+	if v == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+
+		if !rv.Type().Implements(valuerType) {
+			return normalize(rv.Elem().Interface())
+		}
+	}
+
+	if t, ok := v.(time.Time); ok {
+		return t
+	}
+
+	if valuer, ok := v.(driver.Valuer); ok {
+		value, err := valuer.Value()
+		if err != nil {
+			return nil
+		}
+		return normalize(value)
+	}
+
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	case reflect.Slice:
+		if b, ok := v.([]byte); ok {
+			return string(b)
+		}
+	}
+	return v
+}
+
+// compares a and b like SQL. ok is false if either is NULL
+// or the values can not be compared.
+func compare(a, b any) (c int, ok bool) {
+	a, b = normalize(a), normalize(b)
+	if a == nil || b == nil {
+		return 0, false
+	}
+
+	// booleans are stored as integers
+	if x, isBool := a.(bool); isBool {
+		a = boolToFloat(x)
+	}
+
+	if x, isBool := b.(bool); isBool {
+		b = boolToFloat(x)
+	}
+
+	switch x := a.(type) {
+	case float64:
+		y, ok := b.(float64)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	case string:
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	case time.Time:
+		y, ok := b.(time.Time)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x.Before(y):
+			return -1, true
+		case x.After(y):
+			return 1, true
+		}
+		return 0, true
+	}
+
+	if reflect.DeepEqual(a, b) {
+		return 0, true
+	}
+	return 0, false
+}
+
+func boolToFloat(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// converts a LIKE pattern to a case insensitive regexp like sqlite
+func likeRegexp(pattern string) *regexp.Regexp {
+	var sb strings.Builder
+	sb.WriteString("(?is)^")
+	for _, r := range pattern {
+		switch r {
+		case '%':
+			sb.WriteString(".*")
+		case '_':
+			sb.WriteString(".")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.MustCompile(sb.String())
+}
@@ -0,0 +1,938 @@
+/*
+Package ormfake provides Fake, an in-memory implementation of orm.ORM.
+
+It is separate from package ormtest so that unit tests using the fake
+don't depend on the sqlite driver or cgo.
+*/
+package ormfake
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+/*
+Fake is an in-memory implementation of orm.ORM for unit tests of code
+that depends on the ORM interface. It needs neither a database nor cgo.
+
+	func TestService(t *testing.T) {
+		svc := NewService(ormfake.New())
+		...
+	}
+
+Records are stored per model type. Integer primary keys are assigned on
+insert and fields tracked by gorm as created/updated times are set, as
+are fields stamped with the actor of the context given to WithContext.
+Relationships are not stored: fields holding associations are zero
+when records are read back.
+
+Supported conditions are orm.Where, orm.Order, orm.Limit and orm.Select.
+Where queries are limited to the expressions documented on parseWhere.
+Other conditions, e.g. orm.Preload or orm.Join, return an error.
+
+The behaviour of Fake is checked against the real implementation by
+ormtest.RunConformance.
+*/
+type Fake struct {
+	// NowFunc returns the time used for timestamps. Defaults to time.Now.
+	NowFunc func() time.Time
+
+	ctx context.Context // holds the actor stamping records
+	*fakeStore
+}
+
+// records shared by a Fake and the copies made by WithContext
+type fakeStore struct {
+	mu     sync.Mutex
+	cache  sync.Map
+	tables map[reflect.Type]*fakeTable
+}
+
+var _ orm.ORM = (*Fake)(nil)
+
+// records of a model type in insertion order
+type fakeTable struct {
+	schema *schema.Schema
+	rows   []reflect.Value
+	nextID int64
+}
+
+// New returns an empty in-memory ORM.
+func New() *Fake {
+	return &Fake{
+		NowFunc:   time.Now,
+		ctx:       context.Background(),
+		fakeStore: &fakeStore{tables: make(map[reflect.Type]*fakeTable)},
+	}
+}
+
+// WithContext returns a Fake sharing the records of f, stamping
+// them with the actor of ctx.
+func (f *Fake) WithContext(ctx context.Context) orm.ORM {
+	return &Fake{NowFunc: f.NowFunc, ctx: ctx, fakeStore: f.fakeStore}
+}
+
+var background = context.Background()
+
+// returns the table of the struct type underlying v, which may be
+// a pointer to a struct or a slice of structs.
+func (f *Fake) table(v any) (*fakeTable, error) {
+	t := reflect.TypeOf(v)
+	for t != nil && (t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+		t = t.Elem()
+	}
+
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ormfake: %T is not a model", v)
+	}
+
+	if table, ok := f.tables[t]; ok {
+		return table, nil
+	}
+
+	s, err := schema.Parse(reflect.New(t).Interface(), &f.cache, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	table := &fakeTable{schema: s}
+	f.tables[t] = table
+	return table, nil
+}
+
+// Insert v, a pointer to a model or a slice of models.
+func (f *Fake) Insert(v any) error {
+	if !orm.IsPointer(v) {
+		return orm.ErrNotPointer
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(v)
+	if err != nil {
+		return err
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return f.insert(table, indirect(rv))
+	}
+
+	for i := 0; i < rv.Len(); i++ {
+		if err := f.insert(table, indirect(rv.Index(i))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InsertMany inserts the records of slicePtr. batchSize is ignored.
+func (f *Fake) InsertMany(slicePtr any, batchSize int) error {
+	if !orm.IsPointer(slicePtr) {
+		return orm.ErrNotPointer
+	}
+
+	if reflect.ValueOf(slicePtr).Elem().Kind() != reflect.Slice {
+		return orm.ErrNotSlice
+	}
+	return f.Insert(slicePtr)
+}
+
+func (f *Fake) insert(table *fakeTable, rv reflect.Value) error {
+	s := table.schema
+	now := f.NowFunc()
+
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		if _, isZero := field.ValueOf(background, rv); !isZero {
+			continue
+		}
+
+		if key, ok := orm.GeneratedKey(field); ok {
+			if err := field.Set(background, rv, key); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch {
+		case field.AutoCreateTime > 0 || field.AutoUpdateTime > 0:
+			if err := setTime(field, rv, now); err != nil {
+				return err
+			}
+		case field.DefaultValueInterface != nil:
+			if err := field.Set(background, rv, field.DefaultValueInterface); err != nil {
+				return err
+			}
+		}
+	}
+
+	if st, ok := stampsOf(s); ok {
+		if err := f.stamp(st, rv, true); err != nil {
+			return err
+		}
+	}
+
+	if pk := s.PrioritizedPrimaryField; pk != nil {
+		value, isZero := pk.ValueOf(background, rv)
+		switch {
+		case isZero && isInteger(pk.FieldType):
+			table.nextID++
+			if err := pk.Set(background, rv, table.nextID); err != nil {
+				return err
+			}
+		case table.find(rv) >= 0:
+			return fmt.Errorf("ormfake: duplicate primary key %v in %s", value, s.Table)
+		case isInteger(pk.FieldType):
+			if id := reflect.ValueOf(value); id.CanInt() && id.Int() > table.nextID {
+				table.nextID = id.Int()
+			} else if id.CanUint() && int64(id.Uint()) > table.nextID {
+				table.nextID = int64(id.Uint())
+			}
+		}
+	}
+
+	table.rows = append(table.rows, columns(s, rv))
+	return nil
+}
+
+// Update v by its primary key. v is inserted if its primary key is zero
+// or it is not stored yet.
+func (f *Fake) Update(v any) error {
+	if !orm.IsPointer(v) {
+		return orm.ErrNotPointer
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(v)
+	if err != nil {
+		return err
+	}
+
+	rv := indirect(reflect.ValueOf(v))
+	s := table.schema
+	i := table.find(rv)
+
+	if version := versionField(s); version != nil {
+		current := versionOf(version, rv)
+		if i < 0 && !isZeroKey(s, rv) {
+			return orm.ErrNoRecordsUpdated
+		}
+
+		if i >= 0 && versionOf(version, table.rows[i]) != current {
+			stored := versionOf(version, table.rows[i])
+			return &orm.ErrStaleObject{Table: s.Table, Version: current, Current: stored}
+		}
+
+		if err := version.Set(background, rv, current+1); err != nil {
+			return err
+		}
+	}
+
+	if i < 0 {
+		return f.insert(table, rv)
+	}
+
+	for _, field := range s.Fields {
+		if field.AutoUpdateTime > 0 {
+			if err := setTime(field, rv, f.NowFunc()); err != nil {
+				return err
+			}
+		}
+	}
+
+	next := columns(s, rv)
+	if st, ok := stampsOf(s); ok {
+		if err := f.stamp(st, next, false); err != nil {
+			return err
+		}
+
+		// created stamps are not updated
+		for _, field := range st.created() {
+			value, _ := field.ValueOf(background, table.rows[i])
+			if err := field.Set(background, next, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	table.rows[i] = next
+	return nil
+}
+
+// PartialUpdate sets the non-zero fields of updates, a struct or a map
+// of column names, on the records matching where and the primary key of model.
+func (f *Fake) PartialUpdate(model any, updates any, where orm.Where) error {
+	if !orm.IsPointer(model) {
+		return orm.ErrNotPointer
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(model)
+	if err != nil {
+		return err
+	}
+
+	s := table.schema
+	rv := indirect(reflect.ValueOf(model))
+
+	values, err := f.updateValues(s, updates)
+	if err != nil {
+		return err
+	}
+
+	pred, err := parseWhere(s, where.Query, where.Args)
+	if err != nil {
+		return err
+	}
+
+	keyed := !isZeroKey(s, rv)
+	if !keyed && strings.TrimSpace(where.Query) == "" {
+		return gorm.ErrMissingWhereClause
+	}
+
+	match := func(row reflect.Value) bool {
+		return pred(row) && (!keyed || sameKey(s, row, rv))
+	}
+
+	version := versionField(s)
+	var current int64
+	if version != nil {
+		current = versionOf(version, rv)
+		values[version] = current + 1
+	}
+
+	if st, ok := stampsOf(s); ok {
+		for _, field := range append(st.created(), st.updated()...) {
+			delete(values, field)
+		}
+
+		if st.updatedBy != nil {
+			values[st.updatedBy] = f.actor(st.updatedBy)
+		}
+	}
+
+	for _, field := range s.Fields {
+		if _, ok := values[field]; !ok && field.AutoUpdateTime > 0 {
+			values[field] = nil
+		}
+	}
+
+	updated := 0
+	for i, row := range table.rows {
+		if !match(row) {
+			continue
+		}
+
+		if version != nil && versionOf(version, row) != current {
+			continue
+		}
+
+		next := columns(s, row)
+		if err := f.assign(next, values); err != nil {
+			return err
+		}
+
+		table.rows[i] = next
+		updated++
+	}
+
+	if updated == 0 {
+		if version != nil {
+			for _, row := range table.rows {
+				if match(row) {
+					return &orm.ErrStaleObject{Table: s.Table, Version: current, Current: versionOf(version, row)}
+				}
+			}
+		}
+		return orm.ErrNoRecordsUpdated
+	}
+
+	// like gorm, the updated values are assigned to the model
+	return f.assign(rv, values)
+}
+
+// converts updates to values by field. Zero values of structs are skipped,
+// unlike those of field masks.
+func (f *Fake) updateValues(s *schema.Schema, updates any) (map[*schema.Field]any, error) {
+	values := make(map[*schema.Field]any)
+
+	if mask, ok := updates.(orm.FieldMask); ok {
+		columns, err := mask.Columns(s)
+		if err != nil {
+			return nil, err
+		}
+		updates = columns
+	}
+
+	if m, ok := updates.(map[string]any); ok {
+		for column, value := range m {
+			field := lookupColumn(s, column)
+			if field == nil {
+				return nil, fmt.Errorf("ormfake: unknown column %q in %s", column, s.Table)
+			}
+			values[field] = value
+		}
+		return values, nil
+	}
+
+	us, err := schema.Parse(updates, &f.cache, schema.NamingStrategy{})
+	if err != nil {
+		return nil, err
+	}
+
+	uv := indirect(reflect.ValueOf(updates))
+	for _, uf := range us.Fields {
+		if uf.DBName == "" || uf.PrimaryKey || !uf.Updatable {
+			continue
+		}
+
+		value, isZero := uf.ValueOf(background, uv)
+		if isZero {
+			continue
+		}
+
+		if field := s.LookUpField(uf.DBName); field != nil && field.DBName != "" {
+			values[field] = value
+		}
+	}
+	return values, nil
+}
+
+// sets values on rv. nil values of timestamp fields are set to now.
+func (f *Fake) assign(rv reflect.Value, values map[*schema.Field]any) error {
+	for field, value := range values {
+		var err error
+		if value == nil && field.AutoUpdateTime > 0 {
+			err = setTime(field, rv, f.NowFunc())
+		} else {
+			err = field.Set(background, rv, value)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Delete the records matching the conditions and the primary key of v.
+func (f *Fake) Delete(v any, conditions ...orm.Condition) error {
+	if !orm.IsPointer(v) {
+		return orm.ErrNotPointer
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(v)
+	if err != nil {
+		return err
+	}
+
+	s := table.schema
+	q, err := compile(s, conditions)
+	if err != nil {
+		return err
+	}
+
+	rv := indirect(reflect.ValueOf(v))
+	keyed := rv.Kind() == reflect.Struct && !isZeroKey(s, rv)
+	if !keyed && len(q.where) == 0 {
+		return gorm.ErrMissingWhereClause
+	}
+
+	rows := table.rows[:0]
+	for _, row := range table.rows {
+		if q.match(row) && (!keyed || sameKey(s, row, rv)) {
+			continue
+		}
+		rows = append(rows, row)
+	}
+	table.rows = rows
+	return nil
+}
+
+// First finds the record with primary key id, given like to orm.KeyValues.
+// gorm.ErrRecordNotFound is returned if there is none.
+func (f *Fake) First(v any, id any, conditions ...orm.Condition) error {
+	if !orm.IsPointer(v) {
+		return orm.ErrNotPointer
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(v)
+	if err != nil {
+		return err
+	}
+
+	s := table.schema
+	values, err := orm.KeyValues(s, id)
+	if err != nil {
+		return err
+	}
+
+	columns := make([]string, len(s.PrimaryFields))
+	for i, pk := range s.PrimaryFields {
+		columns[i] = pk.DBName + " = ?"
+	}
+
+	where := orm.Where{Query: strings.Join(columns, " AND "), Args: values}
+	return f.first(table, v, append([]orm.Condition{where}, conditions...))
+}
+
+// FindOne finds the first record matching where ordered by primary key.
+// gorm.ErrRecordNotFound is returned if there is none.
+func (f *Fake) FindOne(v any, where orm.Where, conditions ...orm.Condition) error {
+	if !orm.IsPointer(v) {
+		return orm.ErrNotPointer
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(v)
+	if err != nil {
+		return err
+	}
+	return f.first(table, v, append([]orm.Condition{where}, conditions...))
+}
+
+func (f *Fake) first(table *fakeTable, v any, conditions []orm.Condition) error {
+	s := table.schema
+	q, err := compile(s, conditions)
+	if err != nil {
+		return err
+	}
+
+	// like gorm, a non-zero primary key of v is a condition
+	rv := indirect(reflect.ValueOf(v))
+	if !isZeroKey(s, rv) {
+		key := columns(s, rv)
+		q.where = append(q.where, func(row reflect.Value) bool { return sameKey(s, row, key) })
+	}
+
+	// and records are ordered by primary key
+	if pk := s.PrioritizedPrimaryField; pk != nil {
+		q.orders = append(q.orders, order{field: pk})
+	}
+	q.limit = 1
+
+	rows := q.run(table.rows)
+	if len(rows) == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	rv.Set(q.project(s, rows[0]))
+	return nil
+}
+
+// FindAll sets slicePtr to the records matching the conditions.
+func (f *Fake) FindAll(slicePtr any, conditions ...orm.Condition) error {
+	if !orm.IsPointer(slicePtr) {
+		return orm.ErrNotPointer
+	}
+
+	slice := reflect.ValueOf(slicePtr).Elem()
+	if slice.Kind() != reflect.Slice {
+		return fmt.Errorf("ormfake: FindAll expects a pointer to a slice, got %T", slicePtr)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	table, err := f.table(slicePtr)
+	if err != nil {
+		return err
+	}
+
+	s := table.schema
+	q, err := compile(s, conditions)
+	if err != nil {
+		return err
+	}
+
+	rows := q.run(table.rows)
+	result := reflect.MakeSlice(slice.Type(), 0, len(rows))
+	for _, row := range rows {
+		value := q.project(s, row)
+		if slice.Type().Elem().Kind() == reflect.Pointer {
+			ptr := reflect.New(value.Type())
+			ptr.Elem().Set(value)
+			value = ptr
+		}
+		result = reflect.Append(result, value)
+	}
+
+	slice.Set(result)
+	return nil
+}
+
+// index of the stored record with the primary key of rv or -1
+func (t *fakeTable) find(rv reflect.Value) int {
+	if isZeroKey(t.schema, rv) {
+		return -1
+	}
+
+	for i, row := range t.rows {
+		if sameKey(t.schema, row, rv) {
+			return i
+		}
+	}
+	return -1
+}
+
+// conditions compiled against a schema
+type query struct {
+	where  []predicate
+	orders []order
+	limit  int
+	offset int
+	fields []*schema.Field // selected fields, nil selects all
+}
+
+type order struct {
+	field *schema.Field
+	desc  bool
+}
+
+func compile(s *schema.Schema, conditions []orm.Condition) (*query, error) {
+	q := &query{}
+
+	for _, condition := range conditions {
+		switch c := condition.(type) {
+		case orm.Where:
+			if strings.TrimSpace(c.Query) == "" {
+				continue
+			}
+
+			pred, err := parseWhere(s, c.Query, c.Args)
+			if err != nil {
+				return nil, err
+			}
+			q.where = append(q.where, pred)
+		case orm.Order:
+			for _, term := range strings.Split(c.Name, ",") {
+				parts := strings.Fields(term)
+				if len(parts) == 0 || len(parts) > 2 {
+					return nil, fmt.Errorf("ormfake: unsupported order %q", c.Name)
+				}
+
+				field := lookupColumn(s, parts[0])
+				if field == nil {
+					return nil, fmt.Errorf("ormfake: unknown column %q in %s", parts[0], s.Table)
+				}
+
+				o := order{field: field}
+				if len(parts) == 2 {
+					switch strings.ToUpper(parts[1]) {
+					case "ASC":
+					case "DESC":
+						o.desc = true
+					default:
+						return nil, fmt.Errorf("ormfake: unsupported order %q", c.Name)
+					}
+				}
+				q.orders = append(q.orders, o)
+			}
+		case orm.Limit:
+			q.limit, q.offset = c.L, c.O
+		case orm.Select:
+			for _, f := range c.Fields {
+				columns, ok := f.(string)
+				if !ok {
+					return nil, fmt.Errorf("ormfake: unsupported select %v", f)
+				}
+
+				for _, column := range strings.Split(columns, ",") {
+					column = strings.TrimSpace(column)
+					if column == "*" {
+						q.fields = nil
+						break
+					}
+
+					field := lookupColumn(s, column)
+					if field == nil {
+						return nil, fmt.Errorf("ormfake: unknown column %q in %s", column, s.Table)
+					}
+					q.fields = append(q.fields, field)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("ormfake: condition %T is not supported by Fake", condition)
+		}
+	}
+	return q, nil
+}
+
+func (q *query) match(row reflect.Value) bool {
+	for _, pred := range q.where {
+		if !pred(row) {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the matching rows, ordered and limited
+func (q *query) run(rows []reflect.Value) []reflect.Value {
+	var result []reflect.Value
+	for _, row := range rows {
+		if q.match(row) {
+			result = append(result, row)
+		}
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		for _, o := range q.orders {
+			a, _ := o.field.ValueOf(background, result[i])
+			b, _ := o.field.ValueOf(background, result[j])
+
+			c := compareNullsFirst(a, b)
+			if c == 0 {
+				continue
+			}
+			return (c < 0) != o.desc
+		}
+		return false
+	})
+
+	if q.offset > 0 {
+		if q.offset >= len(result) {
+			return nil
+		}
+		result = result[q.offset:]
+	}
+
+	if q.limit > 0 && q.limit < len(result) {
+		result = result[:q.limit]
+	}
+	return result
+}
+
+// returns a copy of row with only the selected fields set
+func (q *query) project(s *schema.Schema, row reflect.Value) reflect.Value {
+	if len(q.fields) == 0 {
+		return columns(s, row)
+	}
+
+	value := reflect.New(s.ModelType).Elem()
+	for _, field := range q.fields {
+		v, _ := field.ValueOf(background, row)
+		field.Set(background, value, v)
+	}
+	return value
+}
+
+// sorts NULL before other values like sqlite
+func compareNullsFirst(a, b any) int {
+	a, b = normalize(a), normalize(b)
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	c, _ := compare(a, b)
+	return c
+}
+
+// copies the column fields of rv to a new value. Relationships are left zero.
+func columns(s *schema.Schema, rv reflect.Value) reflect.Value {
+	value := reflect.New(s.ModelType).Elem()
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		// setting NULL would allocate nil embedded pointers
+		if v, _ := field.ValueOf(background, rv); v != nil {
+			field.Set(background, value, v)
+		}
+	}
+	return value
+}
+
+func isZeroKey(s *schema.Schema, rv reflect.Value) bool {
+	if len(s.PrimaryFields) == 0 {
+		return true
+	}
+
+	for _, pk := range s.PrimaryFields {
+		if _, isZero := pk.ValueOf(background, rv); isZero {
+			return true
+		}
+	}
+	return false
+}
+
+func sameKey(s *schema.Schema, a, b reflect.Value) bool {
+	for _, pk := range s.PrimaryFields {
+		x, _ := pk.ValueOf(background, a)
+		y, _ := pk.ValueOf(background, b)
+		if c, ok := compare(x, y); !ok || c != 0 {
+			return false
+		}
+	}
+	return len(s.PrimaryFields) > 0
+}
+
+// sets a timestamp field, which may be a time or unix time integer
+func setTime(field *schema.Field, rv reflect.Value, now time.Time) error {
+	if !isInteger(field.FieldType) {
+		return field.Set(background, rv, now)
+	}
+
+	unit := field.AutoUpdateTime
+	if field.AutoCreateTime > 0 {
+		unit = field.AutoCreateTime
+	}
+
+	switch unit {
+	case schema.UnixNanosecond:
+		return field.Set(background, rv, now.UnixNano())
+	case schema.UnixMillisecond:
+		return field.Set(background, rv, now.UnixMilli())
+	}
+	return field.Set(background, rv, now.Unix())
+}
+
+// returns the field tagged `orm:"version"` or nil
+func versionField(s *schema.Schema) *schema.Field {
+	return taggedField(s, "version")
+}
+
+// returns the first field whose orm tag has option or nil
+func taggedField(s *schema.Schema, option string) *schema.Field {
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+
+		for _, opt := range strings.Split(field.Tag.Get(orm.TagName), ",") {
+			if strings.TrimSpace(opt) == option {
+				return field
+			}
+		}
+	}
+	return nil
+}
+
+// fields stamped with the actor and time of writes, see orm.WithActor
+type stamps struct {
+	createdBy, updatedBy *schema.Field
+	createdAt, updatedAt []*schema.Field
+}
+
+func stampsOf(s *schema.Schema) (stamps, bool) {
+	st := stamps{createdBy: taggedField(s, "created_by"), updatedBy: taggedField(s, "updated_by")}
+	if st.createdBy == nil && st.updatedBy == nil {
+		return st, false
+	}
+
+	for _, field := range s.Fields {
+		if field.DBName != "" && field.AutoCreateTime > 0 {
+			st.createdAt = append(st.createdAt, field)
+		}
+
+		if field.DBName != "" && field.AutoUpdateTime > 0 {
+			st.updatedAt = append(st.updatedAt, field)
+		}
+	}
+	return st, true
+}
+
+func (st stamps) created() []*schema.Field {
+	if st.createdBy == nil {
+		return st.createdAt
+	}
+	return append([]*schema.Field{st.createdBy}, st.createdAt...)
+}
+
+func (st stamps) updated() []*schema.Field {
+	if st.updatedBy == nil {
+		return st.updatedAt
+	}
+	return append([]*schema.Field{st.updatedBy}, st.updatedAt...)
+}
+
+// returns the actor of f for field, zero if there is none
+func (f *Fake) actor(field *schema.Field) any {
+	if actor, ok := orm.ActorFrom(f.ctx); ok {
+		return actor
+	}
+	return reflect.Zero(field.FieldType).Interface()
+}
+
+// sets the updated stamps of rv, and its created stamps if created
+func (f *Fake) stamp(st stamps, rv reflect.Value, created bool) error {
+	fields := st.updated()
+	if created {
+		fields = append(fields, st.created()...)
+	}
+
+	now := f.NowFunc()
+	for _, field := range fields {
+		var err error
+		if field == st.createdBy || field == st.updatedBy {
+			err = field.Set(background, rv, f.actor(field))
+		} else {
+			err = setTime(field, rv, now)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func versionOf(field *schema.Field, rv reflect.Value) int64 {
+	value, _ := field.ValueOf(background, rv)
+	if n, ok := normalize(value).(float64); ok {
+		return int64(n)
+	}
+	return 0
+}
+
+func isInteger(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// dereferences pointers, allocating nil ones
+func indirect(rv reflect.Value) reflect.Value {
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			rv.Set(reflect.New(rv.Type().Elem()))
+		}
+		rv = rv.Elem()
+	}
+	return rv
+}
@@ -0,0 +1,96 @@
+package ormfake_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormfake"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/gorm"
+)
+
+type Post struct {
+	ID    uint   `json:"id" gorm:"primaryKey"`
+	Title string `json:"title"`
+}
+
+type Audit struct {
+	Editor string `json:"editor"`
+}
+
+// embeds a pointer that may be nil
+type Page struct {
+	*Audit
+	ID   uint   `json:"id" gorm:"primaryKey"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+func TestFakeConformance(t *testing.T) {
+	t.Parallel()
+
+	ormtest.RunConformance(t, func(t *testing.T, models ...any) orm.ORM {
+		return ormfake.New()
+	})
+}
+
+func TestFakeUnsupported(t *testing.T) {
+	t.Parallel()
+
+	fake := ormfake.New()
+
+	var posts []Post
+	if err := fake.FindAll(&posts, orm.Preload{Query: "Comments"}); err == nil {
+		t.Error("expected an error for an unsupported condition")
+	}
+
+	if err := fake.FindAll(&posts, orm.Where{Query: "lower(title) = ?", Args: []any{"a"}}); err == nil {
+		t.Error("expected an error for an unsupported expression")
+	}
+
+	if err := fake.FindAll(&posts, orm.Where{Query: "age = ?", Args: []any{1}}); err == nil {
+		t.Error("expected an error for an unknown column")
+	}
+
+	if err := fake.Delete(&Post{}); !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Errorf("expected ErrMissingWhereClause, got %v", err)
+	}
+}
+
+func TestFakeExpressions(t *testing.T) {
+	t.Parallel()
+
+	fake := ormfake.New()
+	fake.Insert(&Page{Name: "home", Slug: "index"})
+	fake.Insert(&Page{Name: "about", Slug: "about", Audit: &Audit{Editor: "ann"}})
+
+	var pages []Page
+	find := func(query string, args ...any) []Page {
+		t.Helper()
+
+		pages = nil
+		if err := fake.FindAll(&pages, orm.Where{Query: query, Args: args}, orm.Order{Name: "id"}); err != nil {
+			t.Fatalf("%s failed with error: %v", query, err)
+		}
+		return pages
+	}
+
+	// columns in IN lists are read from each row
+	if found := find("name IN (slug, ?)", "none"); len(found) != 1 || found[0].Name != "about" {
+		t.Errorf("expected the about page, got %+v", found)
+	}
+
+	// fields of nil embedded pointers are NULL
+	if found := find("editor IS NULL"); len(found) != 1 || found[0].Name != "home" {
+		t.Errorf("expected the home page, got %+v", found)
+	}
+
+	if found := find("editor = ?", "ann"); len(found) != 1 || found[0].Name != "about" {
+		t.Errorf("expected the about page, got %+v", found)
+	}
+
+	if found := find("name LIKE ? OR name LIKE slug", "HO%"); len(found) != 2 {
+		t.Errorf("expected 2 pages, got %+v", found)
+	}
+}
@@ -0,0 +1,579 @@
+package ormtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gorm.io/gorm"
+)
+
+// models used by RunConformance
+type conformanceItem struct {
+	ID        uint
+	Name      string
+	Price     float64
+	Stock     int
+	Notes     *string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type conformanceDoc struct {
+	ID      uint
+	Title   string
+	Version int64 `orm:"version"`
+}
+
+type conformanceTag struct {
+	ID   string `gorm:"primaryKey" orm:"uuid"`
+	Name string
+}
+
+type conformanceEvent struct {
+	ID   string `gorm:"primaryKey" orm:"ulid"`
+	Name string
+}
+
+type conformanceLine struct {
+	OrderID  uint   `gorm:"primaryKey;autoIncrement:false"`
+	Product  string `gorm:"primaryKey"`
+	Quantity int
+}
+
+type conformanceInvoice struct {
+	ID        uint
+	Total     int
+	CreatedBy string `orm:"created_by"`
+	UpdatedBy string `orm:"updated_by"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+/*
+RunConformance checks that an implementation of orm.ORM behaves like the
+gorm backed orm.New. newORM must return an empty ORM for each subtest
+in which the models exist.
+
+	func TestFake(t *testing.T) {
+		ormtest.RunConformance(t, func(t *testing.T, models ...any) orm.ORM {
+			return ormfake.New()
+		})
+	}
+*/
+func RunConformance(t *testing.T, newORM func(t *testing.T, models ...any) orm.ORM) {
+	t.Helper()
+
+	models := []any{&conformanceItem{}, &conformanceDoc{}, &conformanceTag{}, &conformanceEvent{}, &conformanceLine{}, &conformanceInvoice{}}
+	notes := "fragile"
+
+	// inserts apple(1), banana(2), cherry(3), date(4)
+	seed := func(t *testing.T) orm.ORM {
+		o := newORM(t, models...)
+		items := []conformanceItem{
+			{Name: "apple", Price: 1.5, Stock: 10},
+			{Name: "banana", Price: 0.5, Stock: 0, Notes: &notes},
+			{Name: "cherry", Price: 4, Stock: 25},
+			{Name: "date", Price: 2.5, Stock: 5},
+		}
+
+		if err := o.Insert(&items); err != nil {
+			t.Fatalf("insert failed with error: %v", err)
+		}
+		return o
+	}
+
+	names := func(items []conformanceItem) []string {
+		var s []string
+		for _, item := range items {
+			s = append(s, item.Name)
+		}
+		return s
+	}
+
+	t.Run("Insert", func(t *testing.T) {
+		o := newORM(t, models...)
+
+		item := &conformanceItem{Name: "apple"}
+		if err := o.Insert(item); err != nil {
+			t.Fatalf("insert failed with error: %v", err)
+		}
+
+		if item.ID == 0 {
+			t.Error("primary key not assigned")
+		}
+
+		if item.CreatedAt.IsZero() || item.UpdatedAt.IsZero() {
+			t.Error("timestamps not assigned")
+		}
+
+		items := []*conformanceItem{{Name: "banana"}, {Name: "cherry"}}
+		if err := o.Insert(&items); err != nil {
+			t.Fatalf("slice insert failed with error: %v", err)
+		}
+
+		if items[0].ID == 0 || items[1].ID == items[0].ID || items[0].ID == item.ID {
+			t.Errorf("primary keys not assigned to slice: %d, %d", items[0].ID, items[1].ID)
+		}
+	})
+
+	t.Run("InsertMany", func(t *testing.T) {
+		o := newORM(t, models...)
+
+		items := make([]conformanceItem, 5)
+		for i := range items {
+			items[i].Name = fmt.Sprintf("item %d", i)
+		}
+
+		if err := o.InsertMany(&items, 2); err != nil {
+			t.Fatalf("insert many failed with error: %v", err)
+		}
+
+		var stored []conformanceItem
+		o.FindAll(&stored)
+		if len(stored) != 5 || items[4].ID == 0 {
+			t.Errorf("expected 5 records with primary keys, got %d", len(stored))
+		}
+
+		if err := o.InsertMany(&conformanceItem{}, 2); !errors.Is(err, orm.ErrNotSlice) {
+			t.Errorf("expected ErrNotSlice, got %v", err)
+		}
+	})
+
+	t.Run("NotPointer", func(t *testing.T) {
+		o := newORM(t, models...)
+		item := conformanceItem{ID: 1}
+
+		errs := []error{
+			o.Insert(item),
+			o.InsertMany([]conformanceItem{item}, 10),
+			o.Update(item),
+			o.PartialUpdate(item, item, orm.Where{}),
+			o.Delete(item),
+			o.First(item, 1),
+			o.FindOne(item, orm.Where{Query: "id = ?", Args: []any{1}}),
+			o.FindAll([]conformanceItem{}),
+		}
+
+		for i, err := range errs {
+			if !errors.Is(err, orm.ErrNotPointer) {
+				t.Errorf("call %d: expected ErrNotPointer, got %v", i, err)
+			}
+		}
+	})
+
+	t.Run("First", func(t *testing.T) {
+		o := seed(t)
+
+		item := &conformanceItem{}
+		if err := o.First(item, 3); err != nil {
+			t.Fatalf("first failed with error: %v", err)
+		}
+
+		if item.Name != "cherry" || item.Price != 4 || item.Stock != 25 {
+			t.Errorf("unexpected record: %+v", item)
+		}
+
+		err := o.First(&conformanceItem{}, 100)
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected ErrRecordNotFound, got %v", err)
+		}
+
+		err = o.First(&conformanceItem{}, 3, orm.Where{Query: "stock < ?", Args: []any{10}})
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected conditions to apply, got %v", err)
+		}
+
+		selected := &conformanceItem{}
+		if err := o.First(selected, 2, orm.Select{Fields: []any{"id", "name"}}); err != nil {
+			t.Fatal(err)
+		}
+
+		if selected.Name != "banana" || selected.Notes != nil || selected.Price != 0 {
+			t.Errorf("only selected fields should be set, got %+v", selected)
+		}
+	})
+
+	t.Run("FindOne", func(t *testing.T) {
+		o := seed(t)
+
+		item := &conformanceItem{}
+		err := o.FindOne(item, orm.Where{Query: "name LIKE ?", Args: []any{"%ERR%"}})
+		if err != nil || item.Name != "cherry" {
+			t.Errorf("expected cherry, got %q, err: %v", item.Name, err)
+		}
+
+		// the first match by primary key
+		item = &conformanceItem{}
+		err = o.FindOne(item, orm.Where{Query: "price > ?", Args: []any{1}})
+		if err != nil || item.Name != "apple" {
+			t.Errorf("expected apple, got %q, err: %v", item.Name, err)
+		}
+
+		err = o.FindOne(&conformanceItem{}, orm.Where{Query: "name = ?", Args: []any{"fig"}})
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected ErrRecordNotFound, got %v", err)
+		}
+	})
+
+	t.Run("FindAll", func(t *testing.T) {
+		o := seed(t)
+
+		tests := []struct {
+			name       string
+			conditions []orm.Condition
+			want       []string
+		}{
+			{"all", nil, []string{"apple", "banana", "cherry", "date"}},
+			{"equal", []orm.Condition{orm.Where{Query: "name = ?", Args: []any{"date"}}}, []string{"date"}},
+			{"not equal", []orm.Condition{orm.Where{Query: "name <> ? AND name != ?", Args: []any{"date", "apple"}}}, []string{"banana", "cherry"}},
+			{"in", []orm.Condition{orm.Where{Query: "id IN (?)", Args: []any{[]uint{1, 3}}}}, []string{"apple", "cherry"}},
+			{"not in", []orm.Condition{orm.Where{Query: "name NOT IN (?, ?)", Args: []any{"apple", "cherry"}}}, []string{"banana", "date"}},
+			{"between", []orm.Condition{orm.Where{Query: "price BETWEEN ? AND ?", Args: []any{1, 2.5}}}, []string{"apple", "date"}},
+			{"null", []orm.Condition{orm.Where{Query: "notes IS NULL"}}, []string{"apple", "cherry", "date"}},
+			{"not null", []orm.Condition{orm.Where{Query: "notes IS NOT NULL"}}, []string{"banana"}},
+			{"or", []orm.Condition{orm.Where{Query: "(stock = 0 OR stock > ?) AND NOT price > 3", Args: []any{5}}}, []string{"apple", "banana"}},
+			{"not like", []orm.Condition{orm.Where{Query: "name NOT LIKE 'b%'"}}, []string{"apple", "cherry", "date"}},
+			{"where and where", []orm.Condition{
+				orm.Where{Query: "stock > ?", Args: []any{1}},
+				orm.Where{Query: "price < ?", Args: []any{3}},
+			}, []string{"apple", "date"}},
+			{"order", []orm.Condition{orm.Order{Name: "price DESC"}}, []string{"cherry", "date", "apple", "banana"}},
+			{"limit", []orm.Condition{orm.Order{Name: "name"}, orm.Limit{L: 2, O: 1}}, []string{"banana", "cherry"}},
+		}
+
+		for _, tt := range tests {
+			var items []conformanceItem
+			if err := o.FindAll(&items, tt.conditions...); err != nil {
+				t.Errorf("%s: FindAll failed with error: %v", tt.name, err)
+				continue
+			}
+
+			if got := names(items); !equalStrings(got, tt.want) {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.want, got)
+			}
+		}
+
+		var ptrs []*conformanceItem
+		if err := o.FindAll(&ptrs, orm.Where{Query: "id = ?", Args: []any{2}}); err != nil || len(ptrs) != 1 || ptrs[0].Name != "banana" {
+			t.Errorf("expected a slice of pointers with banana, got %v, err: %v", ptrs, err)
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		o := seed(t)
+
+		item := &conformanceItem{}
+		o.First(item, 1)
+		created := item.CreatedAt
+
+		item.Name = "apricot"
+		item.Stock = 0
+		if err := o.Update(item); err != nil {
+			t.Fatalf("update failed with error: %v", err)
+		}
+
+		stored := &conformanceItem{}
+		o.First(stored, 1)
+		if stored.Name != "apricot" || stored.Stock != 0 || !stored.CreatedAt.Equal(created) {
+			t.Errorf("update not stored, got %+v", stored)
+		}
+	})
+
+	t.Run("PartialUpdate", func(t *testing.T) {
+		o := seed(t)
+
+		item := &conformanceItem{}
+		o.First(item, 1)
+
+		err := o.PartialUpdate(item, conformanceItem{Name: "apricot"}, orm.Where{Query: "id = ?", Args: []any{item.ID}})
+		if err != nil {
+			t.Fatalf("partial update failed with error: %v", err)
+		}
+
+		if item.Name != "apricot" || item.Stock != 10 {
+			t.Errorf("model not updated, got %+v", item)
+		}
+
+		// zero values are written from maps
+		err = o.PartialUpdate(item, map[string]any{"stock": 0}, orm.Where{})
+		if err != nil {
+			t.Fatalf("partial update with map failed with error: %v", err)
+		}
+
+		stored := &conformanceItem{}
+		o.First(stored, 1)
+		if stored.Name != "apricot" || stored.Stock != 0 || stored.Price != 1.5 {
+			t.Errorf("partial update not stored, got %+v", stored)
+		}
+
+		// only records matching the where condition are updated
+		err = o.PartialUpdate(&conformanceItem{}, map[string]any{"stock": 1}, orm.Where{Query: "price > ?", Args: []any{2}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var items []conformanceItem
+		o.FindAll(&items, orm.Where{Query: "stock = ?", Args: []any{1}})
+		if got := names(items); !equalStrings(got, []string{"cherry", "date"}) {
+			t.Errorf("expected cherry and date to be updated, got %v", got)
+		}
+
+		err = o.PartialUpdate(&conformanceItem{ID: 100}, conformanceItem{Name: "x"}, orm.Where{})
+		if !errors.Is(err, orm.ErrNoRecordsUpdated) {
+			t.Errorf("expected ErrNoRecordsUpdated, got %v", err)
+		}
+
+		err = o.PartialUpdate(&conformanceItem{ID: 1}, conformanceItem{Name: "x"}, orm.Where{Query: "name = ?", Args: []any{"apple"}})
+		if !errors.Is(err, orm.ErrNoRecordsUpdated) {
+			t.Errorf("expected ErrNoRecordsUpdated, got %v", err)
+		}
+	})
+
+	t.Run("FieldMask", func(t *testing.T) {
+		o := seed(t)
+
+		item := &conformanceItem{}
+		o.First(item, 1)
+
+		mask := orm.FieldMask{Values: conformanceItem{Name: "ignored"}, Fields: []string{"Stock"}, Allowed: orm.AllFields}
+		if err := o.PartialUpdate(item, mask, orm.Where{}); err != nil {
+			t.Fatalf("partial update with mask failed with error: %v", err)
+		}
+
+		stored := &conformanceItem{}
+		o.First(stored, 1)
+		if stored.Name != "apple" || stored.Stock != 0 {
+			t.Errorf("expected only stock to be zeroed, got %+v", stored)
+		}
+
+		banana := &conformanceItem{}
+		o.First(banana, 2)
+		mask, err := orm.MergePatch(banana, []byte(`{"Notes": null, "Price": 0}`), []string{"Notes", "Price"})
+		if err != nil {
+			t.Fatalf("MergePatch failed with error: %v", err)
+		}
+
+		if err := o.PartialUpdate(banana, mask, orm.Where{}); err != nil {
+			t.Fatalf("partial update with merge patch failed with error: %v", err)
+		}
+
+		stored = &conformanceItem{}
+		o.First(stored, 2)
+		if stored.Notes != nil || stored.Price != 0 || stored.Name != "banana" {
+			t.Errorf("merge patch not stored, got %+v", stored)
+		}
+
+		mask.Allowed = []string{"Price"}
+		if err := o.PartialUpdate(banana, mask, orm.Where{}); !errors.Is(err, orm.ErrFieldNotAllowed) {
+			t.Errorf("expected ErrFieldNotAllowed, got %v", err)
+		}
+
+		mask = orm.FieldMask{Values: conformanceItem{}, Fields: []string{"ID"}, Allowed: orm.AllFields}
+		if err := o.PartialUpdate(banana, mask, orm.Where{}); !errors.Is(err, orm.ErrFieldNotAllowed) {
+			t.Errorf("expected ErrFieldNotAllowed updating the primary key, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		o := seed(t)
+
+		if err := o.Delete(&conformanceItem{ID: 1}); err != nil {
+			t.Fatalf("delete failed with error: %v", err)
+		}
+
+		err := o.Delete(&conformanceItem{}, orm.Where{Query: "stock < ?", Args: []any{10}})
+		if err != nil {
+			t.Fatalf("delete with conditions failed with error: %v", err)
+		}
+
+		var items []conformanceItem
+		o.FindAll(&items)
+		if got := names(items); !equalStrings(got, []string{"cherry"}) {
+			t.Errorf("expected only cherry to remain, got %v", got)
+		}
+
+		if err := o.First(&conformanceItem{}, 1); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected deleted record to be gone, got %v", err)
+		}
+	})
+
+	t.Run("Keys", func(t *testing.T) {
+		o := newORM(t, models...)
+
+		tags := []conformanceTag{{Name: "go"}, {Name: "sql"}}
+		if err := o.Insert(&tags); err != nil {
+			t.Fatalf("insert failed with error: %v", err)
+		}
+
+		if len(tags[0].ID) != 36 || tags[0].ID[14] != '7' || tags[0].ID == tags[1].ID {
+			t.Errorf("expected distinct UUIDv7 keys, got %q and %q", tags[0].ID, tags[1].ID)
+		}
+
+		tag := &conformanceTag{}
+		if err := o.First(tag, tags[1].ID); err != nil || tag.Name != "sql" {
+			t.Errorf("expected sql by uuid, got %+v, err: %v", tag, err)
+		}
+
+		event := &conformanceEvent{Name: "signup"}
+		if err := o.Insert(event); err != nil || len(event.ID) != 26 {
+			t.Fatalf("expected ULID key, got %q, err: %v", event.ID, err)
+		}
+
+		if err := o.First(&conformanceEvent{}, event.ID); err != nil {
+			t.Errorf("expected event by ulid, got %v", err)
+		}
+
+		lines := []conformanceLine{
+			{OrderID: 1, Product: "a", Quantity: 2},
+			{OrderID: 1, Product: "b", Quantity: 3},
+			{OrderID: 2, Product: "a", Quantity: 4},
+		}
+
+		if err := o.Insert(&lines); err != nil {
+			t.Fatalf("insert failed with error: %v", err)
+		}
+
+		keys := []struct {
+			key  any
+			want int
+		}{
+			{map[string]any{"order_id": 1, "product": "b"}, 3},
+			{map[string]any{"OrderID": 2, "Product": "a"}, 4},
+			{conformanceLine{OrderID: 1, Product: "a"}, 2},
+			{&struct {
+				OrderID uint
+				Product string
+			}{2, "a"}, 4},
+		}
+
+		for _, k := range keys {
+			line := &conformanceLine{}
+			if err := o.First(line, k.key); err != nil || line.Quantity != k.want {
+				t.Errorf("First(%v): expected quantity %d, got %d, err: %v", k.key, k.want, line.Quantity, err)
+			}
+		}
+
+		invalid := []any{1, map[string]any{"order_id": 1}, struct{ OrderID uint }{1}, nil}
+		for _, key := range invalid {
+			if err := o.First(&conformanceLine{}, key); !errors.Is(err, orm.ErrInvalidKey) {
+				t.Errorf("First(%v): expected ErrInvalidKey, got %v", key, err)
+			}
+		}
+
+		if err := o.First(&conformanceLine{}, conformanceLine{OrderID: 3, Product: "a"}); !errors.Is(err, gorm.ErrRecordNotFound) {
+			t.Errorf("expected ErrRecordNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Stamps", func(t *testing.T) {
+		o := newORM(t, models...)
+		as := func(actor string) orm.ORM {
+			return o.WithContext(orm.WithActor(context.Background(), actor))
+		}
+
+		spoofed := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+		invoice := &conformanceInvoice{Total: 1, CreatedBy: "mallory", UpdatedBy: "mallory", CreatedAt: spoofed}
+		if err := as("alice").Insert(invoice); err != nil {
+			t.Fatalf("insert failed with error: %v", err)
+		}
+
+		if invoice.CreatedBy != "alice" || invoice.UpdatedBy != "alice" || invoice.CreatedAt.Year() == 2000 {
+			t.Errorf("expected invoice stamped by alice, got %+v", invoice)
+		}
+
+		stored := func() *conformanceInvoice {
+			stored := &conformanceInvoice{}
+			if err := o.First(stored, invoice.ID); err != nil {
+				t.Fatal(err)
+			}
+			return stored
+		}
+
+		update := stored()
+		update.Total = 2
+		update.CreatedBy = "mallory"
+		update.CreatedAt = spoofed
+		if err := as("bob").Update(update); err != nil {
+			t.Fatalf("update failed with error: %v", err)
+		}
+
+		if got := stored(); got.Total != 2 || got.CreatedBy != "alice" || got.UpdatedBy != "bob" || got.CreatedAt.Year() == 2000 {
+			t.Errorf("expected invoice created by alice and updated by bob, got %+v", got)
+		}
+
+		spoof := map[string]any{"total": 3, "created_by": "mallory", "updated_by": "mallory"}
+		if err := as("carol").PartialUpdate(&conformanceInvoice{ID: invoice.ID}, spoof, orm.Where{}); err != nil {
+			t.Fatalf("partial update failed with error: %v", err)
+		}
+
+		if got := stored(); got.Total != 3 || got.CreatedBy != "alice" || got.UpdatedBy != "carol" {
+			t.Errorf("expected invoice updated by carol, got %+v", got)
+		}
+
+		model := &conformanceInvoice{ID: invoice.ID}
+		err := as("dave").PartialUpdate(model, conformanceInvoice{Total: 4, CreatedBy: "mallory"}, orm.Where{})
+		if err != nil || model.UpdatedBy != "dave" {
+			t.Errorf("expected model updated by dave, got %+v, err: %v", model, err)
+		}
+
+		if got := stored(); got.Total != 4 || got.CreatedBy != "alice" {
+			t.Errorf("expected invoice created by alice, got %+v", got)
+		}
+
+		anonymous := &conformanceInvoice{CreatedBy: "mallory"}
+		if err := o.Insert(anonymous); err != nil || anonymous.CreatedBy != "" {
+			t.Errorf("expected no actor without context, got %q, err: %v", anonymous.CreatedBy, err)
+		}
+	})
+
+	t.Run("OptimisticLocking", func(t *testing.T) {
+		o := newORM(t, models...)
+
+		doc := &conformanceDoc{Title: "draft"}
+		if err := o.Insert(doc); err != nil {
+			t.Fatal(err)
+		}
+
+		first, second := &conformanceDoc{}, &conformanceDoc{}
+		o.First(first, doc.ID)
+		o.First(second, doc.ID)
+
+		first.Title = "first"
+		if err := o.Update(first); err != nil || first.Version != 1 {
+			t.Fatalf("expected version 1, got %d, err: %v", first.Version, err)
+		}
+
+		var stale *orm.ErrStaleObject
+		second.Title = "second"
+		if err := o.Update(second); !errors.As(err, &stale) || stale.Current != 1 || stale.Version != 0 {
+			t.Errorf("expected ErrStaleObject at version 1, got %v", err)
+		}
+
+		err := o.PartialUpdate(first, conformanceDoc{Title: "partial"}, orm.Where{})
+		if err != nil || first.Version != 2 {
+			t.Errorf("expected version 2, got %d, err: %v", first.Version, err)
+		}
+
+		err = o.PartialUpdate(second, map[string]any{"title": "stale"}, orm.Where{})
+		if !errors.As(err, &stale) || stale.Current != 2 {
+			t.Errorf("expected ErrStaleObject at version 2, got %v", err)
+		}
+	})
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
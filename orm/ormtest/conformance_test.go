@@ -0,0 +1,16 @@
+package ormtest_test
+
+import (
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+func TestSQLiteConformance(t *testing.T) {
+	t.Parallel()
+
+	ormtest.RunConformance(t, func(t *testing.T, models ...any) orm.ORM {
+		return orm.New(ormtest.NewDB(t, models...))
+	})
+}
@@ -0,0 +1,142 @@
+/*
+Package ormtest provides isolated databases and assertions for tests
+of code that uses the orm package.
+
+	func TestPosts(t *testing.T) {
+		t.Parallel()
+
+		db := ormtest.NewDB(t, &Post{}, &Comment{})
+		dborm := orm.New(db)
+		...
+		ormtest.AssertCount[Post](t, db, 1)
+	}
+*/
+package ormtest
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// makes database names unique across tests with the same name
+var counter uint64
+
+// NewDB returns an in-memory sqlite database that is private to t,
+// migrated with models. The database is closed when the test ends.
+//
+// Unlike orm.MemorySQLiteDB, parallel tests do not see each other's data.
+func NewDB(t testing.TB, models ...any) *gorm.DB {
+	t.Helper()
+
+	name := strings.NewReplacer("/", "_", " ", "_", "#", "_").Replace(t.Name())
+	dsn := fmt.Sprintf("file:%s_%d?mode=memory&cache=shared&_foreign_keys=1",
+		name, atomic.AddUint64(&counter, 1))
+
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("ormtest: unable to open database: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		t.Fatalf("ormtest: %v", err)
+	}
+
+	// the database is dropped when its last connection closes
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if len(models) > 0 {
+		if err := db.AutoMigrate(models...); err != nil {
+			t.Fatalf("ormtest: unable to run gorm automigrate: %v", err)
+		}
+	}
+	return db
+}
+
+// Tx begins a transaction on db that is rolled back when the test ends.
+// Use the returned transaction for all queries of the test.
+func Tx(t testing.TB, db *gorm.DB) *gorm.DB {
+	t.Helper()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatalf("ormtest: unable to begin transaction: %v", tx.Error)
+	}
+
+	t.Cleanup(func() { tx.Rollback() })
+	return tx
+}
+
+// Run runs fn as a subtest of t inside a transaction on db.
+// Changes made by fn are rolled back when it returns.
+func Run(t *testing.T, db *gorm.DB, name string, fn func(t *testing.T, tx *gorm.DB)) bool {
+	t.Helper()
+
+	return t.Run(name, func(t *testing.T) {
+		fn(t, Tx(t, db))
+	})
+}
+
+// AssertCount fails the test if the number of records of T matching
+// the conditions is not want.
+func AssertCount[T any](t testing.TB, db *gorm.DB, want int64, conditions ...orm.Condition) {
+	t.Helper()
+
+	count, err := orm.Count[T](db, conditions...)
+	if err != nil {
+		t.Fatalf("ormtest: counting %T: %v", *new(T), err)
+	}
+
+	if count != want {
+		t.Errorf("expected %d records of %T, got %d", want, *new(T), count)
+	}
+}
+
+// AssertExists fails the test if no record of T matches the conditions.
+func AssertExists[T any](t testing.TB, db *gorm.DB, conditions ...orm.Condition) {
+	t.Helper()
+
+	count, err := orm.Count[T](db, conditions...)
+	if err != nil {
+		t.Fatalf("ormtest: counting %T: %v", *new(T), err)
+	}
+
+	if count == 0 {
+		t.Errorf("expected a record of %T to exist%s", *new(T), describe(conditions))
+	}
+}
+
+// AssertNotExists fails the test if any record of T matches the conditions.
+func AssertNotExists[T any](t testing.TB, db *gorm.DB, conditions ...orm.Condition) {
+	t.Helper()
+
+	count, err := orm.Count[T](db, conditions...)
+	if err != nil {
+		t.Fatalf("ormtest: counting %T: %v", *new(T), err)
+	}
+
+	if count != 0 {
+		t.Errorf("expected no record of %T%s, found %d", *new(T), describe(conditions), count)
+	}
+}
+
+// describes the where conditions of an assertion for failure messages
+func describe(conditions []orm.Condition) string {
+	var parts []string
+	for _, c := range conditions {
+		if where, ok := c.(orm.Where); ok {
+			parts = append(parts, fmt.Sprintf("%s %v", where.Query, where.Args))
+		}
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+	return " where " + strings.Join(parts, " and ")
+}
@@ -0,0 +1,47 @@
+package ormtest_test
+
+import (
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/gorm"
+)
+
+type Post struct {
+	ID    uint   `json:"id" gorm:"primaryKey"`
+	Title string `json:"title"`
+}
+
+func TestIsolatedDatabases(t *testing.T) {
+	t.Parallel()
+
+	for _, name := range []string{"first", "second", "third"} {
+		name := name
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			db := ormtest.NewDB(t, &Post{})
+			if err := orm.New(db).Insert(&Post{Title: name}); err != nil {
+				t.Fatal(err)
+			}
+
+			// each test only sees its own post
+			ormtest.AssertCount[Post](t, db, 1)
+			ormtest.AssertExists[Post](t, db, orm.Where{Query: "title = ?", Args: []any{name}})
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{})
+
+	ormtest.Run(t, db, "insert", func(t *testing.T, tx *gorm.DB) {
+		orm.New(tx).Insert(&Post{Title: "rolled back"})
+		ormtest.AssertCount[Post](t, tx, 1)
+	})
+
+	ormtest.AssertNotExists[Post](t, db, orm.Where{Query: "title = ?", Args: []any{"rolled back"}})
+}
@@ -0,0 +1,93 @@
+/*
+Package outbox publishes events reliably with a transactional outbox.
+
+Messages are written to the outbox table in the transaction of the write
+they describe, so that either both are committed or neither is:
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&order).Error; err != nil {
+			return err
+		}
+		_, err := outbox.Write(tx, "orders.created", fmt.Sprint(order.ID), order)
+		return err
+	})
+
+A relay delivers pending messages in order to a publisher, e.g a websocket
+hub or a webhook:
+
+	relay := outbox.NewRelay(db, outbox.PublisherFunc(func(ctx context.Context, m outbox.Message) error {
+		return hub.BroadcastChange(ws.Change{Op: m.Topic, Payload: m.Payload})
+	}), outbox.RelayOptions{})
+	go relay.Run(ctx)
+
+Delivery is at least once: a message is published again if the relay
+stops before recording its delivery, so consumers should be idempotent.
+*/
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Name of the outbox table.
+const TableName = "orm_outbox"
+
+// Message is a row of the outbox table.
+type Message struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	Topic       string          `json:"topic" gorm:"not null"`
+	Key         string          `json:"key"` // e.g the id of the record, for consumers
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"last_error"`
+	CreatedAt   time.Time       `json:"created_at"`
+	DeliveredAt *time.Time      `json:"delivered_at" gorm:"index"`
+}
+
+func (Message) TableName() string {
+	return TableName
+}
+
+// Migrate creates or updates the outbox table.
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(&Message{})
+}
+
+// Write adds a message with payload encoded as JSON to the outbox.
+// Call it with the transaction of the write the message describes.
+func Write[T any](tx *gorm.DB, topic, key string, payload T) (*Message, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("outbox: unable to encode payload of %s: %w", topic, err)
+	}
+
+	m := &Message{Topic: topic, Key: key, Payload: data}
+	if err := tx.Create(m).Error; err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Pending returns the messages not yet delivered, oldest first.
+func Pending(ctx context.Context, db *gorm.DB, limit int) ([]Message, error) {
+	query := db.WithContext(ctx).Where("delivered_at IS NULL").Order("id")
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	var messages []Message
+	err := query.Find(&messages).Error
+	return messages, err
+}
+
+// Prune deletes the messages delivered before t.
+// It returns the number of deleted messages.
+func Prune(ctx context.Context, db *gorm.DB, before time.Time) (int64, error) {
+	tx := db.WithContext(ctx).Where("delivered_at < ?", before.UTC()).Delete(&Message{})
+	return tx.RowsAffected, tx.Error
+}
@@ -0,0 +1,164 @@
+package outbox_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"github.com/abiiranathan/gowrap/orm/outbox"
+	"gorm.io/gorm"
+)
+
+type Order struct {
+	ID    uint `gorm:"primaryKey"`
+	Total int
+}
+
+func newDB(t *testing.T) *gorm.DB {
+	db := ormtest.NewDB(t, &Order{})
+	if err := outbox.Migrate(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// writes an order with its message
+func createOrder(db *gorm.DB, total int, fail bool) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		order := &Order{Total: total}
+		if err := tx.Create(order).Error; err != nil {
+			return err
+		}
+
+		if _, err := outbox.Write(tx, "orders.created", "", order); err != nil {
+			return err
+		}
+
+		if fail {
+			return errors.New("rollback")
+		}
+		return nil
+	})
+}
+
+type recorder struct {
+	mu       sync.Mutex
+	topics   []string
+	payloads []string
+	fail     bool
+}
+
+func (r *recorder) Publish(ctx context.Context, m outbox.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fail {
+		return errors.New("unavailable")
+	}
+	r.topics = append(r.topics, m.Topic)
+	r.payloads = append(r.payloads, string(m.Payload))
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	t.Parallel()
+
+	db := newDB(t)
+	ctx := context.Background()
+
+	createOrder(db, 10, false)
+	createOrder(db, 20, true)
+	createOrder(db, 30, false)
+
+	pending, err := outbox.Pending(ctx, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(pending) != 2 {
+		t.Fatalf("messages of rolled back transactions must not be written, got %d", len(pending))
+	}
+
+	pub := &recorder{fail: true}
+	relay := outbox.NewRelay(db, pub, outbox.RelayOptions{})
+
+	if n, err := relay.RelayOnce(ctx); n != 0 || err == nil {
+		t.Errorf("expected failed delivery, got %d, %v", n, err)
+	}
+
+	pending, _ = outbox.Pending(ctx, db, 0)
+	if pending[0].Attempts != 1 || pending[0].LastError != "unavailable" || pending[1].Attempts != 0 {
+		t.Errorf("expected failure recorded on the first message, got %+v", pending)
+	}
+
+	pub.fail = false
+	if n, err := relay.RelayOnce(ctx); n != 2 || err != nil {
+		t.Fatalf("expected 2 deliveries, got %d, %v", n, err)
+	}
+
+	want := []string{`{"ID":1,"Total":10}`, `{"ID":2,"Total":30}`}
+	if len(pub.payloads) != 2 || pub.payloads[0] != want[0] || pub.payloads[1] != want[1] {
+		t.Errorf("expected messages in order, got %v", pub.payloads)
+	}
+
+	if pending, _ = outbox.Pending(ctx, db, 0); len(pending) != 0 {
+		t.Errorf("expected no pending messages, got %+v", pending)
+	}
+
+	n, err := outbox.Prune(ctx, db, time.Now().Add(time.Minute))
+	if n != 2 || err != nil {
+		t.Errorf("expected 2 pruned messages, got %d, %v", n, err)
+	}
+}
+
+func TestRelayRun(t *testing.T) {
+	t.Parallel()
+
+	db := newDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for i := 1; i <= 3; i++ {
+		createOrder(db, i, false)
+	}
+
+	pub := &recorder{}
+	relay := outbox.NewRelay(db, pub, outbox.RelayOptions{
+		BatchSize:    2,
+		PollInterval: 10 * time.Millisecond,
+		Delete:       true,
+	})
+
+	done := make(chan error)
+	go func() { done <- relay.Run(ctx) }()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		pub.mu.Lock()
+		n := len(pub.topics)
+		pub.mu.Unlock()
+
+		if n == 3 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatalf("expected 3 deliveries, got %d", n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context canceled, got %v", err)
+	}
+
+	var count int64
+	db.Model(&outbox.Message{}).Count(&count)
+	if count != 0 {
+		t.Errorf("delivered messages must be deleted, got %d", count)
+	}
+}
@@ -0,0 +1,138 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"gorm.io/gorm"
+)
+
+// Publisher delivers messages of the outbox.
+type Publisher interface {
+	Publish(ctx context.Context, m Message) error
+}
+
+// PublisherFunc adapts a function to a Publisher.
+type PublisherFunc func(ctx context.Context, m Message) error
+
+func (f PublisherFunc) Publish(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+// Name of the lock held by running relays.
+const LockName = "orm:outbox_relay"
+
+// RelayOptions configure a relay.
+type RelayOptions struct {
+	// Number of messages read at once. Defaults to 100.
+	BatchSize int
+
+	// How long to wait before reading the outbox again when it is empty
+	// or a delivery failed. Defaults to one second.
+	PollInterval time.Duration
+
+	// Delete messages once delivered instead of marking them delivered.
+	Delete bool
+
+	// Time to live of the lock ensuring a single relay delivers at a time.
+	// Defaults to 30 seconds.
+	LockTTL time.Duration
+}
+
+// Relay delivers the messages of the outbox to a publisher.
+type Relay struct {
+	db   *gorm.DB
+	pub  Publisher
+	opts RelayOptions
+}
+
+// NewRelay returns a relay of the outbox of db to pub.
+func NewRelay(db *gorm.DB, pub Publisher, opts RelayOptions) *Relay {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = time.Second
+	}
+
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = 30 * time.Second
+	}
+	return &Relay{db: db, pub: pub, opts: opts}
+}
+
+// Run delivers messages until ctx is done. Relays of other processes wait
+// while one of them runs, so that messages are delivered in order.
+func (r *Relay) Run(ctx context.Context) error {
+	for ctx.Err() == nil {
+		err := orm.WithLock(ctx, r.db, LockName, r.opts.LockTTL, r.loop)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox: %v", err)
+			r.wait(ctx)
+		}
+	}
+	return ctx.Err()
+}
+
+// delivers messages while the lock is held
+func (r *Relay) loop(ctx context.Context) error {
+	for ctx.Err() == nil {
+		n, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("outbox: %v", err)
+		}
+
+		if err != nil || n < r.opts.BatchSize {
+			r.wait(ctx)
+		}
+	}
+	return nil
+}
+
+func (r *Relay) wait(ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(r.opts.PollInterval):
+	}
+}
+
+// RelayOnce delivers a batch of pending messages in order and returns the
+// number delivered. It stops at the first message that fails to publish,
+// recording the error, so that later messages are not delivered before it.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	messages, err := Pending(ctx, r.db, r.opts.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	db := r.db.WithContext(ctx)
+	for i, m := range messages {
+		if err := r.pub.Publish(ctx, m); err != nil {
+			db.Model(&Message{}).Where("id = ?", m.ID).Updates(map[string]any{
+				"attempts":   gorm.Expr("attempts + 1"),
+				"last_error": err.Error(),
+			})
+			return i, err
+		}
+
+		if err := r.delivered(db, m); err != nil {
+			return i, err
+		}
+	}
+	return len(messages), nil
+}
+
+func (r *Relay) delivered(db *gorm.DB, m Message) error {
+	if r.opts.Delete {
+		return db.Delete(&Message{}, m.ID).Error
+	}
+
+	now := time.Now().UTC()
+	return db.Model(&Message{}).Where("id = ?", m.ID).Updates(map[string]any{
+		"attempts":     gorm.Expr("attempts + 1"),
+		"delivered_at": &now,
+	}).Error
+}
@@ -0,0 +1,518 @@
+package orm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// The field can't be updated, or is not in the allowlist of the update
+	ErrFieldNotAllowed = errors.New("field not allowed")
+
+	// The JSON patch document is malformed or one of its operations failed
+	ErrInvalidPatch = errors.New("invalid patch")
+)
+
+/*
+FieldMask selects the fields of Values updated by PartialUpdate. Unlike
+structs, masked fields are updated even if they hold zero values.
+
+	err := dborm.PartialUpdate(&post, orm.FieldMask{
+		Values:  Post{Published: false, Views: 0},
+		Fields:  []string{"published", "views"},
+		Allowed: []string{"title", "published", "views"},
+	}, orm.Where{})
+
+Fields are named by json name, field name or column. Primary keys and
+fields that gorm does not update can't be masked, nor fields missing
+from Allowed. Every updatable field is allowed by AllFields only.
+*/
+type FieldMask struct {
+	Values  any      // struct or pointer to struct holding the new values
+	Fields  []string // fields to update
+	Allowed []string // fields that may be updated e.g AllFields
+
+	byJSONName bool // fields are named by json name only, see MergePatch
+}
+
+// Allowlist of field masks and patches allowing every updatable field.
+var AllFields = []string{"*"}
+
+// Columns returns the values of the masked fields by column of s.
+func (m FieldMask) Columns(s *schema.Schema) (map[string]any, error) {
+	if len(m.Allowed) == 0 {
+		return nil, fmt.Errorf("%w: field mask of %s has no allowlist", ErrFieldNotAllowed, s.Name)
+	}
+
+	rv := indirectValue(m.Values)
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("field mask: values must be a struct, got %T", m.Values)
+	}
+
+	lookup := lookupField
+	if m.byJSONName {
+		lookup = lookupJSONField
+	}
+
+	values := make(map[string]any, len(m.Fields))
+	for _, name := range m.Fields {
+		field := lookup(s, name)
+		if field == nil {
+			return nil, fmt.Errorf("%w: unknown field %q of %s", ErrFieldNotAllowed, name, s.Name)
+		}
+
+		if field.PrimaryKey || !field.Updatable || !fieldIn(field, m.Allowed) {
+			return nil, fmt.Errorf("%w: %q of %s", ErrFieldNotAllowed, name, s.Name)
+		}
+
+		if rv.Type() == s.ModelType {
+			values[field.DBName], _ = field.ValueOf(context.Background(), rv)
+			continue
+		}
+
+		value := rv.FieldByName(field.Name)
+		if !value.IsValid() {
+			return nil, fmt.Errorf("field mask: %s has no field %s", rv.Type(), field.Name)
+		}
+		values[field.DBName] = value.Interface()
+	}
+	return values, nil
+}
+
+// returns the json name of field, empty if it is not serialized
+func jsonName(field *schema.Field) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// returns the column of s named name, a column, field or json name
+func lookupField(s *schema.Schema, name string) *schema.Field {
+	if field := s.LookUpField(name); field != nil {
+		if field.DBName == "" {
+			return nil
+		}
+		return field
+	}
+
+	for _, field := range s.Fields {
+		if field.DBName != "" && jsonName(field) == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// returns the column of s with json name name. Fields that are not
+// serialized have no json name, so that patches can't name them.
+func lookupJSONField(s *schema.Schema, name string) *schema.Field {
+	for _, field := range s.Fields {
+		if field.DBName != "" && name != "" && jsonName(field) == name {
+			return field
+		}
+	}
+	return nil
+}
+
+// returns true if names allows field
+func fieldIn(field *schema.Field, names []string) bool {
+	for _, name := range names {
+		if name == "*" || name == field.DBName || name == field.Name || name == jsonName(field) {
+			return true
+		}
+	}
+	return false
+}
+
+// converts the updates of PartialUpdate of model to a map of columns if
+// they are a field mask or a map, whose keys may be json names. Keys
+// must name updatable fields of model.
+func resolveUpdates(db *gorm.DB, model any, updates any) (any, error) {
+	switch u := updates.(type) {
+	case FieldMask:
+		s, err := parseSchema(db, model)
+		if err != nil {
+			return nil, err
+		}
+		return u.Columns(s)
+	case map[string]any:
+		s, err := parseSchema(db, model)
+		if err != nil {
+			return nil, err
+		}
+
+		values := make(map[string]any, len(u))
+		for key, value := range u {
+			field := lookupField(s, key)
+			if field == nil {
+				return nil, fmt.Errorf("%w: unknown field %q of %s", ErrFieldNotAllowed, key, s.Name)
+			}
+
+			if field.PrimaryKey || !field.Updatable {
+				return nil, fmt.Errorf("%w: %q of %s", ErrFieldNotAllowed, key, s.Name)
+			}
+			values[field.DBName] = value
+		}
+		return values, nil
+	}
+	return updates, nil
+}
+
+/*
+MergePatch returns the field mask applying a JSON merge patch (RFC 7396)
+to model, which should hold the current record.
+
+	mask, err := orm.MergePatch(&post, body, []string{"title", "published"})
+	if err != nil {
+		return err
+	}
+	err = dborm.PartialUpdate(&post, mask, orm.Where{})
+
+The fields of the mask are the top level members of the patch. A member
+set to null sets its field to NULL or its zero value. Nested objects are
+merged with the current value of their field. Members are matched to
+fields by json name only, so fields hidden with `json:"-"` can't be
+patched. An allowlist is required, pass AllFields to allow every
+updatable field.
+*/
+func MergePatch(model any, patch []byte, allowed []string) (FieldMask, error) {
+	if len(allowed) == 0 {
+		return FieldMask{}, fmt.Errorf("%w: merge patch has no allowlist", ErrFieldNotAllowed)
+	}
+
+	var members map[string]any
+	if err := decodeJSON(patch, &members); err != nil || members == nil {
+		return FieldMask{}, fmt.Errorf("%w: merge patch must be a JSON object", ErrInvalidPatch)
+	}
+
+	doc, err := modelDocument(model)
+	if err != nil {
+		return FieldMask{}, err
+	}
+
+	fields := make([]string, 0, len(members))
+	for name := range members {
+		fields = append(fields, name)
+	}
+	sort.Strings(fields)
+
+	return patchedMask(model, mergePatch(doc, members), fields, allowed)
+}
+
+// applies patch to target as described in RFC 7396
+func mergePatch(target any, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = make(map[string]any)
+	}
+
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = mergePatch(object[name], value)
+		}
+	}
+	return object
+}
+
+// an operation of a JSON patch
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+/*
+JSONPatch returns the field mask applying a JSON patch (RFC 6902) to
+model, which should hold the current record.
+
+	// [{"op": "replace", "path": "/views", "value": 0}, {"op": "remove", "path": "/summary"}]
+	mask, err := orm.JSONPatch(&post, body, []string{"views", "summary"})
+
+The fields of the mask are those changed by the operations, named by the
+first token of their paths. Removed fields are set to NULL or their zero
+value. If a test operation fails, ErrInvalidPatch is returned. Like in
+MergePatch, an allowlist is required.
+*/
+func JSONPatch(model any, patch []byte, allowed []string) (FieldMask, error) {
+	if len(allowed) == 0 {
+		return FieldMask{}, fmt.Errorf("%w: JSON patch has no allowlist", ErrFieldNotAllowed)
+	}
+
+	var operations []patchOperation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return FieldMask{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+
+	doc, err := modelDocument(model)
+	if err != nil {
+		return FieldMask{}, err
+	}
+
+	var fields []string
+	touch := func(tokens []string) {
+		for _, field := range fields {
+			if field == tokens[0] {
+				return
+			}
+		}
+		fields = append(fields, tokens[0])
+	}
+
+	for _, op := range operations {
+		path, err := parsePointer(op.Path)
+		if err != nil {
+			return FieldMask{}, err
+		}
+
+		var value any
+		if op.Op == "add" || op.Op == "replace" || op.Op == "test" {
+			if op.Value == nil {
+				return FieldMask{}, fmt.Errorf("%w: %s at %s has no value", ErrInvalidPatch, op.Op, op.Path)
+			}
+
+			if err := decodeJSON(op.Value, &value); err != nil {
+				return FieldMask{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+			}
+		}
+
+		if op.Op == "move" || op.Op == "copy" {
+			from, err := parsePointer(op.From)
+			if err != nil {
+				return FieldMask{}, err
+			}
+
+			if value, err = valueAt(doc, from); err != nil {
+				return FieldMask{}, err
+			}
+
+			if op.Op == "move" {
+				if doc, err = applyAt(doc, from, removeMember); err != nil {
+					return FieldMask{}, err
+				}
+				touch(from)
+			} else {
+				value = cloneJSON(value)
+			}
+		}
+
+		switch op.Op {
+		case "add", "move", "copy":
+			doc, err = applyAt(doc, path, addMember(value))
+		case "remove":
+			doc, err = applyAt(doc, path, removeMember)
+		case "replace":
+			doc, err = applyAt(doc, path, replaceMember(value))
+		case "test":
+			var current any
+			if current, err = valueAt(doc, path); err == nil && !reflect.DeepEqual(current, value) {
+				err = fmt.Errorf("%w: test failed at %s", ErrInvalidPatch, op.Path)
+			}
+
+			if err != nil {
+				return FieldMask{}, err
+			}
+			continue
+		default:
+			err = fmt.Errorf("%w: unknown operation %q", ErrInvalidPatch, op.Op)
+		}
+
+		if err != nil {
+			return FieldMask{}, err
+		}
+		touch(path)
+	}
+	return patchedMask(model, doc, fields, allowed)
+}
+
+// parses a JSON pointer (RFC 6901) to a member of the document
+func parsePointer(pointer string) ([]string, error) {
+	if !strings.HasPrefix(pointer, "/") || pointer == "/" {
+		return nil, fmt.Errorf("%w: path %q does not point to a field", ErrInvalidPatch, pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// returns the value at tokens in doc
+func valueAt(doc any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch c := doc.(type) {
+		case map[string]any:
+			value, ok := c[token]
+			if !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrInvalidPatch, token)
+			}
+			doc = value
+		case []any:
+			i, err := arrayIndex(token, len(c)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = c[i]
+		default:
+			return nil, fmt.Errorf("%w: %q is not in a container", ErrInvalidPatch, token)
+		}
+	}
+	return doc, nil
+}
+
+// applies op to the container holding the last token and returns doc
+func applyAt(doc any, tokens []string, op func(container any, token string) (any, error)) (any, error) {
+	if len(tokens) == 1 {
+		return op(doc, tokens[0])
+	}
+
+	child, err := valueAt(doc, tokens[:1])
+	if err != nil {
+		return nil, err
+	}
+
+	child, err = applyAt(child, tokens[1:], op)
+	if err != nil {
+		return nil, err
+	}
+
+	switch c := doc.(type) {
+	case map[string]any:
+		c[tokens[0]] = child
+	case []any:
+		i, _ := arrayIndex(tokens[0], len(c)-1)
+		c[i] = child
+	}
+	return doc, nil
+}
+
+// parses the index of an array element, at most max
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("%w: invalid array index %q", ErrInvalidPatch, token)
+	}
+	return i, nil
+}
+
+func addMember(value any) func(container any, token string) (any, error) {
+	return func(container any, token string) (any, error) {
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+			return c, nil
+		case []any:
+			i := len(c)
+			if token != "-" {
+				var err error
+				if i, err = arrayIndex(token, len(c)); err != nil {
+					return nil, err
+				}
+			}
+			c = append(c, nil)
+			copy(c[i+1:], c[i:])
+			c[i] = value
+			return c, nil
+		}
+		return nil, fmt.Errorf("%w: %q is not in a container", ErrInvalidPatch, token)
+	}
+}
+
+func removeMember(container any, token string) (any, error) {
+	if _, err := valueAt(container, []string{token}); err != nil {
+		return nil, err
+	}
+
+	switch c := container.(type) {
+	case map[string]any:
+		delete(c, token)
+		return c, nil
+	case []any:
+		i, _ := arrayIndex(token, len(c)-1)
+		return append(c[:i], c[i+1:]...), nil
+	}
+	return container, nil
+}
+
+func replaceMember(value any) func(container any, token string) (any, error) {
+	return func(container any, token string) (any, error) {
+		if _, err := valueAt(container, []string{token}); err != nil {
+			return nil, err
+		}
+
+		switch c := container.(type) {
+		case map[string]any:
+			c[token] = value
+		case []any:
+			i, _ := arrayIndex(token, len(c)-1)
+			c[i] = value
+		}
+		return container, nil
+	}
+}
+
+// decodes JSON keeping numbers as written, so that they compare equal
+func decodeJSON(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func cloneJSON(v any) any {
+	data, _ := json.Marshal(v)
+	var clone any
+	decodeJSON(data, &clone)
+	return clone
+}
+
+// returns the JSON object of model
+func modelDocument(model any) (any, error) {
+	data, err := json.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc map[string]any
+	if err := decodeJSON(data, &doc); err != nil || doc == nil {
+		return nil, fmt.Errorf("patch: %T is not a JSON object", model)
+	}
+	return doc, nil
+}
+
+// returns the mask of fields with values decoded from the patched document
+func patchedMask(model any, doc any, fields []string, allowed []string) (FieldMask, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return FieldMask{}, err
+	}
+
+	values := reflect.New(indirectValue(model).Type())
+	if err := json.Unmarshal(data, values.Interface()); err != nil {
+		return FieldMask{}, fmt.Errorf("%w: %v", ErrInvalidPatch, err)
+	}
+	return FieldMask{Values: values.Interface(), Fields: fields, Allowed: allowed, byJSONName: true}, nil
+}
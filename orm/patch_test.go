@@ -0,0 +1,156 @@
+package orm_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+type Profile struct {
+	ID       uint    `json:"id"`
+	Name     string  `json:"name"`
+	Nickname string  `json:"nickname"`
+	Age      int     `json:"age"`
+	Bio      *string `json:"bio"`
+}
+
+func TestJSONPatch(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Profile{})
+	dborm := orm.New(db)
+
+	bio := "Gopher"
+	profile := &Profile{Name: "Rob", Age: 40, Bio: &bio}
+	dborm.Insert(profile)
+
+	patch := []byte(`[
+		{"op": "test", "path": "/name", "value": "Rob"},
+		{"op": "replace", "path": "/age", "value": 0},
+		{"op": "remove", "path": "/bio"},
+		{"op": "copy", "from": "/name", "path": "/nickname"}
+	]`)
+
+	mask, err := orm.JSONPatch(profile, patch, []string{"age", "bio", "nickname"})
+	if err != nil {
+		t.Fatalf("JSONPatch failed with error: %v", err)
+	}
+
+	if err := dborm.PartialUpdate(profile, mask, orm.Where{}); err != nil {
+		t.Fatalf("PartialUpdate failed with error: %v", err)
+	}
+
+	stored := &Profile{}
+	dborm.First(stored, profile.ID)
+	if stored.Age != 0 || stored.Bio != nil || stored.Nickname != "Rob" || stored.Name != "Rob" {
+		t.Errorf("patch not stored, got %+v", stored)
+	}
+
+	_, err = orm.JSONPatch(profile, []byte(`[{"op": "test", "path": "/name", "value": "Ken"}]`), orm.AllFields)
+	if !errors.Is(err, orm.ErrInvalidPatch) {
+		t.Errorf("expected ErrInvalidPatch for a failed test, got %v", err)
+	}
+
+	_, err = orm.JSONPatch(profile, []byte(`[{"op": "replace", "path": "/missing", "value": 1}]`), orm.AllFields)
+	if !errors.Is(err, orm.ErrInvalidPatch) {
+		t.Errorf("expected ErrInvalidPatch replacing a missing member, got %v", err)
+	}
+
+	mask, _ = orm.JSONPatch(profile, []byte(`[{"op": "replace", "path": "/name", "value": "Ken"}]`), []string{"age"})
+	if err := dborm.PartialUpdate(profile, mask, orm.Where{}); !errors.Is(err, orm.ErrFieldNotAllowed) {
+		t.Errorf("expected ErrFieldNotAllowed, got %v", err)
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Profile{})
+	dborm := orm.New(db)
+
+	bio := "Gopher"
+	profile := &Profile{Name: "Rob", Age: 40, Bio: &bio}
+	dborm.Insert(profile)
+
+	if _, err := orm.MergePatch(profile, []byte(`{"age": 0}`), nil); !errors.Is(err, orm.ErrFieldNotAllowed) {
+		t.Errorf("expected ErrFieldNotAllowed without an allowlist, got %v", err)
+	}
+
+	mask, err := orm.MergePatch(profile, []byte(`{"age": 0, "bio": null}`), orm.AllFields)
+	if err != nil {
+		t.Fatalf("MergePatch failed with error: %v", err)
+	}
+
+	if err := dborm.PartialUpdate(profile, mask, orm.Where{}); err != nil {
+		t.Fatalf("PartialUpdate failed with error: %v", err)
+	}
+
+	stored := &Profile{}
+	dborm.First(stored, profile.ID)
+	if stored.Age != 0 || stored.Bio != nil || stored.Name != "Rob" {
+		t.Errorf("patch not stored, got %+v", stored)
+	}
+
+	// maps may be keyed by json name
+	if err := dborm.PartialUpdate(profile, map[string]any{"nickname": "Bobby"}, orm.Where{}); err != nil {
+		t.Fatalf("PartialUpdate failed with error: %v", err)
+	}
+
+	err = dborm.PartialUpdate(profile, map[string]any{"nickname = 'x', name": "Bobby"}, orm.Where{})
+	if !errors.Is(err, orm.ErrFieldNotAllowed) {
+		t.Errorf("expected ErrFieldNotAllowed for an unknown key, got %v", err)
+	}
+
+	if _, err := orm.MergePatch(profile, []byte(`[1]`), orm.AllFields); !errors.Is(err, orm.ErrInvalidPatch) {
+		t.Errorf("expected ErrInvalidPatch, got %v", err)
+	}
+
+	mask, _ = orm.MergePatch(profile, []byte(`{"id": 2}`), orm.AllFields)
+	if err := dborm.PartialUpdate(profile, mask, orm.Where{}); !errors.Is(err, orm.ErrFieldNotAllowed) {
+		t.Errorf("expected ErrFieldNotAllowed updating the primary key, got %v", err)
+	}
+}
+
+type Account struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	Password string `json:"-"`
+}
+
+func TestPatchHiddenFields(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Account{})
+	dborm := orm.New(db)
+
+	account := &Account{Name: "a", Password: "secret"}
+	dborm.Insert(account)
+
+	// members name fields by json name, never by column or field name
+	patches := map[string]func() (orm.FieldMask, error){
+		"merge patch": func() (orm.FieldMask, error) {
+			return orm.MergePatch(account, []byte(`{"password": null, "name": "b"}`), orm.AllFields)
+		},
+		"merge patch by field name": func() (orm.FieldMask, error) {
+			return orm.MergePatch(account, []byte(`{"Password": "", "name": "b"}`), orm.AllFields)
+		},
+		"JSON patch": func() (orm.FieldMask, error) {
+			return orm.JSONPatch(account, []byte(`[{"op": "add", "path": "/password", "value": ""}]`), orm.AllFields)
+		},
+	}
+
+	for name, patch := range patches {
+		mask, err := patch()
+		if err != nil {
+			t.Fatalf("%s failed with error: %v", name, err)
+		}
+
+		if err := dborm.PartialUpdate(account, mask, orm.Where{}); !errors.Is(err, orm.ErrFieldNotAllowed) {
+			t.Errorf("%s: expected ErrFieldNotAllowed, got %v", name, err)
+		}
+	}
+
+	ormtest.AssertExists[Account](t, db, orm.Where{Query: "name = ? AND password = ?", Args: []any{"a", "secret"}})
+}
@@ -0,0 +1,291 @@
+package orm
+
+import (
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/utils"
+)
+
+// Default capacity of a QueryLog.
+const DefaultQueryLogSize = 100
+
+// Default duration from which queries are recorded by a QueryLog.
+const DefaultSlowThreshold = 200 * time.Millisecond
+
+// QueryLogOptions configure a QueryLog.
+type QueryLogOptions struct {
+	// Number of queries kept. Defaults to DefaultQueryLogSize.
+	Size int
+
+	// Queries taking at least this long are recorded. Failed queries are
+	// always recorded. Defaults to DefaultSlowThreshold, use a negative
+	// value to record every query.
+	Threshold time.Duration
+
+	// Replaces the arguments of recorded queries. Defaults to RedactArg.
+	Redact func(arg any) any
+}
+
+// SlowQuery is a query recorded by a QueryLog.
+type SlowQuery struct {
+	Time     time.Time     `json:"time"`     // when the query started
+	SQL      string        `json:"sql"`      // SQL with placeholders
+	Args     []any         `json:"args"`     // redacted arguments
+	Duration time.Duration `json:"duration"` // in nanoseconds
+	Rows     int64         `json:"rows"`     // rows affected or returned
+	Caller   string        `json:"caller"`   // file:line of the code that made the query
+	Error    string        `json:"error,omitempty"`
+}
+
+/*
+QueryLog keeps the most recent slow or failed queries of a database in
+a bounded in-memory buffer. It implements http.Handler, rendering the
+queries as HTML, or as JSON when requested with ?format=json or an
+Accept header of application/json.
+
+	querylog := orm.NewQueryLog(orm.QueryLogOptions{Threshold: 100 * time.Millisecond})
+	querylog.Register(db)
+
+	mux.Handle("/admin/queries", adminOnly(querylog))
+
+Register a single QueryLog per database.
+*/
+type QueryLog struct {
+	opts QueryLogOptions
+
+	mu      sync.Mutex
+	entries []SlowQuery // ring buffer
+	next    int         // index of the next entry
+	full    bool
+}
+
+// NewQueryLog returns an empty query log.
+func NewQueryLog(opts QueryLogOptions) *QueryLog {
+	if opts.Size <= 0 {
+		opts.Size = DefaultQueryLogSize
+	}
+
+	if opts.Threshold == 0 {
+		opts.Threshold = DefaultSlowThreshold
+	}
+
+	if opts.Redact == nil {
+		opts.Redact = RedactArg
+	}
+	return &QueryLog{opts: opts, entries: make([]SlowQuery, opts.Size)}
+}
+
+// RedactArg hides strings, bytes and other values that may hold personal
+// data or secrets. Numbers, booleans, times and nil are kept.
+func RedactArg(arg any) any {
+	switch arg.(type) {
+	case nil, bool, int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64, float32, float64, time.Time:
+		return arg
+	}
+	return "[redacted]"
+}
+
+// name of the setting holding the start time of a statement
+const queryStartKey = "orm:query_start"
+
+// Register records the slow and failed queries made through db and its sessions.
+func (l *QueryLog) Register(db *gorm.DB) error {
+	cb := db.Callback()
+
+	type registerer interface {
+		Register(name string, fn func(*gorm.DB)) error
+	}
+
+	starts := []registerer{
+		cb.Create().Before("*"),
+		cb.Query().Before("*"),
+		cb.Update().Before("*"),
+		cb.Delete().Before("*"),
+		cb.Row().Before("*"),
+		cb.Raw().Before("*"),
+	}
+
+	for _, c := range starts {
+		if err := c.Register("orm:querylog_start", l.start); err != nil {
+			return err
+		}
+	}
+
+	records := []registerer{
+		cb.Create().After("*"),
+		cb.Query().After("*"),
+		cb.Update().After("*"),
+		cb.Delete().After("*"),
+		cb.Row().After("*"),
+		cb.Raw().After("*"),
+	}
+
+	for _, c := range records {
+		if err := c.Register("orm:querylog_record", l.record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *QueryLog) start(tx *gorm.DB) {
+	tx.InstanceSet(queryStartKey, time.Now())
+}
+
+func (l *QueryLog) record(tx *gorm.DB) {
+	value, ok := tx.InstanceGet(queryStartKey)
+	if !ok || tx.DryRun || tx.Statement.SQL.Len() == 0 {
+		return
+	}
+
+	started := value.(time.Time)
+	duration := time.Since(started)
+
+	failed := tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound)
+	if !failed && duration < l.opts.Threshold {
+		return
+	}
+
+	args := make([]any, len(tx.Statement.Vars))
+	for i, v := range tx.Statement.Vars {
+		args[i] = l.opts.Redact(v)
+	}
+
+	query := SlowQuery{
+		Time:     started,
+		SQL:      tx.Statement.SQL.String(),
+		Args:     args,
+		Duration: duration,
+		Rows:     tx.RowsAffected,
+		Caller:   caller(),
+	}
+
+	if failed {
+		query.Error = tx.Error.Error()
+	}
+	l.add(query)
+}
+
+func (l *QueryLog) add(q SlowQuery) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries[l.next] = q
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// Queries returns the recorded queries, most recent first.
+func (l *QueryLog) Queries() []SlowQuery {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.entries)
+	}
+
+	queries := make([]SlowQuery, n)
+	for i := range queries {
+		queries[i] = l.entries[(l.next-1-i+len(l.entries))%len(l.entries)]
+	}
+	return queries
+}
+
+// Reset removes the recorded queries.
+func (l *QueryLog) Reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = make([]SlowQuery, len(l.entries))
+	l.next = 0
+	l.full = false
+}
+
+// directory of this package, skipped when looking for the caller
+var ormSourceDir = func() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Dir(file)
+}()
+
+// returns the file and line of the first caller outside gorm and this package
+func caller() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		internal := filepath.Dir(frame.File) == ormSourceDir && !strings.HasSuffix(frame.File, "_test.go")
+		if !internal && !strings.Contains(frame.File, "gorm.io/") {
+			return frame.File + ":" + strconv.Itoa(frame.Line)
+		}
+
+		if !more {
+			break
+		}
+	}
+	return utils.FileWithLineNum()
+}
+
+var queryLogTemplate = template.Must(template.New("querylog").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Slow queries</title>
+<style>
+body { font-family: sans-serif; margin: 1rem; }
+table { border-collapse: collapse; width: 100%; }
+th, td { border: 1px solid #ddd; padding: 0.4rem; text-align: left; vertical-align: top; font-size: 0.9rem; }
+td.sql { font-family: monospace; white-space: pre-wrap; }
+tr.error td { background: #fdecea; }
+</style>
+</head>
+<body>
+<h1>Slow queries ({{len .}})</h1>
+<table>
+<tr><th>Time</th><th>Duration</th><th>SQL</th><th>Args</th><th>Rows</th><th>Caller</th><th>Error</th></tr>
+{{range .}}<tr{{if .Error}} class="error"{{end}}>
+<td>{{.Time.Format "2006-01-02 15:04:05.000"}}</td>
+<td>{{.Duration}}</td>
+<td class="sql">{{.SQL}}</td>
+<td>{{range $i, $arg := .Args}}{{if $i}}, {{end}}{{printf "%v" $arg}}{{end}}</td>
+<td>{{.Rows}}</td>
+<td>{{.Caller}}</td>
+<td>{{.Error}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// ServeHTTP renders the recorded queries as HTML or JSON.
+func (l *QueryLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	queries := l.Queries()
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(queries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := queryLogTemplate.Execute(w, queries); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
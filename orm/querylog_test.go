@@ -0,0 +1,95 @@
+package orm_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+)
+
+func TestQueryLog(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
+	querylog := orm.NewQueryLog(orm.QueryLogOptions{Size: 2, Threshold: -1})
+	if err := querylog.Register(db); err != nil {
+		t.Fatal(err)
+	}
+
+	dborm := orm.New(db)
+	if err := dborm.Insert(&Post{Title: "secret title"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var posts []Post
+	if err := dborm.FindAll(&posts, orm.Where{Query: "id > ?", Args: []any{0}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.Exec("SELECT * FROM missing").Error; err == nil {
+		t.Fatal("expected error querying a missing table")
+	}
+
+	queries := querylog.Queries()
+	if len(queries) != 2 {
+		t.Fatalf("expected the 2 most recent queries, got %d", len(queries))
+	}
+
+	failed, found := queries[0], queries[1]
+	if failed.SQL != "SELECT * FROM missing" || !strings.Contains(failed.Error, "no such table") {
+		t.Errorf("unexpected failed query: %+v", failed)
+	}
+
+	if !strings.HasPrefix(found.SQL, "SELECT * FROM `posts` WHERE id > ?") || found.Rows != 1 || found.Error != "" {
+		t.Errorf("unexpected query: %+v", found)
+	}
+
+	if len(found.Args) != 1 || found.Args[0] != 0 {
+		t.Errorf("numbers must not be redacted, got %v", found.Args)
+	}
+
+	if !strings.Contains(found.Caller, "querylog_test.go:") {
+		t.Errorf("expected caller in querylog_test.go, got %q", found.Caller)
+	}
+
+	// only the insert has a string argument
+	querylog.Reset()
+	dborm.Insert(&Post{Title: "another secret"})
+	if queries = querylog.Queries(); len(queries) != 1 || queries[0].Args[0] != "[redacted]" {
+		t.Errorf("expected redacted title, got %+v", queries)
+	}
+
+	rec := httptest.NewRecorder()
+	querylog.ServeHTTP(rec, httptest.NewRequest("GET", "/queries?format=json", nil))
+
+	var decoded []orm.SlowQuery
+	if err := json.NewDecoder(rec.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(decoded) != 1 || !strings.HasPrefix(decoded[0].SQL, "INSERT INTO `posts`") {
+		t.Errorf("unexpected JSON queries: %+v", decoded)
+	}
+
+	rec = httptest.NewRecorder()
+	querylog.ServeHTTP(rec, httptest.NewRequest("GET", "/queries", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "INSERT INTO `posts`") || strings.Contains(body, "another secret") {
+		t.Errorf("unexpected HTML: %s", body)
+	}
+}
+
+func TestQueryLogThreshold(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Post{}, &Comment{})
+	querylog := orm.NewQueryLog(orm.QueryLogOptions{})
+	querylog.Register(db)
+
+	orm.New(db).Insert(&Post{Title: "fast"})
+	if queries := querylog.Queries(); len(queries) != 0 {
+		t.Errorf("fast queries must not be recorded, got %+v", queries)
+	}
+}
@@ -0,0 +1,353 @@
+package orm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// The model has no fields tagged with `orm:"search"`
+	ErrNoSearchFields = errors.New("model has no search fields")
+
+	// The database dialect does not support full-text search
+	ErrUnsupportedDialect = errors.New("unsupported database dialect")
+)
+
+// Name of the generated tsvector column added to postgres tables.
+const SearchVectorColumn = "search_vector"
+
+// Text search configuration used by postgres when none is specified.
+const DefaultSearchLanguage = "english"
+
+/*
+Search filters records with full-text search and orders them by rank.
+
+Fields included in the index are tagged with `orm:"search"` and the index
+is created with MigrateSearch:
+
+	type Post struct {
+		ID    uint
+		Title string `orm:"search"`
+		Body  string `orm:"search"`
+	}
+
+	err := orm.MigrateSearch(db, orm.DefaultSearchLanguage, &Post{})
+	err = dborm.FindAll(&posts, orm.Search{Model: &Post{}, Query: `"go generics" -java`})
+
+On postgres the query is parsed with websearch_to_tsquery and ranked with ts_rank.
+On sqlite it is matched against an FTS5 table and ranked with bm25.
+Quoted phrases, OR and -term are supported by both. A query of -terms only
+matches the records without them. An empty query does not filter the results.
+*/
+type Search struct {
+	// Model whose search index is queried e.g &Post{}
+	Model any
+
+	// Search terms entered by the user
+	Query string
+
+	// postgres text search configuration, default: DefaultSearchLanguage.
+	// Must match the language passed to MigrateSearch.
+	Language string
+}
+
+func (s Search) Apply(db *gorm.DB) *gorm.DB {
+	// an empty search does not filter the results
+	if strings.TrimSpace(s.Query) == "" {
+		return db
+	}
+
+	sch, err := parseSchema(db, s.Model)
+	if err != nil {
+		db.AddError(err)
+		return db
+	}
+
+	table := db.Statement.Quote(sch.Table)
+	switch db.Dialector.Name() {
+	case "postgres":
+		vector := table + "." + db.Statement.Quote(SearchVectorColumn)
+		query := clause.Expr{
+			SQL:  "websearch_to_tsquery(?::regconfig, ?)",
+			Vars: []any{searchLanguage(s.Language), s.Query},
+		}
+
+		return db.Where("? @@ ?", clause.Expr{SQL: vector}, query).
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:                "ts_rank(?, ?) DESC",
+				Vars:               []any{clause.Expr{SQL: vector}, query},
+				WithoutParentheses: true,
+			}})
+	case "sqlite":
+		pk := sch.PrioritizedPrimaryField
+		if pk == nil {
+			db.AddError(fmt.Errorf("search: %s has no primary key", sch.Table))
+			return db
+		}
+
+		fts := db.Statement.Quote(ftsTable(sch.Table))
+		match, excluded := ftsQuery(s.Query)
+		if match == "" && excluded == "" {
+			return db
+		}
+
+		// like websearch_to_tsquery, only -terms match the rows without them
+		if match == "" {
+			return db.Where(fmt.Sprintf("%s.%s NOT IN (SELECT rowid FROM %s WHERE %s MATCH ?)",
+				table, db.Statement.Quote(pk.DBName), fts, fts), excluded)
+		}
+
+		return db.Where(fmt.Sprintf("%s.%s IN (SELECT rowid FROM %s WHERE %s MATCH ?)",
+			table, db.Statement.Quote(pk.DBName), fts, fts), match).
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL: fmt.Sprintf("(SELECT bm25(%s) FROM %s WHERE %s MATCH ? AND rowid = %s.%s)",
+					fts, fts, fts, table, db.Statement.Quote(pk.DBName)),
+				Vars:               []any{match},
+				WithoutParentheses: true,
+			}})
+	}
+
+	db.AddError(fmt.Errorf("search: %w %q", ErrUnsupportedDialect, db.Dialector.Name()))
+	return db
+}
+
+/*
+MigrateSearch creates or refreshes the full-text index for each model.
+
+On postgres a generated tsvector column (SearchVectorColumn) with a GIN index is
+added to the table. On sqlite an external content FTS5 table named <table>_fts is
+created together with triggers that keep it in sync with the table.
+
+Run it after AutoMigrate. If the tagged fields change, call DropSearch first.
+The language is the postgres text search configuration and is ignored by sqlite.
+*/
+func MigrateSearch(db *gorm.DB, language string, models ...any) error {
+	for _, model := range models {
+		sch, columns, err := searchColumns(db, model)
+		if err != nil {
+			return err
+		}
+
+		var statements []string
+		switch db.Dialector.Name() {
+		case "postgres":
+			statements = postgresSearchDDL(db, sch, columns, searchLanguage(language))
+		case "sqlite":
+			statements, err = sqliteSearchDDL(db, sch, columns)
+			if err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("search: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+		}
+
+		err = Transaction(db, func(tx *gorm.DB) error {
+			for _, sql := range statements {
+				if err := tx.Exec(sql).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+
+		if err != nil {
+			return fmt.Errorf("search: migrating %s: %w", sch.Table, err)
+		}
+	}
+	return nil
+}
+
+// DropSearch removes the full-text index created by MigrateSearch.
+func DropSearch(db *gorm.DB, models ...any) error {
+	for _, model := range models {
+		sch, err := parseSchema(db, model)
+		if err != nil {
+			return err
+		}
+
+		table := db.Statement.Quote(sch.Table)
+		var statements []string
+		switch db.Dialector.Name() {
+		case "postgres":
+			statements = []string{
+				fmt.Sprintf("ALTER TABLE %s DROP COLUMN IF EXISTS %s", table, db.Statement.Quote(SearchVectorColumn)),
+			}
+		case "sqlite":
+			fts := ftsTable(sch.Table)
+			for _, suffix := range []string{"ai", "ad", "au"} {
+				statements = append(statements, fmt.Sprintf("DROP TRIGGER IF EXISTS %s",
+					db.Statement.Quote(fts+"_"+suffix)))
+			}
+			statements = append(statements, fmt.Sprintf("DROP TABLE IF EXISTS %s", db.Statement.Quote(fts)))
+		default:
+			return fmt.Errorf("search: %w %q", ErrUnsupportedDialect, db.Dialector.Name())
+		}
+
+		for _, sql := range statements {
+			if err := db.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// returns the schema and quoted column names of fields tagged for search
+func searchColumns(db *gorm.DB, model any) (*schema.Schema, []string, error) {
+	sch, err := parseSchema(db, model)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var columns []string
+	for _, field := range sch.Fields {
+		if field.DBName != "" && hasTagOption(field, "search") {
+			columns = append(columns, db.Statement.Quote(field.DBName))
+		}
+	}
+
+	if len(columns) == 0 {
+		return nil, nil, fmt.Errorf("search: %s: %w", sch.Table, ErrNoSearchFields)
+	}
+	return sch, columns, nil
+}
+
+func postgresSearchDDL(db *gorm.DB, sch *schema.Schema, columns []string, language string) []string {
+	document := make([]string, len(columns))
+	for i, column := range columns {
+		document[i] = fmt.Sprintf("coalesce(%s::text, '')", column)
+	}
+
+	table := db.Statement.Quote(sch.Table)
+	vector := db.Statement.Quote(SearchVectorColumn)
+	return []string{
+		fmt.Sprintf("ALTER TABLE %s ADD COLUMN IF NOT EXISTS %s tsvector GENERATED ALWAYS AS (to_tsvector('%s', %s)) STORED",
+			table, vector, strings.ReplaceAll(language, "'", "''"), strings.Join(document, " || ' ' || ")),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)",
+			db.Statement.Quote("idx_"+sch.Table+"_"+SearchVectorColumn), table, vector),
+	}
+}
+
+func sqliteSearchDDL(db *gorm.DB, sch *schema.Schema, columns []string) ([]string, error) {
+	pk := sch.PrioritizedPrimaryField
+	if pk == nil || len(sch.PrimaryFields) != 1 {
+		return nil, fmt.Errorf("search: %s must have a single integer primary key", sch.Table)
+	}
+
+	table := db.Statement.Quote(sch.Table)
+	name := ftsTable(sch.Table)
+	fts := db.Statement.Quote(name)
+	id := db.Statement.Quote(pk.DBName)
+	cols := strings.Join(columns, ", ")
+
+	prefixed := func(prefix string) string {
+		values := make([]string, len(columns))
+		for i, column := range columns {
+			values[i] = prefix + "." + column
+		}
+		return strings.Join(values, ", ")
+	}
+
+	insert := fmt.Sprintf("INSERT INTO %s(rowid, %s) VALUES (new.%s, %s);", fts, cols, id, prefixed("new"))
+	remove := fmt.Sprintf("INSERT INTO %s(%s, rowid, %s) VALUES ('delete', old.%s, %s);", fts, fts, cols, id, prefixed("old"))
+
+	return []string{
+		fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content=%s, content_rowid=%s)",
+			fts, cols, quoteLiteral(sch.Table), quoteLiteral(pk.DBName)),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s AFTER INSERT ON %s BEGIN %s END",
+			db.Statement.Quote(name+"_ai"), table, insert),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s AFTER DELETE ON %s BEGIN %s END",
+			db.Statement.Quote(name+"_ad"), table, remove),
+		fmt.Sprintf("CREATE TRIGGER IF NOT EXISTS %s AFTER UPDATE ON %s BEGIN %s %s END",
+			db.Statement.Quote(name+"_au"), table, remove, insert),
+		fmt.Sprintf("INSERT INTO %s(%s) VALUES ('rebuild')", fts, fts),
+	}, nil
+}
+
+// name of the sqlite FTS5 table for table
+func ftsTable(table string) string {
+	return table + "_fts"
+}
+
+func searchLanguage(language string) string {
+	if language == "" {
+		return DefaultSearchLanguage
+	}
+	return language
+}
+
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Converts web search syntax into an FTS5 query so that user input
+// can not produce syntax errors. Terms are quoted, "phrases" are kept,
+// OR is passed through and -term becomes NOT. Without other terms, the
+// match is empty and excluded matches any of the -terms.
+func ftsQuery(query string) (match, excluded string) {
+	var (
+		terms    []string
+		negative []string
+		term     strings.Builder
+		quoted   bool
+		negated  bool
+	)
+
+	flush := func() {
+		if term.Len() == 0 {
+			return
+		}
+
+		text := term.String()
+		term.Reset()
+
+		switch {
+		case !quoted && strings.EqualFold(text, "or"):
+			if len(terms) > 0 && terms[len(terms)-1] != "OR" {
+				terms = append(terms, "OR")
+			}
+		case negated:
+			negative = append(negative, `"`+strings.ReplaceAll(text, `"`, `""`)+`"`)
+		default:
+			terms = append(terms, `"`+strings.ReplaceAll(text, `"`, `""`)+`"`)
+		}
+		negated = false
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			flush()
+			quoted = !quoted
+		case quoted:
+			term.WriteRune(r)
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		case r == '-' && term.Len() == 0:
+			negated = true
+		default:
+			term.WriteRune(r)
+		}
+	}
+	flush()
+
+	if len(terms) > 0 && terms[len(terms)-1] == "OR" {
+		terms = terms[:len(terms)-1]
+	}
+
+	// FTS5 NOT is a binary operator, so exclusions follow the other terms
+	if len(terms) == 0 {
+		return "", strings.Join(negative, " OR ")
+	}
+
+	match = "(" + strings.Join(terms, " ") + ")"
+	for _, term := range negative {
+		match += " NOT " + term
+	}
+	return match, ""
+}
@@ -0,0 +1,131 @@
+package orm_test
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+type Article struct {
+	ID    uint   `json:"id" gorm:"primaryKey"`
+	Title string `json:"title" orm:"search"`
+	Body  string `json:"body" orm:"search"`
+}
+
+func TestSearchSqlite(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Article{})
+
+	dborm := orm.New(db)
+	dborm.Insert(&Article{Title: "Generics in Go", Body: "type parameters for go programmers"})
+
+	err := orm.MigrateSearch(db, orm.DefaultSearchLanguage, &Article{})
+	if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+		// skipped tests are only reported with -v
+		fmt.Fprintln(os.Stderr, "WARNING: TestSearchSqlite skipped, sqlite3 built without fts5: run tests with -tags sqlite_fts5")
+		t.Skip("sqlite3 built without fts5, run tests with -tags sqlite_fts5")
+	}
+
+	if err != nil {
+		t.Fatalf("MigrateSearch failed with error: %v", err)
+	}
+
+	// migrations are idempotent
+	if err := orm.MigrateSearch(db, orm.DefaultSearchLanguage, &Article{}); err != nil {
+		t.Fatalf("MigrateSearch failed on second run: %v", err)
+	}
+
+	// rows inserted after migration are indexed by the triggers
+	dborm.Insert(&Article{Title: "Java streams", Body: "go is mentioned once"})
+	dborm.Insert(&Article{Title: "Go go go", Body: "go concurrency with go routines in go"})
+
+	articles := []Article{}
+	err = dborm.FindAll(&articles, orm.Search{Model: &Article{}, Query: "go"})
+	if err != nil {
+		t.Fatalf("search failed with error: %v", err)
+	}
+
+	if len(articles) != 3 {
+		t.Fatalf("expected 3 matches, got %d", len(articles))
+	}
+
+	if articles[0].Title != "Go go go" {
+		t.Errorf("expected best match first, got %q", articles[0].Title)
+	}
+
+	articles = []Article{}
+	err = dborm.FindAll(&articles, orm.Search{Model: &Article{}, Query: `go -java "type parameters"`})
+	if err != nil {
+		t.Fatalf("search failed with error: %v", err)
+	}
+
+	if len(articles) != 1 || articles[0].Title != "Generics in Go" {
+		t.Errorf("unexpected search results: %+v", articles)
+	}
+
+	// only excluded terms match the other rows, as on postgres
+	articles = []Article{}
+	err = dborm.FindAll(&articles, orm.Search{Model: &Article{}, Query: "-java -concurrency"})
+	if err != nil {
+		t.Fatalf("search failed with error: %v", err)
+	}
+
+	if len(articles) != 1 || articles[0].Title != "Generics in Go" {
+		t.Errorf("unexpected results excluding terms: %+v", articles)
+	}
+
+	// updates and deletes keep the index in sync
+	dborm.PartialUpdate(&articles[0], map[string]any{"body": "nothing here"}, orm.Where{})
+	dborm.FindAll(&articles, orm.Search{Model: &Article{}, Query: `"type parameters"`})
+	if len(articles) != 0 {
+		t.Errorf("expected updated article not to match, got %d", len(articles))
+	}
+
+	// input that is invalid FTS5 syntax does not fail
+	err = dborm.FindAll(&articles, orm.Search{Model: &Article{}, Query: `AND ( "unbalanced`})
+	if err != nil {
+		t.Errorf("search with special characters failed: %v", err)
+	}
+
+	if err := orm.DropSearch(db, &Article{}); err != nil {
+		t.Errorf("DropSearch failed with error: %v", err)
+	}
+}
+
+func TestSearchPostgresSQL(t *testing.T) {
+	t.Parallel()
+
+	db, err := gorm.Open(postgres.Open("host=localhost"), &gorm.Config{
+		DryRun:               true,
+		DisableAutomaticPing: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stmt := db.Model(&Article{}).Scopes(orm.Search{Model: &Article{}, Query: "go"}.Apply).
+		Find(&[]Article{}).Statement
+
+	sql := stmt.SQL.String()
+	expected := `WHERE "articles"."search_vector" @@ websearch_to_tsquery($1::regconfig, $2) ` +
+		`ORDER BY ts_rank("articles"."search_vector", websearch_to_tsquery($3::regconfig, $4)) DESC`
+
+	if !strings.HasSuffix(sql, expected) {
+		t.Errorf("unexpected SQL: %s", sql)
+	}
+
+	if len(stmt.Vars) != 4 || stmt.Vars[1] != "go" {
+		t.Errorf("unexpected vars: %v", stmt.Vars)
+	}
+
+	if err = orm.MigrateSearch(db, "", &Post{}); err == nil {
+		t.Errorf("expected ErrNoSearchFields for model without search fields")
+	}
+}
@@ -0,0 +1,51 @@
+package orm
+
+import (
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// Struct tag key used for options that are handled by this package
+// rather than by gorm. Options are comma separated e.g `orm:"version"`.
+const TagName = "orm"
+
+// returns true if the orm tag of field contains option
+func hasTagOption(field *schema.Field, option string) bool {
+	for _, opt := range strings.Split(field.Tag.Get(TagName), ",") {
+		if strings.TrimSpace(opt) == option {
+			return true
+		}
+	}
+	return false
+}
+
+// returns the first field of s tagged with option or nil
+func taggedField(s *schema.Schema, option string) *schema.Field {
+	for _, field := range s.Fields {
+		if field.DBName != "" && hasTagOption(field, option) {
+			return field
+		}
+	}
+	return nil
+}
+
+// parses the gorm schema of v using the naming strategy of db.
+func parseSchema(db *gorm.DB, v any) (*schema.Schema, error) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(v); err != nil {
+		return nil, err
+	}
+	return stmt.Schema, nil
+}
+
+// dereferences v until a non-pointer value is reached
+func indirectValue(v any) reflect.Value {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Pointer || rv.Kind() == reflect.Interface {
+		rv = rv.Elem()
+	}
+	return rv
+}
@@ -0,0 +1,92 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Change is the JSON message sent to clients when a record changes.
+type Change struct {
+	Op      string `json:"op"`      // created, updated or deleted
+	Table   string `json:"table"`   // table of the model
+	ID      any    `json:"id"`      // primary key of the record
+	Payload any    `json:"payload"` // the record after the change, before for deletes
+}
+
+// a serialized change with the values clients filter on
+type changeMessage struct {
+	table   string
+	id      string
+	message []byte
+}
+
+// Clients select changes with query parameters of the websocket url:
+//
+//	/ws?tables=posts,comments&ids=1,2
+//
+// An empty filter matches all changes.
+type changeFilter struct {
+	tables map[string]bool
+	ids    map[string]bool
+}
+
+func parseFilter(r *http.Request) changeFilter {
+	return changeFilter{
+		tables: parseList(r.URL.Query().Get("tables")),
+		ids:    parseList(r.URL.Query().Get("ids")),
+	}
+}
+
+func parseList(s string) map[string]bool {
+	if s == "" {
+		return nil
+	}
+
+	set := make(map[string]bool)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			set[v] = true
+		}
+	}
+	return set
+}
+
+func (f changeFilter) match(table, id string) bool {
+	if len(f.tables) > 0 && !f.tables[table] {
+		return false
+	}
+	return len(f.ids) == 0 || f.ids[id]
+}
+
+// sends the change to clients whose filters match.
+// Client who can't recv are closed and deleted from the client map
+func (h *WebsocketHandler) broadcastChange(c changeMessage) {
+	for client := range h.clients {
+		if !client.filter.match(c.table, c.id) {
+			continue
+		}
+
+		select {
+		case client.send <- c.message:
+		default:
+			h.removeClient(client)
+		}
+	}
+}
+
+// BroadcastChange sends c as JSON to the clients whose filters match it.
+// It blocks until the hub receives the change or the hub is closed.
+// Changes of orm models are broadcast with the wsorm package.
+func (h *WebsocketHandler) BroadcastChange(c Change) error {
+	message, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case h.changes <- changeMessage{table: c.Table, id: fmt.Sprint(c.ID), message: message}:
+	case <-h.done:
+	}
+	return nil
+}
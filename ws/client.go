@@ -45,6 +45,9 @@ type Client struct {
 
 	// whether messages were sent by a server-side client
 	root bool
+
+	// tables and ids of the changes the client receives
+	filter changeFilter
 }
 
 // readPump pumps messages from the websocket connection to the hub.
@@ -27,6 +27,8 @@ type WebsocketHandler struct {
 	clients map[*Client]bool
 	// Inbound messages from the clients.
 	broadcast chan []byte
+	// Model changes sent to clients whose filters match.
+	changes chan changeMessage
 	// Register requests from the clients.
 	register chan *Client
 	// Unregister requests from clients.
@@ -48,6 +50,7 @@ func OnMessage(f func(msg []byte)) HubOption {
 func NewHandler(options ...HubOption) (handler *WebsocketHandler, quit func()) {
 	h := &WebsocketHandler{
 		broadcast:  make(chan []byte),
+		changes:    make(chan changeMessage),
 		register:   make(chan *Client),
 		unregister: make(chan *Client),
 		clients:    make(map[*Client]bool),
@@ -86,6 +89,8 @@ func (h *WebsocketHandler) Run() {
 			if h.onmessage != nil {
 				h.onmessage(message)
 			}
+		case change := <-h.changes:
+			h.broadcastChange(change)
 		case <-h.done:
 			// remove all clients and return
 			for c := range h.clients {
@@ -128,10 +133,11 @@ func (hub *WebsocketHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	// could pass more client specific identifiers from request like client_id, authentication etc
 	client := &Client{
-		hub:  hub,
-		conn: conn,
-		send: make(chan []byte, 256),
-		root: r.URL.Query().Get("root") == "true",
+		hub:    hub,
+		conn:   conn,
+		send:   make(chan []byte, 256),
+		root:   r.URL.Query().Get("root") == "true",
+		filter: parseFilter(r),
 	}
 
 	client.hub.register <- client
@@ -0,0 +1,158 @@
+/*
+Package wsorm broadcasts the changes of orm models to websocket clients.
+
+It is separate from package ws so that the websocket hub can be used
+without the database drivers of package orm.
+
+	bus := orm.NewBus(orm.BusOptions{Workers: 2})
+	bus.Register(db)
+
+	hub, quit := ws.NewHandler()
+	go hub.Run()
+	stop := wsorm.BroadcastChanges[User](hub, bus, wsorm.ChangeOptions{Omit: []string{"email"}})
+
+Clients select the changes they receive with the tables and ids query
+parameters of the websocket url e.g /ws?tables=users&ids=1,2
+*/
+package wsorm
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"reflect"
+	"strings"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/ws"
+)
+
+// Struct tag that strips a field from change payloads e.g `ws:"-"`
+const TagName = "ws"
+
+// ChangeOptions configure BroadcastChanges.
+type ChangeOptions struct {
+	// JSON names of top level fields to strip from payloads, in addition
+	// to fields tagged `ws:"-"` or `json:"-"`.
+	Omit []string
+}
+
+/*
+BroadcastChanges sends the committed changes of model T published by bus
+to the clients of hub. Call the returned function to stop.
+
+Payloads are the JSON of the record with sensitive fields removed,
+including those of preloaded relations. Records that can't be
+serialized are logged and skipped.
+*/
+func BroadcastChanges[T any](hub *ws.WebsocketHandler, bus *orm.Bus, opts ChangeOptions) (stop func()) {
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	idIndex := primaryKeyIndex(t)
+
+	return orm.Subscribe(bus, func(e orm.Event[T]) {
+		record := e.New
+		if record == nil {
+			record = e.Old
+		}
+
+		payload, err := payloadOf(record, opts.Omit)
+		if err != nil {
+			log.Printf("wsorm: unable to serialize %T: %v", record, err)
+			return
+		}
+
+		var id any
+		if idIndex != nil {
+			id = reflect.ValueOf(record).Elem().FieldByIndex(idIndex).Interface()
+		}
+
+		hub.BroadcastChange(ws.Change{Op: e.Type.String(), Table: e.Table, ID: id, Payload: payload})
+	})
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+// returns the index of the primary key of t: the field tagged as gorm
+// primaryKey, or else the field named ID.
+func primaryKeyIndex(t reflect.Type) []int {
+	var id []int
+	for _, field := range reflect.VisibleFields(t) {
+		if strings.Contains(strings.ToLower(field.Tag.Get("gorm")), "primarykey") {
+			return field.Index
+		}
+
+		if field.Name == "ID" && id == nil {
+			id = field.Index
+		}
+	}
+	return id
+}
+
+// returns the JSON object of v without the omitted keys and the fields
+// tagged `ws:"-"` at any depth
+func payloadOf(v any, omit []string) (map[string]any, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	// numbers are kept as written so that large ids keep their precision
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+
+	var m map[string]any
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	stripTagged(reflect.TypeOf(v), m)
+	for _, name := range omit {
+		delete(m, name)
+	}
+	return m, nil
+}
+
+// deletes the fields tagged `ws:"-"` from doc, the decoded JSON of a value of t
+func stripTagged(t reflect.Type, doc any) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := doc.(map[string]any)
+		if !ok {
+			return
+		}
+
+		for _, field := range reflect.VisibleFields(t) {
+			// fields of embedded structs are promoted by encoding/json
+			if !field.IsExported() || (field.Anonymous && field.Tag.Get("json") == "") {
+				continue
+			}
+
+			name := jsonName(field)
+			if field.Tag.Get(TagName) == "-" {
+				delete(m, name)
+			} else if value, ok := m[name]; ok {
+				stripTagged(field.Type, value)
+			}
+		}
+	case reflect.Slice, reflect.Array:
+		elements, _ := doc.([]any)
+		for _, element := range elements {
+			stripTagged(t.Elem(), element)
+		}
+	case reflect.Map:
+		values, _ := doc.(map[string]any)
+		for _, value := range values {
+			stripTagged(t.Elem(), value)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package wsorm_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiiranathan/gowrap/orm"
+	"github.com/abiiranathan/gowrap/orm/ormtest"
+	"github.com/abiiranathan/gowrap/ws"
+	"github.com/abiiranathan/gowrap/ws/wsorm"
+	"github.com/gorilla/websocket"
+)
+
+type Account struct {
+	ID       uint     `json:"id" gorm:"primaryKey"`
+	Name     string   `json:"name"`
+	Email    string   `json:"email"`
+	Password string   `json:"password" ws:"-"`
+	Keys     []APIKey `json:"keys"`
+}
+
+type APIKey struct {
+	ID        uint   `json:"id"`
+	AccountID uint   `json:"account_id"`
+	Token     string `json:"token" ws:"-"`
+}
+
+func TestBroadcastChanges(t *testing.T) {
+	t.Parallel()
+
+	db := ormtest.NewDB(t, &Account{}, &APIKey{})
+	bus := orm.NewBus(orm.BusOptions{})
+	bus.Register(db)
+
+	hub, quit := ws.NewHandler()
+	defer quit()
+	go hub.Run()
+
+	stop := wsorm.BroadcastChanges[Account](hub, bus, wsorm.ChangeOptions{Omit: []string{"email"}})
+	defer stop()
+
+	server := httptest.NewServer(hub)
+	defer server.Close()
+
+	dial := func(query string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws" + query
+		conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { conn.Close() })
+		return conn
+	}
+
+	// blocks until the hub sends probes matching the filter of conn,
+	// which shows that the client is registered
+	ready := func(conn *websocket.Conn, table string, id any) {
+		done, stopped := make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(stopped)
+			for {
+				hub.BroadcastChange(ws.Change{Op: "probe", Table: table, ID: id})
+				select {
+				case <-done:
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}()
+
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		_, _, err := conn.ReadMessage()
+		close(done)
+		<-stopped
+
+		if err != nil {
+			t.Fatalf("client not registered: %v", err)
+		}
+	}
+
+	all := dial("")
+	ready(all, "accounts", 1)
+	filtered := dial("?tables=accounts&ids=2")
+	ready(filtered, "accounts", 2)
+	other := dial("?tables=posts")
+	ready(other, "posts", 1)
+
+	dborm := orm.New(db)
+	dborm.Insert(&Account{Name: "alice", Email: "alice@example.com", Password: "secret",
+		Keys: []APIKey{{Token: "token"}}})
+	dborm.Insert(&Account{Name: "bob", Password: "secret"})
+	dborm.PartialUpdate(&Account{ID: 2}, Account{Name: "robert"}, orm.Where{})
+
+	// reads n changes, skipping probes, until the deadline
+	read := func(conn *websocket.Conn, n int, deadline time.Duration) ([]ws.Change, error) {
+		var changes []ws.Change
+		conn.SetReadDeadline(time.Now().Add(deadline))
+		for len(changes) < n {
+			_, message, err := conn.ReadMessage()
+			if err != nil {
+				return changes, err
+			}
+
+			for _, line := range strings.Split(string(message), "\n") {
+				var c ws.Change
+				if err := json.Unmarshal([]byte(line), &c); err != nil {
+					t.Fatal(err)
+				}
+
+				if c.Op != "probe" {
+					changes = append(changes, c)
+				}
+			}
+		}
+		return changes, nil
+	}
+
+	changes, err := read(all, 3, 2*time.Second)
+	if err != nil {
+		t.Fatalf("expected 3 changes, got %v: %v", changes, err)
+	}
+
+	if c := changes[0]; c.Op != "created" || c.Table != "accounts" || c.ID != float64(1) {
+		t.Errorf("unexpected change: %+v", c)
+	}
+
+	payload := changes[0].Payload.(map[string]any)
+	if payload["name"] != "alice" || payload["password"] != nil || payload["email"] != nil {
+		t.Errorf("sensitive fields must be stripped, got %v", payload)
+	}
+
+	keys, _ := payload["keys"].([]any)
+	if len(keys) != 1 || keys[0].(map[string]any)["token"] != nil {
+		t.Errorf("sensitive fields of relations must be stripped, got %v", payload["keys"])
+	}
+
+	changes, err = read(filtered, 2, 2*time.Second)
+	if err != nil {
+		t.Fatalf("expected 2 changes, got %v: %v", changes, err)
+	}
+
+	if changes[0].ID != float64(2) || changes[1].Op != "updated" || changes[1].Payload.(map[string]any)["name"] != "robert" {
+		t.Errorf("unexpected filtered changes: %+v", changes)
+	}
+
+	// changes are sent in order, so any change of accounts sent to the
+	// other client would arrive before this probe
+	hub.BroadcastChange(ws.Change{Op: "probe", Table: "posts"})
+	other.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, message, err := other.ReadMessage()
+		if err != nil {
+			t.Fatalf("probe not received: %v", err)
+		}
+
+		if !strings.Contains(string(message), `"op":"probe"`) {
+			t.Errorf("client filtering another table received %s", message)
+		}
+
+		if strings.Contains(string(message), `"id":null`) {
+			break
+		}
+	}
+}